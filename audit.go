@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Audit rule IDs, alongside the validation rule IDs in validator.go
+const (
+	RuleBlockedInlineScript   = "blocked-inline-script"
+	RuleBlockedEventHandler   = "blocked-event-handler"
+	RuleBlockedStyleTag       = "blocked-style-tag"
+	RuleBlockedStyleAttribute = "blocked-style-attribute"
+	RuleBlockedResource       = "blocked-resource"
+)
+
+// inlineRules maps an inline content type to the rule reported when it is blocked
+var inlineRules = map[string]string{
+	ContentTypeScript:       RuleBlockedInlineScript,
+	ContentTypeEventHandler: RuleBlockedEventHandler,
+	ContentTypeStyleTag:     RuleBlockedStyleTag,
+	ContentTypeStyleAttr:    RuleBlockedStyleAttribute,
+}
+
+// inlineDirectives maps an inline content type to its effective directive
+var inlineDirectives = map[string]string{
+	ContentTypeScript:       "script-src-elem",
+	ContentTypeEventHandler: "script-src-attr",
+	ContentTypeStyleTag:     "style-src-elem",
+	ContentTypeStyleAttr:    "style-src-attr",
+}
+
+// resourceDestinations maps an ExternalResource type to its request destination
+var resourceDestinations = map[string]string{
+	"script":     "script",
+	"stylesheet": "style",
+	"image":      "image",
+	"font":       "font",
+	"frame":      "frame",
+	"other":      "connect",
+	"connect":    "connect",
+}
+
+// inlineContentLabels are human readable plural names for inline content types
+var inlineContentLabels = map[string]string{
+	ContentTypeScript:       "inline scripts",
+	ContentTypeStyleTag:     "style tags",
+	ContentTypeStyleAttr:    "style attributes",
+	ContentTypeEventHandler: "event handlers",
+}
+
+// AuditOptions controls which content AuditFile checks
+type AuditOptions struct {
+	Origin          string        // origin the pages are served from, used for relative URLs and 'self'
+	Algorithm       HashAlgorithm // algorithm used when suggesting missing hashes
+	NoScripts       bool
+	NoStyles        bool
+	NoInlineStyles  bool
+	NoEventHandlers bool
+}
+
+// AuditFinding is a piece of content in an HTML file that the policy would block
+type AuditFinding struct {
+	Rule      string // one of the RuleBlocked* constants
+	File      string
+	Line      int // 1-based position of the offending element, 0 if unknown
+	Column    int
+	Type      string // inline content type ("script", "event-handler", ...) or external resource type
+	Content   string // inline content, or the URL of an external resource
+	Directive string // effective directive that governs the content, e.g. "script-src-attr"
+	Reason    string
+}
+
+// policyAllowsInline checks whether a policy allows an inline script, style or handler, following
+// the CSP3 "does element match source list for type and source" algorithm. When the content
+// is blocked, the reason names the hash (computed with algo) that would allow it.
+func policyAllowsInline(p *Policy, item InlineContent, algo HashAlgorithm) MatchResult {
+	directiveName := inlineDirectives[item.Type]
+	result := MatchResult{Directive: directiveName}
+
+	directive := p.Effective(directiveName)
+	if directive == nil {
+		result.Allowed = true
+		result.Reason = fmt.Sprintf("no %s or fallback directive restricts inline content", directiveName)
+		return result
+	}
+	result.DecidedBy = directive.Name
+
+	isElement := item.Type == ContentTypeScript || item.Type == ContentTypeStyleTag
+	isScript := item.Type == ContentTypeScript || item.Type == ContentTypeEventHandler
+
+	if isElement && item.Nonce != "" && directive.Has("'nonce-"+item.Nonce+"'") {
+		result.Allowed = true
+		result.Source = "'nonce-" + item.Nonce + "'"
+		result.Reason = fmt.Sprintf("allowed by the element's nonce in %s", directive.Name)
+		return result
+	}
+
+	if hash := matchingHashSource(directive, item.Content); hash != "" {
+		if isElement || directive.Has("'unsafe-hashes'") {
+			result.Allowed = true
+			result.Source = hash
+			result.Reason = fmt.Sprintf("allowed by %s in %s", hash, directive.Name)
+			return result
+		}
+		result.Reason = fmt.Sprintf("'unsafe-hashes' missing: %s is in %s, but hashes only apply to %s when 'unsafe-hashes' is present",
+			hash, directive.Name, inlineContentLabels[item.Type])
+		return result
+	}
+
+	fix := fmt.Sprintf("add %s to %s", ComputeHash(item.Content, algo), directive.Name)
+	if !isElement && !directive.Has("'unsafe-hashes'") {
+		fix += " together with 'unsafe-hashes'"
+	}
+
+	if directive.Has("'unsafe-inline'") {
+		hasHashOrNonce := directive.HasKind(SourceKindHash) || directive.HasKind(SourceKindNonce)
+		strictDynamic := isScript && directive.Has("'strict-dynamic'")
+		if !hasHashOrNonce && !strictDynamic {
+			result.Allowed = true
+			result.Source = "'unsafe-inline'"
+			result.Reason = fmt.Sprintf("allowed by 'unsafe-inline' in %s", directive.Name)
+			return result
+		}
+		result.Reason = fmt.Sprintf("'unsafe-inline' in %s is ignored because the directive contains hashes, nonces or 'strict-dynamic'; %s", directive.Name, fix)
+		return result
+	}
+
+	result.Reason = "hash missing: " + fix
+	return result
+}
+
+// AllowsInline checks inline content against every policy in the list; the content is
+// allowed only if all policies allow it. The first blocking result is returned.
+func (pl *PolicyList) AllowsInline(item InlineContent, algo HashAlgorithm) MatchResult {
+	result := MatchResult{Allowed: true, Directive: inlineDirectives[item.Type], Reason: "no policy"}
+	for _, policy := range pl.Policies {
+		result = policyAllowsInline(policy, item, algo)
+		if !result.Allowed {
+			return result
+		}
+	}
+	return result
+}
+
+// AuditFile returns every piece of inline content and every external resource in an HTML
+// file that the policies would block, in document order (inline content first)
+func AuditFile(filePath string, policies *PolicyList, opts AuditOptions) ([]AuditFinding, error) {
+	items, err := ExtractInlineItems(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []AuditFinding{}
+	for _, item := range items {
+		if skipInlineItem(item, opts) {
+			continue
+		}
+		result := policies.AllowsInline(item, opts.Algorithm)
+		if result.Allowed {
+			continue
+		}
+		findings = append(findings, AuditFinding{
+			Rule:      inlineRules[item.Type],
+			File:      filePath,
+			Line:      item.Line,
+			Column:    item.Column,
+			Type:      item.Type,
+			Content:   item.Content,
+			Directive: result.Directive,
+			Reason:    result.Reason,
+		})
+	}
+
+	resources, err := ExtractExternalResources(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	tags := scanSourceTags(source)
+
+	all := [][]ExternalResource{resources.Scripts, resources.Stylesheets, resources.Images, resources.Fonts, resources.Frames, resources.Other}
+	for _, list := range all {
+		for _, res := range list {
+			result, err := policies.Allows(MatchRequest{Origin: opts.Origin, URL: res.URL, Destination: resourceDestinations[res.Type]})
+			if err != nil {
+				return nil, err
+			}
+			if !result.Allowed {
+				line, column := locateURL(tags, res.URL)
+				findings = append(findings, AuditFinding{Rule: RuleBlockedResource, File: filePath, Line: line, Column: column,
+					Type: res.Type, Content: res.URL, Directive: result.Directive, Reason: result.Reason})
+			}
+		}
+	}
+
+	// data: URLs are not recorded as resources, only flagged per type
+	for _, resourceType := range []string{"image", "font"} {
+		if !resources.UsesDataURLs[resourceType] {
+			continue
+		}
+		result, err := policies.Allows(MatchRequest{Origin: opts.Origin, URL: "data:", Destination: resourceType})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Allowed {
+			findings = append(findings, AuditFinding{Rule: RuleBlockedResource, File: filePath, Type: resourceType, Content: "data: URL", Directive: result.Directive,
+				Reason: fmt.Sprintf("no source in %s matches data: URLs; add data: to allow them", result.DecidedBy)})
+		}
+	}
+
+	return findings, nil
+}
+
+// skipInlineItem reports whether an inline item is excluded by the audit options
+func skipInlineItem(item InlineContent, opts AuditOptions) bool {
+	switch item.Type {
+	case ContentTypeScript:
+		return opts.NoScripts
+	case ContentTypeStyleTag:
+		return opts.NoStyles
+	case ContentTypeStyleAttr:
+		return opts.NoInlineStyles
+	case ContentTypeEventHandler:
+		return opts.NoEventHandlers
+	}
+	return false
+}
+
+// matchingHashSource returns the hash source in the directive that matches content, or ""
+func matchingHashSource(directive *Directive, content string) string {
+	for _, src := range directive.Sources {
+		if src.Kind != SourceKindHash {
+			continue
+		}
+		dash := strings.Index(src.Value, "-")
+		algo := HashAlgorithm(strings.ToLower(src.Value[1:dash]))
+		if ComputeHash(content, algo) == "'"+string(algo)+src.Value[dash:] {
+			return src.Value
+		}
+	}
+	return ""
+}
+
+// PrintAuditFindings prints audit findings in a human-readable format
+func PrintAuditFindings(findings []AuditFinding, fileCount int) {
+	if len(findings) == 0 {
+		fmt.Printf("✓ Nothing in %d file(s) would be blocked by the policy\n", fileCount)
+		return
+	}
+
+	fmt.Printf("✗ %d item(s) would be blocked by the policy\n\n", len(findings))
+	for i, finding := range findings {
+		location := finding.File
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", finding.File, finding.Line, finding.Column)
+		}
+		fmt.Printf("✗ %s: %s %s\n", location, finding.Type, createSnippet(finding.Content, 60))
+		fmt.Printf("  Directive: %s\n", finding.Directive)
+		fmt.Printf("  Reason: %s\n", finding.Reason)
+		if i < len(findings)-1 {
+			fmt.Println()
+		}
+	}
+}
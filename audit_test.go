@@ -0,0 +1,223 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPolicyAllowsInline(t *testing.T) {
+	scriptHash := ComputeHash("run()", SHA256)
+	handlerHash := ComputeHash("go()", SHA256)
+
+	tests := []struct {
+		name         string
+		csp          string
+		item         InlineContent
+		allowed      bool
+		directive    string
+		reasonSubstr string
+	}{
+		{
+			name:         "no restriction",
+			csp:          "img-src 'self'",
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      true,
+			directive:    "script-src-elem",
+			reasonSubstr: "no script-src-elem",
+		},
+		{
+			name:         "script hash present",
+			csp:          "script-src " + scriptHash,
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      true,
+			directive:    "script-src-elem",
+			reasonSubstr: "allowed by " + scriptHash,
+		},
+		{
+			name:         "script hash missing",
+			csp:          "default-src 'self'",
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      false,
+			directive:    "script-src-elem",
+			reasonSubstr: "hash missing: add " + scriptHash + " to default-src",
+		},
+		{
+			name:         "hash with another algorithm",
+			csp:          "script-src " + ComputeHash("run()", SHA384),
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      true,
+			directive:    "script-src-elem",
+			reasonSubstr: "allowed by 'sha384-",
+		},
+		{
+			name:         "matching nonce",
+			csp:          "script-src 'nonce-abc'",
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()", Nonce: "abc"},
+			allowed:      true,
+			directive:    "script-src-elem",
+			reasonSubstr: "nonce",
+		},
+		{
+			name:         "wrong nonce",
+			csp:          "script-src 'nonce-abc'",
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()", Nonce: "xyz"},
+			allowed:      false,
+			directive:    "script-src-elem",
+			reasonSubstr: "hash missing",
+		},
+		{
+			name:         "event handler hash without unsafe-hashes",
+			csp:          "script-src " + handlerHash,
+			item:         InlineContent{Type: ContentTypeEventHandler, Content: "go()"},
+			allowed:      false,
+			directive:    "script-src-attr",
+			reasonSubstr: "'unsafe-hashes' missing",
+		},
+		{
+			name:         "event handler hash with unsafe-hashes",
+			csp:          "script-src 'unsafe-hashes' " + handlerHash,
+			item:         InlineContent{Type: ContentTypeEventHandler, Content: "go()"},
+			allowed:      true,
+			directive:    "script-src-attr",
+			reasonSubstr: "allowed by " + handlerHash,
+		},
+		{
+			name:         "event handler hash missing suggests unsafe-hashes",
+			csp:          "script-src 'self'",
+			item:         InlineContent{Type: ContentTypeEventHandler, Content: "go()"},
+			allowed:      false,
+			directive:    "script-src-attr",
+			reasonSubstr: "together with 'unsafe-hashes'",
+		},
+		{
+			name:         "event handler nonce does not apply",
+			csp:          "script-src 'nonce-abc'",
+			item:         InlineContent{Type: ContentTypeEventHandler, Content: "go()", Nonce: "abc"},
+			allowed:      false,
+			directive:    "script-src-attr",
+			reasonSubstr: "hash missing",
+		},
+		{
+			name:         "unsafe-inline allows",
+			csp:          "style-src 'unsafe-inline'",
+			item:         InlineContent{Type: ContentTypeStyleAttr, Content: "color:red"},
+			allowed:      true,
+			directive:    "style-src-attr",
+			reasonSubstr: "'unsafe-inline'",
+		},
+		{
+			name:         "unsafe-inline ignored with hashes",
+			csp:          "script-src 'unsafe-inline' " + handlerHash,
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      false,
+			directive:    "script-src-elem",
+			reasonSubstr: "is ignored",
+		},
+		{
+			name:         "unsafe-inline ignored with strict-dynamic",
+			csp:          "script-src 'unsafe-inline' 'strict-dynamic'",
+			item:         InlineContent{Type: ContentTypeScript, Content: "run()"},
+			allowed:      false,
+			directive:    "script-src-elem",
+			reasonSubstr: "is ignored",
+		},
+		{
+			name:         "strict-dynamic does not affect styles",
+			csp:          "style-src 'unsafe-inline' 'strict-dynamic'",
+			item:         InlineContent{Type: ContentTypeStyleTag, Content: "p{}"},
+			allowed:      true,
+			directive:    "style-src-elem",
+			reasonSubstr: "'unsafe-inline'",
+		},
+		{
+			name:         "attr directive overrides fallback",
+			csp:          "script-src 'self'; script-src-attr 'unsafe-inline'",
+			item:         InlineContent{Type: ContentTypeEventHandler, Content: "go()"},
+			allowed:      true,
+			directive:    "script-src-attr",
+			reasonSubstr: "in script-src-attr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := policyAllowsInline(ParsePolicy(tt.csp), tt.item, SHA256)
+			if result.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v (reason: %s)", result.Allowed, tt.allowed, result.Reason)
+			}
+			if result.Directive != tt.directive {
+				t.Errorf("Directive = %q, want %q", result.Directive, tt.directive)
+			}
+			if !strings.Contains(result.Reason, tt.reasonSubstr) {
+				t.Errorf("Reason %q does not contain %q", result.Reason, tt.reasonSubstr)
+			}
+		})
+	}
+}
+
+func TestPolicyListAllowsInline(t *testing.T) {
+	hash := ComputeHash("run()", SHA256)
+	item := InlineContent{Type: ContentTypeScript, Content: "run()"}
+
+	if result := ParsePolicyList("script-src "+hash+", default-src 'none'").AllowsInline(item, SHA256); result.Allowed {
+		t.Error("Expected the second policy to block the script")
+	}
+	if result := ParsePolicyList("script-src "+hash+", script-src 'self' "+hash).AllowsInline(item, SHA256); !result.Allowed {
+		t.Errorf("Expected both policies to allow the script: %s", result.Reason)
+	}
+}
+
+func TestAuditFile(t *testing.T) {
+	html := `<html><head><script>run()</script><script src="https://cdn.example.com/app.js"></script>` +
+		`<script src="https://evil.example.org/x.js"></script><style>p{}</style></head>` +
+		`<body onclick="go()"><img src="/logo.png"><img src="data:image/png;base64,AA==">` +
+		`<div style="color:red"></div></body></html>`
+	tmpfile, err := os.CreateTemp("", "test*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte(html))
+	tmpfile.Close()
+
+	csp := "default-src 'self'; script-src 'self' https://cdn.example.com " + ComputeHash("run()", SHA256) + "; style-src 'self' 'unsafe-inline'"
+	opts := AuditOptions{Origin: "https://example.com", Algorithm: SHA256}
+
+	findings, err := AuditFile(tmpfile.Name(), ParsePolicyList(csp), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		contentType string
+		content     string
+		directive   string
+	}{
+		{ContentTypeEventHandler, "go()", "script-src-attr"},
+		{"script", "https://evil.example.org/x.js", "script-src-elem"},
+		{"image", "data: URL", "img-src"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %d: %+v", len(expected), len(findings), findings)
+	}
+	for i, want := range expected {
+		got := findings[i]
+		if got.Type != want.contentType || got.Content != want.content || got.Directive != want.directive {
+			t.Errorf("Finding %d: expected %s %q (%s), got %s %q (%s)", i, want.contentType, want.content, want.directive, got.Type, got.Content, got.Directive)
+		}
+		if got.File != tmpfile.Name() || got.Reason == "" {
+			t.Errorf("Finding %d: missing file or reason: %+v", i, got)
+		}
+	}
+
+	// Disabled content types are not audited
+	opts.NoEventHandlers = true
+	findings, err = AuditFile(tmpfile.Name(), ParsePolicyList(csp), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Errorf("Expected 2 findings with --no-event-handlers, got %d: %+v", len(findings), findings)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runCheck implements the "csp check" subcommand: it reports whether each URL would be
+// allowed by the policy and which directive decided. It returns the process exit code.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	cspFlag := fs.String("csp", "", "CSP header to check against (comma-separated policies are all enforced)")
+	origin := fs.String("origin", "", "Origin of the document loading the resource, e.g. https://example.com")
+	destination := fs.String("type", "script", "Request destination: script, style, image, font, frame, connect, manifest, worker, media, object, form, base")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: csp check --csp \"CSP_HEADER\" --origin ORIGIN [--type TYPE] url1 [url2 ...]\n\n")
+		fmt.Fprintf(os.Stderr, "Report whether each URL would be allowed by the policy when loaded from ORIGIN.\n")
+		fmt.Fprintf(os.Stderr, "Exits with status 1 if any URL is blocked.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  csp check --csp \"script-src 'self'\" --origin https://example.com https://cdn.example.com/app.js\n")
+		fmt.Fprintf(os.Stderr, "  csp check --csp \"default-src 'self'\" --origin https://example.com --type image /logo.png\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *cspFlag == "" || *origin == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	policies := ParsePolicyList(*cspFlag)
+	exitCode := 0
+
+	for _, target := range fs.Args() {
+		result, err := policies.Allows(MatchRequest{Origin: *origin, URL: target, Destination: *destination})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+
+		status := "ALLOWED"
+		if !result.Allowed {
+			status = "BLOCKED"
+			exitCode = 1
+		}
+		fmt.Printf("%s %s %s\n", status, result.Directive, target)
+		fmt.Printf("  %s\n", result.Reason)
+	}
+
+	return exitCode
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// violationLogName is the file the collector appends violations to; rotated files
+	// are named violations.1.jsonl, violations.2.jsonl... from the newest to the oldest
+	violationLogName = "violations.jsonl"
+
+	// Report formats, as recorded in Violation.Format
+	ReportFormatLegacy       = "csp-report"
+	ReportFormatReportingAPI = "reports+json"
+)
+
+// Violation is a policy violation reported by a browser, in either report format
+type Violation struct {
+	Time           time.Time `json:"time"`
+	Format         string    `json:"format"`
+	DocumentURL    string    `json:"documentURL"`
+	Referrer       string    `json:"referrer,omitempty"`
+	BlockedURL     string    `json:"blockedURL"`
+	Directive      string    `json:"directive"` // effective directive, e.g. script-src-elem
+	OriginalPolicy string    `json:"originalPolicy,omitempty"`
+	Disposition    string    `json:"disposition,omitempty"` // enforce or report
+	SourceFile     string    `json:"sourceFile,omitempty"`
+	Line           int       `json:"line,omitempty"`
+	Column         int       `json:"column,omitempty"`
+	Sample         string    `json:"sample,omitempty"`
+	StatusCode     int       `json:"statusCode,omitempty"`
+	UserAgent      string    `json:"userAgent,omitempty"`
+}
+
+// legacyReport is the body of a report-uri request
+type legacyReport struct {
+	Report *struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		ScriptSample       string `json:"script-sample"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// apiReport is one report of a Reporting API batch
+type apiReport struct {
+	Type      string          `json:"type"`
+	Age       int64           `json:"age"` // milliseconds between the violation and the delivery
+	URL       string          `json:"url"`
+	UserAgent string          `json:"user_agent"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// apiViolationBody is the body of a csp-violation report of the Reporting API
+type apiViolationBody struct {
+	DocumentURL        string `json:"documentURL"`
+	Referrer           string `json:"referrer"`
+	BlockedURL         string `json:"blockedURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"sourceFile"`
+	LineNumber         int    `json:"lineNumber"`
+	ColumnNumber       int    `json:"columnNumber"`
+	Sample             string `json:"sample"`
+	StatusCode         int    `json:"statusCode"`
+}
+
+// ParseReports converts the body of a report request into violations, received at now.
+// It accepts application/csp-report and application/reports+json, and application/json
+// in either shape. Reporting API reports of other types are ignored.
+func ParseReports(contentType string, body []byte, now time.Time) ([]Violation, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q", contentType)
+	}
+	switch mediaType {
+	case "application/csp-report":
+		return parseLegacyReport(body, now)
+	case "application/reports+json":
+		return parseReportBatch(body, now)
+	case "application/json":
+		if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+			return parseReportBatch(body, now)
+		}
+		return parseLegacyReport(body, now)
+	}
+	return nil, fmt.Errorf("unsupported content type %q, expected application/csp-report or application/reports+json", mediaType)
+}
+
+// parseLegacyReport converts a report-uri request body
+func parseLegacyReport(body []byte, now time.Time) ([]Violation, error) {
+	var report legacyReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	r := report.Report
+	if r == nil || r.DocumentURI == "" {
+		return nil, fmt.Errorf("invalid report: missing csp-report.document-uri")
+	}
+
+	// Older browsers only send the violated directive, which may include its sources
+	directive := r.EffectiveDirective
+	if directive == "" {
+		directive, _, _ = strings.Cut(strings.TrimSpace(r.ViolatedDirective), " ")
+	}
+	return []Violation{{
+		Time:           now,
+		Format:         ReportFormatLegacy,
+		DocumentURL:    r.DocumentURI,
+		Referrer:       r.Referrer,
+		BlockedURL:     r.BlockedURI,
+		Directive:      strings.ToLower(directive),
+		OriginalPolicy: r.OriginalPolicy,
+		Disposition:    r.Disposition,
+		SourceFile:     r.SourceFile,
+		Line:           r.LineNumber,
+		Column:         r.ColumnNumber,
+		Sample:         r.ScriptSample,
+		StatusCode:     r.StatusCode,
+	}}, nil
+}
+
+// parseReportBatch converts a Reporting API request body
+func parseReportBatch(body []byte, now time.Time) ([]Violation, error) {
+	var reports []apiReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil, fmt.Errorf("invalid report batch: %w", err)
+	}
+
+	var violations []Violation
+	for i, report := range reports {
+		if report.Type != "csp-violation" {
+			continue
+		}
+		var b apiViolationBody
+		if err := json.Unmarshal(report.Body, &b); err != nil {
+			return nil, fmt.Errorf("invalid report %d: %w", i, err)
+		}
+		if b.DocumentURL == "" {
+			b.DocumentURL = report.URL
+		}
+		if b.DocumentURL == "" {
+			return nil, fmt.Errorf("invalid report %d: missing body.documentURL", i)
+		}
+		violations = append(violations, Violation{
+			Time:           now.Add(-time.Duration(max(report.Age, 0)) * time.Millisecond),
+			Format:         ReportFormatReportingAPI,
+			DocumentURL:    b.DocumentURL,
+			Referrer:       b.Referrer,
+			BlockedURL:     b.BlockedURL,
+			Directive:      strings.ToLower(b.EffectiveDirective),
+			OriginalPolicy: b.OriginalPolicy,
+			Disposition:    b.Disposition,
+			SourceFile:     b.SourceFile,
+			Line:           b.LineNumber,
+			Column:         b.ColumnNumber,
+			Sample:         b.Sample,
+			StatusCode:     b.StatusCode,
+			UserAgent:      report.UserAgent,
+		})
+	}
+	return violations, nil
+}
+
+// ViolationLog appends violations to a JSONL file in a directory, rotating it when it
+// would grow past MaxBytes and keeping at most MaxFiles rotated files
+type ViolationLog struct {
+	Dir      string
+	MaxBytes int64
+	MaxFiles int
+
+	mu sync.Mutex
+}
+
+// Append writes violations to the log, one JSON object per line
+func (vl *ViolationLog) Append(violations []Violation) error {
+	var lines []byte
+	for _, v := range violations {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	path := filepath.Join(vl.Dir, violationLogName)
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && vl.MaxBytes > 0 && info.Size()+int64(len(lines)) > vl.MaxBytes {
+		if err := vl.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(lines); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotate renames the log to violations.1.jsonl, shifting the older files and deleting
+// the ones beyond MaxFiles
+func (vl *ViolationLog) rotate() error {
+	if vl.MaxFiles <= 0 {
+		return os.Remove(filepath.Join(vl.Dir, violationLogName))
+	}
+	if err := os.Remove(rotatedLogPath(vl.Dir, vl.MaxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := vl.MaxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(rotatedLogPath(vl.Dir, i), rotatedLogPath(vl.Dir, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatedLogPath returns the path of the nth rotated log, or of the current log for 0
+func rotatedLogPath(dir string, n int) string {
+	if n == 0 {
+		return filepath.Join(dir, violationLogName)
+	}
+	return filepath.Join(dir, fmt.Sprintf("violations.%d.jsonl", n))
+}
+
+// CollectHandler returns an HTTP handler accepting violation reports of at most maxBytes
+// and appending them to the log. Browsers send Reporting API reports to other origins
+// with CORS, so preflight requests are answered for any origin.
+func CollectHandler(log *ViolationLog, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		switch r.Method {
+		case http.MethodOptions:
+			w.Header().Set("Access-Control-Allow-Methods", "POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodPost:
+		default:
+			w.Header().Set("Allow", "POST, OPTIONS")
+			http.Error(w, "reports must be sent with POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("report exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to read report", http.StatusBadRequest)
+			return
+		}
+
+		violations, err := ParseReports(r.Header.Get("Content-Type"), body, time.Now().UTC())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i := range violations {
+			if violations[i].UserAgent == "" {
+				violations[i].UserAgent = r.UserAgent()
+			}
+		}
+		if err := log.Append(violations); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to store reports: %v\n", err)
+			http.Error(w, "failed to store reports", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// runCollect implements the "csp collect" subcommand: it receives violation reports and
+// appends them to rotating JSONL files. It returns the process exit code.
+func runCollect(args []string) int {
+	fs := flag.NewFlagSet("collect", flag.ContinueOnError)
+	listen := fs.String("listen", ":8081", "Address to listen on")
+	dir := fs.String("dir", "csp-reports", "Directory to write "+violationLogName+" and its rotated files to")
+	maxReportBytes := fs.Int64("max-report-size", 64<<10, "Maximum size in bytes of a report request")
+	maxFileBytes := fs.Int64("max-file-size", 10<<20, "Size in bytes at which "+violationLogName+" is rotated")
+	maxFiles := fs.Int("max-files", 5, "Number of rotated files to keep")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: csp collect [--listen ADDR] [--dir DIR] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Receive CSP violation reports sent to report-uri (application/csp-report) or\n")
+		fmt.Fprintf(os.Stderr, "report-to (application/reports+json) and append them to %s in DIR.\n", violationLogName)
+		fmt.Fprintf(os.Stderr, "List them with csp violations.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  csp collect --listen :8081 --dir /var/log/csp\n")
+		fmt.Fprintf(os.Stderr, "  csp --report-only --report-endpoint csp=https://csp.example.com/ index.html\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 || *maxReportBytes <= 0 || *maxFileBytes <= 0 || *maxFiles < 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	log := &ViolationLog{Dir: *dir, MaxBytes: *maxFileBytes, MaxFiles: *maxFiles}
+	fmt.Fprintf(os.Stderr, "Collecting reports on %s into %s\n", *listen, filepath.Join(*dir, violationLogName))
+	if err := http.ListenAndServe(*listen, CollectHandler(log, *maxReportBytes)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
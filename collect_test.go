@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const legacyReportBody = `{"csp-report": {
+	"document-uri": "https://example.com/page",
+	"referrer": "",
+	"blocked-uri": "https://evil.example.com/x.js",
+	"violated-directive": "script-src-elem 'self'",
+	"original-policy": "script-src 'self'; report-uri /csp",
+	"disposition": "enforce",
+	"line-number": 12,
+	"status-code": 200
+}}`
+
+const reportBatchBody = `[
+	{"type": "deprecation", "url": "https://example.com/", "body": {"id": "x"}},
+	{"type": "csp-violation", "age": 2000, "url": "https://example.com/", "user_agent": "Browser/1.0", "body": {
+		"documentURL": "https://example.com/",
+		"blockedURL": "inline",
+		"effectiveDirective": "style-src-attr",
+		"originalPolicy": "style-src 'self'; report-to csp",
+		"disposition": "report",
+		"sample": "color: red",
+		"lineNumber": 3,
+		"columnNumber": 7
+	}}
+]`
+
+func TestParseReports(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    []Violation
+		err         string
+	}{
+		{
+			name:        "legacy report",
+			contentType: "application/csp-report",
+			body:        legacyReportBody,
+			expected: []Violation{{
+				Time: now, Format: ReportFormatLegacy, DocumentURL: "https://example.com/page",
+				BlockedURL: "https://evil.example.com/x.js", Directive: "script-src-elem",
+				OriginalPolicy: "script-src 'self'; report-uri /csp", Disposition: "enforce", Line: 12, StatusCode: 200,
+			}},
+		},
+		{
+			name:        "reporting API batch",
+			contentType: "application/reports+json; charset=utf-8",
+			body:        reportBatchBody,
+			expected: []Violation{{
+				Time: now.Add(-2 * time.Second), Format: ReportFormatReportingAPI, DocumentURL: "https://example.com/",
+				BlockedURL: "inline", Directive: "style-src-attr", OriginalPolicy: "style-src 'self'; report-to csp",
+				Disposition: "report", Sample: "color: red", Line: 3, Column: 7, UserAgent: "Browser/1.0",
+			}},
+		},
+		{
+			name:        "application/json legacy report",
+			contentType: "application/json",
+			body:        `{"csp-report": {"document-uri": "https://example.com/", "effective-directive": "IMG-SRC", "blocked-uri": "data"}}`,
+			expected:    []Violation{{Time: now, Format: ReportFormatLegacy, DocumentURL: "https://example.com/", BlockedURL: "data", Directive: "img-src"}},
+		},
+		{
+			name:        "application/json batch without violations",
+			contentType: "application/json",
+			body:        ` [{"type": "intervention", "body": {}}]`,
+		},
+		{
+			name:        "missing document URL",
+			contentType: "application/csp-report",
+			body:        `{"csp-report": {"blocked-uri": "inline"}}`,
+			err:         "invalid report: missing csp-report.document-uri",
+		},
+		{
+			name:        "not a report",
+			contentType: "application/csp-report",
+			body:        `{"hello": "world"}`,
+			err:         "invalid report: missing csp-report.document-uri",
+		},
+		{
+			name:        "malformed batch",
+			contentType: "application/reports+json",
+			body:        `{"type": "csp-violation"}`,
+			err:         "invalid report batch: json: cannot unmarshal object into Go value of type []main.apiReport",
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        legacyReportBody,
+			err:         `unsupported content type "text/plain", expected application/csp-report or application/reports+json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := ParseReports(tt.contentType, []byte(tt.body), now)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != len(tt.expected) {
+				t.Fatalf("Expected %d violation(s), got %d: %+v", len(tt.expected), len(violations), violations)
+			}
+			for i := range violations {
+				if violations[i] != tt.expected[i] {
+					t.Errorf("Violation %d:\nexpected %+v\ngot      %+v", i, tt.expected[i], violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCollectHandler(t *testing.T) {
+	dir := t.TempDir()
+	handler := CollectHandler(&ViolationLog{Dir: dir, MaxBytes: 1 << 20, MaxFiles: 2}, 1024)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"legacy report", http.MethodPost, "application/csp-report", legacyReportBody, http.StatusNoContent},
+		{"reporting API batch", http.MethodPost, "application/reports+json", reportBatchBody, http.StatusNoContent},
+		{"preflight", http.MethodOptions, "", "", http.StatusNoContent},
+		{"get", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{"invalid report", http.MethodPost, "application/csp-report", "{", http.StatusBadRequest},
+		{"too large", http.MethodPost, "application/csp-report", `{"csp-report": {"script-sample": "` + strings.Repeat("a", 2000) + `"}}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/csp", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("User-Agent", "Agent/2.0")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	violations, err := ReadViolations(dir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 {
+		t.Fatalf("Expected 2 stored violations, got %d", len(violations))
+	}
+	if violations[0].UserAgent != "Agent/2.0" || violations[1].UserAgent != "Browser/1.0" {
+		t.Errorf("Expected the request user agent unless the report has one, got %q and %q", violations[0].UserAgent, violations[1].UserAgent)
+	}
+}
+
+func TestViolationLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	log := &ViolationLog{Dir: dir, MaxBytes: 500, MaxFiles: 2}
+
+	for i := range 8 {
+		v := Violation{Time: time.Unix(int64(i), 0).UTC(), DocumentURL: "https://example.com/", Directive: "script-src-elem", BlockedURL: strings.Repeat("x", 100)}
+		if err := log.Append([]Violation{v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"violations.jsonl", "violations.1.jsonl", "violations.2.jsonl"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected %s: %v", name, err)
+		}
+		if info.Size() > 500 {
+			t.Errorf("Expected %s to be rotated before exceeding 500 bytes, got %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "violations.3.jsonl")); err == nil {
+		t.Error("Expected at most 2 rotated files")
+	}
+
+	// Only the newest files remain, read oldest first
+	violations, err := ReadViolations(dir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 6 || violations[0].Time.Unix() != 2 || violations[5].Time.Unix() != 7 {
+		t.Errorf("Expected violations 2 to 7, got %+v", violations)
+	}
+}
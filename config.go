@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configFileName is the config file looked up in the working directory
+const configFileName = ".csprc.json"
+
+// envVarRegex matches ${NAME} and ${NAME:-default} references in config values
+var envVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// configAliases maps flags that set the same option to the name used in config files
+var configAliases = map[string]string{
+	"dry-run": "report",
+	"v":       "verbose",
+}
+
+// ConfigSettings are the settings of a config file or one of its profiles. String values
+// may reference environment variables as ${NAME} or ${NAME:-default}.
+type ConfigSettings struct {
+	Options       map[string]string   // flag values by flag name, e.g. "hash-algo": "sha384"
+	Modifications []CSPModification   // add/remove operations, applied before those of the flags
+	Template      map[string][]string // strict template directives to replace; nil sources remove one
+	Include       []string            // patterns of the files found in directories, see ScanOptions
+	Exclude       []string            // patterns of the files and directories left out of scans
+}
+
+// Config is a parsed config file
+type Config struct {
+	Path string
+	ConfigSettings
+	Profiles map[string]ConfigSettings
+}
+
+// FindConfig loads the config file at path, or .csprc.json in the working directory when
+// path is "". It returns nil without error when no path is given and there is no such file.
+func FindConfig(path string) (*Config, error) {
+	if path == "" {
+		if _, err := os.Stat(configFileName); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		path = configFileName
+	}
+	return LoadConfig(path)
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config.Path = path
+	return config, nil
+}
+
+// ParseConfig parses the content of a config file. Keys are flag names, plus
+// "modifications", "template", "include", "exclude" and "profiles".
+func ParseConfig(data []byte) (*Config, error) {
+	var raw map[string]json.RawMessage
+	if err := unmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+
+	config := &Config{Profiles: map[string]ConfigSettings{}}
+	if profiles, ok := raw["profiles"]; ok {
+		delete(raw, "profiles")
+		var rawProfiles map[string]map[string]json.RawMessage
+		if err := unmarshalStrict(profiles, &rawProfiles); err != nil {
+			return nil, fmt.Errorf("profiles: %w", err)
+		}
+		for name, rawProfile := range rawProfiles {
+			if _, nested := rawProfile["profiles"]; nested {
+				return nil, fmt.Errorf("profile %q: profiles cannot be nested", name)
+			}
+			settings, err := parseConfigSettings(rawProfile)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: %w", name, err)
+			}
+			config.Profiles[name] = settings
+		}
+	}
+
+	settings, err := parseConfigSettings(raw)
+	if err != nil {
+		return nil, err
+	}
+	config.ConfigSettings = settings
+	return config, nil
+}
+
+// parseConfigSettings converts the keys of a config object into settings
+func parseConfigSettings(raw map[string]json.RawMessage) (ConfigSettings, error) {
+	settings := ConfigSettings{Options: map[string]string{}}
+	fields := map[string]any{
+		"modifications": &settings.Modifications,
+		"template":      &settings.Template,
+		"include":       &settings.Include,
+		"exclude":       &settings.Exclude,
+	}
+
+	for key, value := range raw {
+		if field, ok := fields[key]; ok {
+			if err := unmarshalStrict(value, field); err != nil {
+				return settings, fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+
+		var option any
+		if err := json.Unmarshal(value, &option); err != nil {
+			return settings, fmt.Errorf("%s: %w", key, err)
+		}
+		switch option := option.(type) {
+		case string:
+			settings.Options[key] = option
+		case bool, float64:
+			settings.Options[key] = string(value)
+		default:
+			return settings, fmt.Errorf("%s: expected a string, boolean or number", key)
+		}
+	}
+	return settings, nil
+}
+
+// unmarshalStrict decodes JSON, rejecting unknown fields in structs
+func unmarshalStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// Resolve returns the settings of the config with a profile applied, or the top-level
+// settings when profile is "", with environment variables expanded. Profile options and
+// template directives override the top-level ones, profile includes replace them, and
+// profile modifications and excludes are appended.
+func (c *Config) Resolve(profile string) (ConfigSettings, error) {
+	settings := ConfigSettings{
+		Options:       map[string]string{},
+		Modifications: append([]CSPModification{}, c.Modifications...),
+		Template:      map[string][]string{},
+		Include:       c.Include,
+		Exclude:       append([]string{}, c.Exclude...),
+	}
+	for name, value := range c.Options {
+		settings.Options[name] = value
+	}
+	for name, sources := range c.Template {
+		settings.Template[name] = sources
+	}
+
+	if profile != "" {
+		overlay, ok := c.Profiles[profile]
+		if !ok {
+			return settings, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(c.ProfileNames(), ", "))
+		}
+		for name, value := range overlay.Options {
+			settings.Options[name] = value
+		}
+		for name, sources := range overlay.Template {
+			settings.Template[name] = sources
+		}
+		settings.Modifications = append(settings.Modifications, overlay.Modifications...)
+		if len(overlay.Include) > 0 {
+			settings.Include = overlay.Include
+		}
+		settings.Exclude = append(settings.Exclude, overlay.Exclude...)
+	}
+
+	if err := settings.expandEnv(); err != nil {
+		return settings, err
+	}
+	return settings, settings.check()
+}
+
+// ProfileNames returns the names of the config's profiles in sorted order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandEnv replaces environment variable references in every string of the settings
+func (cs *ConfigSettings) expandEnv() error {
+	var err error
+	expand := func(s *string) {
+		if err == nil {
+			*s, err = ExpandEnvVars(*s)
+		}
+	}
+
+	for name, value := range cs.Options {
+		expand(&value)
+		cs.Options[name] = value
+	}
+	for i := range cs.Modifications {
+		expand(&cs.Modifications[i].Directive)
+		expand(&cs.Modifications[i].Value)
+	}
+	for name, sources := range cs.Template {
+		if sources == nil {
+			continue
+		}
+		expanded := make([]string, len(sources))
+		for i := range sources {
+			expanded[i] = sources[i]
+			expand(&expanded[i])
+		}
+		cs.Template[name] = expanded
+	}
+	cs.Include = append([]string{}, cs.Include...)
+	for i := range cs.Include {
+		expand(&cs.Include[i])
+	}
+	for i := range cs.Exclude {
+		expand(&cs.Exclude[i])
+	}
+	return err
+}
+
+// check validates the modifications and template directives of resolved settings
+func (cs *ConfigSettings) check() error {
+	for i, mod := range cs.Modifications {
+		if err := CheckCSPModification(mod); err != nil {
+			return fmt.Errorf("modifications[%d]: %w", i, err)
+		}
+	}
+	for name := range cs.Template {
+		if _, known := LookupDirective(name); !known {
+			if suggestion := SuggestDirective(name); suggestion != "" {
+				return fmt.Errorf("template: unknown directive %q, did you mean %q?", name, suggestion)
+			}
+			return fmt.Errorf("template: unknown directive %q", name)
+		}
+	}
+	_, err := compilePathPatterns(append(append([]string{}, cs.Include...), cs.Exclude...))
+	return err
+}
+
+// ExpandEnvVars replaces ${NAME} and ${NAME:-default} with the value of the environment
+// variable. Unset variables without a default are an error, so that a missing value
+// cannot silently produce a broken source such as "https://".
+func ExpandEnvVars(s string) (string, error) {
+	var missing []string
+	expanded := envVarRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		match := envVarRegex.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return ref
+	})
+	if len(missing) > 0 {
+		return s, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// Apply sets the flags of fs that were not given on the command line to the values of
+// the settings' options
+func (cs ConfigSettings) Apply(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[configOptionName(f.Name)] = true
+	})
+
+	names := make([]string, 0, len(cs.Options))
+	for name := range cs.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch {
+		case name == "config" || name == "profile":
+			return fmt.Errorf("option %q can only be given on the command line", name)
+		case strings.HasPrefix(name, "add-") || strings.HasPrefix(name, "remove-"):
+			return fmt.Errorf("option %q: use \"modifications\" to list add and remove operations in order", name)
+		case fs.Lookup(name) == nil:
+			return fmt.Errorf("unknown option %q", name)
+		case explicit[configOptionName(name)]:
+			continue
+		}
+		if err := fs.Set(name, cs.Options[name]); err != nil {
+			return fmt.Errorf("option %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// configOptionName returns the name under which a flag is set in config files
+func configOptionName(name string) string {
+	if alias, ok := configAliases[name]; ok {
+		return alias
+	}
+	return name
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+  "csp": "default-src 'self' ${CDN_HOST}",
+  "hash-algo": "sha384",
+  "include-external": true,
+  "include": ["*.html"],
+  "exclude": ["vendor*.html"],
+  "template": {"img-src": ["'self'"], "upgrade-insecure-requests": null},
+  "modifications": [{"action": "add", "directive": "img-src", "value": "${CDN_HOST}"}],
+  "profiles": {
+    "dev": {
+      "include-external": false,
+      "template": {"img-src": ["*"]},
+      "modifications": [
+        {"action": "add", "directive": "connect-src", "value": "ws://localhost:5173"},
+        {"action": "add", "directive": "script-src", "value": "'unsafe-eval'"}
+      ]
+    },
+    "prod": {}
+  }
+}`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOptions := map[string]string{"csp": "default-src 'self' ${CDN_HOST}", "hash-algo": "sha384", "include-external": "true"}
+	if !reflect.DeepEqual(config.Options, expectedOptions) {
+		t.Errorf("Expected options %v, got %v", expectedOptions, config.Options)
+	}
+	if config.Template["upgrade-insecure-requests"] != nil || !reflect.DeepEqual(config.Template["img-src"], []string{"'self'"}) {
+		t.Errorf("Unexpected template %v", config.Template)
+	}
+	if got := config.ProfileNames(); !reflect.DeepEqual(got, []string{"dev", "prod"}) {
+		t.Errorf("Expected profiles dev and prod, got %v", got)
+	}
+	if len(config.Profiles["dev"].Modifications) != 2 {
+		t.Errorf("Expected 2 dev modifications, got %v", config.Profiles["dev"].Modifications)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errMsg string
+	}{
+		{"invalid JSON", `{"csp": }`, "invalid character"},
+		{"array option", `{"csp": ["a"]}`, "expected a string, boolean or number"},
+		{"unknown modification field", `{"modifications": [{"action": "add", "directive": "img-src", "source": "x"}]}`, `unknown field "source"`},
+		{"nested profiles", `{"profiles": {"a": {"profiles": {}}}}`, "cannot be nested"},
+		{"invalid profile option", `{"profiles": {"a": {"pretty": null}}}`, `profile "a": pretty`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	t.Setenv("CDN_HOST", "https://cdn.example.com")
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := config.Resolve("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Options["csp"] != "default-src 'self' https://cdn.example.com" {
+		t.Errorf("Expected CDN_HOST to be expanded, got %q", settings.Options["csp"])
+	}
+	if settings.Modifications[0].Value != "https://cdn.example.com" {
+		t.Errorf("Expected CDN_HOST to be expanded in modifications, got %v", settings.Modifications)
+	}
+
+	dev, err := config.Resolve("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Options["include-external"] != "false" || dev.Options["hash-algo"] != "sha384" {
+		t.Errorf("Expected profile options to override top-level ones, got %v", dev.Options)
+	}
+	if len(dev.Modifications) != 3 || dev.Modifications[2].Value != "'unsafe-eval'" {
+		t.Errorf("Expected profile modifications after top-level ones, got %v", dev.Modifications)
+	}
+	if !reflect.DeepEqual(dev.Template["img-src"], []string{"*"}) || len(dev.Template) != 2 {
+		t.Errorf("Expected profile template directives to override top-level ones, got %v", dev.Template)
+	}
+	if len(config.Modifications) != 1 || config.Options["include-external"] != "true" {
+		t.Error("Expected resolving a profile to leave the config unchanged")
+	}
+
+	if _, err := config.Resolve("staging"); err == nil || !strings.Contains(err.Error(), "available: dev, prod") {
+		t.Errorf("Expected an unknown profile error listing the profiles, got %v", err)
+	}
+}
+
+func TestConfigResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errMsg string
+	}{
+		{"unset variable", `{"csp": "default-src ${CSP_TEST_UNSET}"}`, "CSP_TEST_UNSET is not set"},
+		{"invalid modification", `{"modifications": [{"action": "add", "directive": "scirpt-src", "value": "x"}]}`, `modifications[0]: unknown directive "scirpt-src", did you mean "script-src"?`},
+		{"unknown template directive", `{"template": {"img-scr": ["'self'"]}}`, `template: unknown directive "img-scr"`},
+		{"invalid pattern", `{"exclude": ["[z-a]"]}`, `invalid pattern "[z-a]"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = config.Resolve("")
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("CSP_TEST_HOST", "cdn.example.com")
+	t.Setenv("CSP_TEST_EMPTY", "")
+
+	tests := []struct {
+		input    string
+		expected string
+		errMsg   string
+	}{
+		{"https://${CSP_TEST_HOST}/", "https://cdn.example.com/", ""},
+		{"${CSP_TEST_UNSET:-localhost:8080}", "localhost:8080", ""},
+		{"${CSP_TEST_EMPTY:-default}", "", ""},
+		{"$CSP_TEST_HOST {{CSP_NONCE}} 'self'", "$CSP_TEST_HOST {{CSP_NONCE}} 'self'", ""},
+		{"${CSP_TEST_UNSET} ${CSP_TEST_UNSET2}", "", "CSP_TEST_UNSET, CSP_TEST_UNSET2 is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ExpandEnvVars(tt.input)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("Expected %q, got %q (%v)", tt.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestConfigSettingsApply(t *testing.T) {
+	newFlagSet := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("csp", flag.ContinueOnError)
+		fs.String("csp", "", "")
+		fs.String("hash-algo", "sha256", "")
+		fs.Bool("pretty", false, "")
+		var report bool
+		fs.BoolVar(&report, "report", false, "")
+		fs.BoolVar(&report, "dry-run", false, "")
+		fs.String("config", "", "")
+		fs.Var(DirectiveModification("script-src", "add"), "add-script-src", "")
+		return fs
+	}
+
+	fs := newFlagSet()
+	if err := fs.Parse([]string{"--hash-algo", "sha512", "--dry-run"}); err != nil {
+		t.Fatal(err)
+	}
+	settings := ConfigSettings{Options: map[string]string{"csp": "default-src 'self'", "hash-algo": "sha384", "pretty": "true", "report": "false"}}
+	if err := settings.Apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"csp": "default-src 'self'", "hash-algo": "sha512", "pretty": "true", "report": "true"} {
+		if got := fs.Lookup(name).Value.String(); got != expected {
+			t.Errorf("Expected %s to be %q, got %q", name, expected, got)
+		}
+	}
+
+	tests := []struct {
+		option string
+		value  string
+		errMsg string
+	}{
+		{"verbos", "true", `unknown option "verbos"`},
+		{"config", "other.json", "only be given on the command line"},
+		{"add-script-src", "'self'", `use "modifications"`},
+		{"pretty", "yes", `option "pretty"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option, func(t *testing.T) {
+			err := ConfigSettings{Options: map[string]string{tt.option: tt.value}}.Apply(newFlagSet())
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	config, err := FindConfig("")
+	if config != nil || err != nil {
+		t.Errorf("Expected no config without %s, got %v, %v", configFileName, config, err)
+	}
+	if _, err := FindConfig("missing.json"); err == nil {
+		t.Error("Expected an error for a missing --config file")
+	}
+
+	if err := os.WriteFile(configFileName, []byte(`{"pretty": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = FindConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Path != configFileName || config.Options["pretty"] != "true" {
+		t.Errorf("Expected %s to be loaded, got %+v", configFileName, config)
+	}
+}
@@ -15,23 +15,23 @@ func TestUpdateCSP(t *testing.T) {
 	}
 }
 
-func TestParseCSPDirectives(t *testing.T) {
-	result := parseCSPDirectives("default-src 'self'; script-src 'unsafe-inline'")
-	if result["default-src"] != "'self'" {
-		t.Errorf("Expected default-src='self', got: %s", result["default-src"])
+func TestUpdateCSPPreservesOrder(t *testing.T) {
+	result, err := UpdateCSP("object-src 'none'; style-src 'self'; default-src 'self'", []string{"'sha256-test'"}, []string{"'sha256-style'"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if result["script-src"] != "'unsafe-inline'" {
-		t.Errorf("Expected script-src='unsafe-inline', got: %s", result["script-src"])
+	expected := "object-src 'none'; style-src 'self' 'sha256-style'; default-src 'self'; script-src 'sha256-test'"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
 	}
 }
 
-func TestReconstructCSP(t *testing.T) {
-	directives := map[string]string{
-		"default-src": "'self'",
-		"script-src":  "'unsafe-inline'",
+func TestUpdateCSPUnsafeHashesNotMatchedInsideOtherTokens(t *testing.T) {
+	result, err := UpdateCSP("script-src https://example.com/'unsafe-hashes'", []string{"'sha256-test'"}, nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
 	}
-	result := reconstructCSP(directives)
-	if !strings.Contains(result, "default-src 'self'") {
-		t.Errorf("Expected CSP to contain default-src 'self', got: %s", result)
+	if !strings.HasSuffix(result, " 'unsafe-hashes'") {
+		t.Errorf("Expected 'unsafe-hashes' to be added as its own source, got: %s", result)
 	}
 }
@@ -8,20 +8,20 @@ import (
 
 // ExternalResource represents an external resource found in HTML
 type ExternalResource struct {
-	Type   string // script, stylesheet, image, font, frame, etc.
-	URL    string
-	Domain string
+	Type   string `json:"type"` // script, stylesheet, image, font, frame, etc.
+	URL    string `json:"url"`
+	Domain string `json:"domain,omitempty"`
 }
 
 // ExternalResources contains all detected external resources
 type ExternalResources struct {
-	Scripts      []ExternalResource
-	Stylesheets  []ExternalResource
-	Images       []ExternalResource
-	Fonts        []ExternalResource
-	Frames       []ExternalResource
-	Other        []ExternalResource
-	UsesDataURLs map[string]bool // Tracks if data: URLs are used for each resource type ("image", "font", "style")
+	Scripts      []ExternalResource `json:"scripts"`
+	Stylesheets  []ExternalResource `json:"stylesheets"`
+	Images       []ExternalResource `json:"images"`
+	Fonts        []ExternalResource `json:"fonts"`
+	Frames       []ExternalResource `json:"frames"`
+	Other        []ExternalResource `json:"other"`
+	UsesDataURLs map[string]bool    `json:"data_urls"` // Tracks if data: URLs are used for each resource type ("image", "font", "style")
 }
 
 // GetUniqueDomains returns a sorted list of unique domains from all resources
@@ -121,132 +121,35 @@ func ExtractDomain(rawURL string) string {
 
 // AddExternalResourcesToCSP adds external resource domains to appropriate CSP directives
 func AddExternalResourcesToCSP(cspHeader string, resources *ExternalResources) string {
-	directives := parseCSPDirectives(cspHeader)
+	policy := ParsePolicy(cspHeader)
 
 	// Add data: to img-src if data URLs are used for images
 	if resources.UsesDataURLs != nil && resources.UsesDataURLs["image"] {
-		if existing, ok := directives["img-src"]; ok {
-			if !strings.Contains(existing, "data:") {
-				directives["img-src"] = appendUniqueDomainsToString(existing, []string{"data:"})
-			}
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["img-src"] = appendUniqueDomainsToString(defaultSrc, []string{"data:"})
-		} else {
-			directives["img-src"] = "data:"
-		}
+		policy.AddSources("img-src", "data:")
 	}
 
 	// Add data: to font-src if data URLs are used for fonts
 	if resources.UsesDataURLs != nil && resources.UsesDataURLs["font"] {
-		if existing, ok := directives["font-src"]; ok {
-			if !strings.Contains(existing, "data:") {
-				directives["font-src"] = appendUniqueDomainsToString(existing, []string{"data:"})
-			}
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["font-src"] = appendUniqueDomainsToString(defaultSrc, []string{"data:"})
-		} else {
-			directives["font-src"] = "data:"
-		}
+		policy.AddSources("font-src", "data:")
 	}
 
 	// Add script-src domains
-	scriptDomains := resources.GetDomainsByType("script")
-	if len(scriptDomains) > 0 {
-		if existing, ok := directives["script-src"]; ok {
-			directives["script-src"] = appendUniqueDomainsToString(existing, scriptDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			// Create script-src based on default-src
-			directives["script-src"] = appendUniqueDomainsToString(defaultSrc, scriptDomains)
-		} else {
-			directives["script-src"] = strings.Join(scriptDomains, " ")
-		}
-	}
+	policy.AddSources("script-src", resources.GetDomainsByType("script")...)
 
 	// Add style-src domains
-	styleDomains := resources.GetDomainsByType("stylesheet")
-	if len(styleDomains) > 0 {
-		if existing, ok := directives["style-src"]; ok {
-			directives["style-src"] = appendUniqueDomainsToString(existing, styleDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["style-src"] = appendUniqueDomainsToString(defaultSrc, styleDomains)
-		} else {
-			directives["style-src"] = strings.Join(styleDomains, " ")
-		}
-	}
+	policy.AddSources("style-src", resources.GetDomainsByType("stylesheet")...)
 
 	// Add img-src domains
-	imgDomains := resources.GetDomainsByType("image")
-	if len(imgDomains) > 0 {
-		if existing, ok := directives["img-src"]; ok {
-			directives["img-src"] = appendUniqueDomainsToString(existing, imgDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["img-src"] = appendUniqueDomainsToString(defaultSrc, imgDomains)
-		} else {
-			directives["img-src"] = strings.Join(imgDomains, " ")
-		}
-	}
+	policy.AddSources("img-src", resources.GetDomainsByType("image")...)
 
 	// Add font-src domains
-	fontDomains := resources.GetDomainsByType("font")
-	if len(fontDomains) > 0 {
-		if existing, ok := directives["font-src"]; ok {
-			directives["font-src"] = appendUniqueDomainsToString(existing, fontDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["font-src"] = appendUniqueDomainsToString(defaultSrc, fontDomains)
-		} else {
-			directives["font-src"] = strings.Join(fontDomains, " ")
-		}
-	}
+	policy.AddSources("font-src", resources.GetDomainsByType("font")...)
 
 	// Add frame-src domains
-	frameDomains := resources.GetDomainsByType("frame")
-	if len(frameDomains) > 0 {
-		if existing, ok := directives["frame-src"]; ok {
-			directives["frame-src"] = appendUniqueDomainsToString(existing, frameDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["frame-src"] = appendUniqueDomainsToString(defaultSrc, frameDomains)
-		} else {
-			directives["frame-src"] = strings.Join(frameDomains, " ")
-		}
-	}
+	policy.AddSources("frame-src", resources.GetDomainsByType("frame")...)
 
 	// Add connect-src domains (from "other" type)
-	connectDomains := resources.GetDomainsByType("other")
-	if len(connectDomains) > 0 {
-		if existing, ok := directives["connect-src"]; ok {
-			directives["connect-src"] = appendUniqueDomainsToString(existing, connectDomains)
-		} else if defaultSrc, ok := directives["default-src"]; ok {
-			directives["connect-src"] = appendUniqueDomainsToString(defaultSrc, connectDomains)
-		} else {
-			directives["connect-src"] = strings.Join(connectDomains, " ")
-		}
-	}
-
-	return reconstructCSP(directives)
-}
-
-// appendUniqueDomainsToString appends new domains to an existing space-separated string, removing duplicates
-func appendUniqueDomainsToString(existing string, newDomains []string) string {
-	seen := make(map[string]bool)
-	result := []string{}
-
-	// Add existing values
-	if existing != "" {
-		for _, val := range strings.Fields(existing) {
-			if !seen[val] {
-				seen[val] = true
-				result = append(result, val)
-			}
-		}
-	}
-
-	// Add new domains
-	for _, domain := range newDomains {
-		if !seen[domain] {
-			seen[domain] = true
-			result = append(result, domain)
-		}
-	}
+	policy.AddSources("connect-src", resources.GetDomainsByType("other")...)
 
-	return strings.Join(result, " ")
+	return policy.String()
 }
@@ -149,30 +149,6 @@ func TestAddExternalResourcesToCSP(t *testing.T) {
 	}
 }
 
-func TestAppendUniqueDomainsToString(t *testing.T) {
-	existing := "'self' https://example.com"
-	newDomains := []string{"https://cdn.example.com", "https://example.com"}
-
-	result := appendUniqueDomainsToString(existing, newDomains)
-
-	// Check that all values are present without duplicates
-	if !strings.Contains(result, "'self'") {
-		t.Error("Result should contain 'self'")
-	}
-	if !strings.Contains(result, "https://example.com") {
-		t.Error("Result should contain https://example.com")
-	}
-	if !strings.Contains(result, "https://cdn.example.com") {
-		t.Error("Result should contain https://cdn.example.com")
-	}
-
-	// Count occurrences of https://example.com (should be 1)
-	count := strings.Count(result, "https://example.com")
-	if count != 1 {
-		t.Errorf("https://example.com should appear exactly once, appeared %d times", count)
-	}
-}
-
 func TestAddExternalResourcesToCSPWithDataURLs(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -237,9 +213,8 @@ func TestAddExternalResourcesToCSPWithDataURLs(t *testing.T) {
 			if !tt.expectImgData && strings.Contains(result, "img-src") {
 				if strings.Contains(result, "img-src") && strings.Contains(result, "data:") {
 					// Check if data: is actually in img-src directive
-					directives := parseCSPDirectives(result)
-					if imgSrc, ok := directives["img-src"]; ok {
-						if strings.Contains(imgSrc, "data:") {
+					if imgSrc := ParsePolicy(result).Get("img-src"); imgSrc != nil {
+						if imgSrc.Has("data:") {
 							t.Errorf("img-src should not contain data: when not expected, got: %s", result)
 						}
 					}
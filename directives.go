@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+)
+
+// Directive categories
+const (
+	DirectiveCategoryFetch      = "fetch"
+	DirectiveCategoryDocument   = "document"
+	DirectiveCategoryNavigation = "navigation"
+	DirectiveCategoryReporting  = "reporting"
+	DirectiveCategoryOther      = "other"
+)
+
+// DirectiveInfo describes a known CSP directive
+type DirectiveInfo struct {
+	Name          string
+	Category      string // one of the DirectiveCategory* constants
+	SourceList    bool   // value is a source list ('self', hosts, hashes, ...)
+	NoValue       bool   // directive takes no value (e.g. upgrade-insecure-requests)
+	AllowedInMeta bool   // honoured when delivered via <meta http-equiv>
+	Deprecated    bool
+	Replacement   string // what to use instead of a deprecated directive
+}
+
+// knownDirectives is the registry of directives understood by browsers
+var knownDirectives = []DirectiveInfo{
+	{Name: "default-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "script-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "script-src-elem", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "script-src-attr", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "style-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "style-src-elem", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "style-src-attr", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "img-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "font-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "connect-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "manifest-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "worker-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "frame-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "fenced-frame-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "child-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "object-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "media-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true},
+	{Name: "prefetch-src", Category: DirectiveCategoryFetch, SourceList: true, AllowedInMeta: true, Deprecated: true,
+		Replacement: "Removed from CSP3 - prefetches are governed by the directive of the prefetched resource"},
+	{Name: "base-uri", Category: DirectiveCategoryDocument, SourceList: true, AllowedInMeta: true},
+	{Name: "sandbox", Category: DirectiveCategoryDocument},
+	{Name: "form-action", Category: DirectiveCategoryNavigation, SourceList: true, AllowedInMeta: true},
+	{Name: "frame-ancestors", Category: DirectiveCategoryNavigation, SourceList: true},
+	{Name: "navigate-to", Category: DirectiveCategoryNavigation, SourceList: true, AllowedInMeta: true, Deprecated: true,
+		Replacement: "Removed from CSP3 and never shipped by browsers"},
+	{Name: "report-to", Category: DirectiveCategoryReporting, AllowedInMeta: true},
+	{Name: "report-uri", Category: DirectiveCategoryReporting},
+	{Name: "require-trusted-types-for", Category: DirectiveCategoryOther, AllowedInMeta: true},
+	{Name: "trusted-types", Category: DirectiveCategoryOther, AllowedInMeta: true},
+	{Name: "upgrade-insecure-requests", Category: DirectiveCategoryOther, NoValue: true, AllowedInMeta: true},
+	{Name: "webrtc", Category: DirectiveCategoryOther, AllowedInMeta: true},
+	{Name: "block-all-mixed-content", Category: DirectiveCategoryOther, NoValue: true, AllowedInMeta: true, Deprecated: true,
+		Replacement: "Use 'upgrade-insecure-requests' instead, or handle via HTTPS"},
+	{Name: "plugin-types", Category: DirectiveCategoryDocument, AllowedInMeta: true, Deprecated: true,
+		Replacement: "Deprecated - plugins are no longer supported in modern browsers"},
+	{Name: "referrer", Category: DirectiveCategoryOther, AllowedInMeta: true, Deprecated: true,
+		Replacement: "Use the Referrer-Policy header instead"},
+}
+
+// LookupDirective returns the registry entry for a directive name
+func LookupDirective(name string) (DirectiveInfo, bool) {
+	name = strings.ToLower(name)
+	for _, info := range knownDirectives {
+		if info.Name == name {
+			return info, true
+		}
+	}
+	return DirectiveInfo{}, false
+}
+
+// SuggestDirective returns the known directive closest to a misspelt name, or ""
+// if none is close enough to be a plausible typo
+func SuggestDirective(name string) string {
+	name = strings.ToLower(name)
+
+	// Allow roughly one edit per four characters, at least one and at most three
+	maxDistance := len(name) / 4
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	if maxDistance > 3 {
+		maxDistance = 3
+	}
+
+	best := ""
+	bestDistance := maxDistance + 1
+	for _, info := range knownDirectives {
+		if d := editDistance(name, info.Name); d < bestDistance {
+			best = info.Name
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// editDistance computes the Damerau-Levenshtein (optimal string alignment) distance
+// between two strings, so that swapped letters such as "scirpt" count as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+		}
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return prev[len(rb)]
+}
+
+// isSourceListDirective reports whether a directive's value is a source list
+func isSourceListDirective(name string) bool {
+	info, ok := LookupDirective(name)
+	return ok && info.SourceList
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"csp/policy"
+)
+
+func TestLookupDirective(t *testing.T) {
+	info, ok := LookupDirective("Script-Src")
+	if !ok {
+		t.Fatal("Expected script-src to be known")
+	}
+	if info.Category != DirectiveCategoryFetch || !info.SourceList || !info.AllowedInMeta {
+		t.Errorf("Unexpected metadata for script-src: %+v", info)
+	}
+
+	info, ok = LookupDirective("frame-ancestors")
+	if !ok || info.AllowedInMeta {
+		t.Error("Expected frame-ancestors to be known and not allowed in <meta>")
+	}
+
+	info, ok = LookupDirective("upgrade-insecure-requests")
+	if !ok || !info.NoValue || info.SourceList {
+		t.Error("Expected upgrade-insecure-requests to take no value")
+	}
+
+	info, ok = LookupDirective("block-all-mixed-content")
+	if !ok || !info.Deprecated || info.Replacement == "" {
+		t.Error("Expected block-all-mixed-content to be deprecated with a replacement")
+	}
+
+	if _, ok := LookupDirective("scirpt-src"); ok {
+		t.Error("Expected scirpt-src to be unknown")
+	}
+}
+
+func TestSuggestDirective(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"scirpt-src", "script-src"},
+		{"frame-ancestor", "frame-ancestors"},
+		{"img-scr", "img-src"},
+		{"defualt-src", "default-src"},
+		{"style-src-attrs", "style-src-attr"},
+		{"Script-Scr", "script-src"},
+		{"foo", ""},
+		{"x-custom-directive", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := SuggestDirective(tt.name); result != tt.expected {
+				t.Errorf("SuggestDirective(%q) = %q, expected %q", tt.name, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"script-src", "script-src", 0},
+		{"scirpt-src", "script-src", 1},
+		{"img-src", "img-scr", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if result := editDistance(tt.a, tt.b); result != tt.expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", tt.a, tt.b, result, tt.expected)
+		}
+	}
+}
+
+func TestKnownDirectivesAreConsistent(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, info := range knownDirectives {
+		if seen[info.Name] {
+			t.Errorf("Directive %s is registered twice", info.Name)
+		}
+		seen[info.Name] = true
+
+		if info.SourceList && info.NoValue {
+			t.Errorf("Directive %s cannot both take a source list and no value", info.Name)
+		}
+		if info.Deprecated && info.Replacement == "" {
+			t.Errorf("Deprecated directive %s needs a replacement hint", info.Name)
+		}
+		if len(policy.Fallbacks(info.Name)) > 0 && info.Category != DirectiveCategoryFetch {
+			t.Errorf("Directive %s has a fallback chain but is not a fetch directive", info.Name)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cspHeaderName is the response header that enforces a policy
+const cspHeaderName = "Content-Security-Policy"
+
+// cspReportOnlyHeaderName is the response header that reports violations of a policy
+// without enforcing it
+const cspReportOnlyHeaderName = "Content-Security-Policy-Report-Only"
+
+// emitters generate the server or hosting configuration that sends the policies
+var emitters = map[string]func(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error){
+	"nginx":            emitNginx,
+	"apache":           emitApache,
+	"caddy":            emitCaddy,
+	"netlify":          emitHeadersFile,
+	"cloudflare-pages": emitHeadersFile,
+	"vercel":           emitVercel,
+	"firebase":         emitFirebase,
+	"k8s-ingress":      emitK8sIngress,
+}
+
+// EmitFormats returns the names of the --emit formats in sorted order
+func EmitFormats() []string {
+	formats := make([]string, 0, len(emitters))
+	for format := range emitters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// emitRoute is a manifest entry: an exact URL path, or every path below a directory
+type emitRoute struct {
+	Path   string // URL path; for a directory, its path with a trailing slash
+	Prefix bool   // the entry is a "/dir/*" pattern
+	Policy string
+}
+
+// Emit returns the configuration sending the manifest's policies in the given header for
+// a server or hosting format, with the fixed headers on every path. Without per-page
+// policies, the default policy applies to every path.
+func Emit(format, header string, fixed []HeaderField, manifest *Manifest) (string, error) {
+	emitter, ok := emitters[format]
+	if !ok {
+		return "", fmt.Errorf("unknown format %q, must be one of %s", format, strings.Join(EmitFormats(), ", "))
+	}
+	defaultPolicy, routes := emitRoutes(manifest)
+	return emitter(header, fixed, defaultPolicy, routes)
+}
+
+// emitRoutes returns the default policy and the routes of a manifest from the most
+// general to the most specific: directories by depth, then exact paths. A "/*" entry
+// covering the whole site replaces the default policy.
+func emitRoutes(manifest *Manifest) (string, []emitRoute) {
+	defaultPolicy := manifest.Default
+	var routes []emitRoute
+	for urlPath, policy := range manifest.Policies {
+		switch {
+		case urlPath == "/*":
+			defaultPolicy = policy
+		case strings.HasSuffix(urlPath, "/*"):
+			routes = append(routes, emitRoute{Path: strings.TrimSuffix(urlPath, "*"), Prefix: true, Policy: policy})
+		default:
+			routes = append(routes, emitRoute{Path: urlPath, Policy: policy})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Prefix != routes[j].Prefix {
+			return routes[i].Prefix
+		}
+		if len(routes[i].Path) != len(routes[j].Path) {
+			return len(routes[i].Path) < len(routes[j].Path)
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return defaultPolicy, routes
+}
+
+// quoteDoubled wraps a value in double quotes for nginx, escaping backslashes and double quotes
+func quoteDoubled(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// quoteArgument wraps a value in double quotes for Apache and Caddy, which only treat a
+// backslash before a double quote as an escape
+func quoteArgument(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// emitNginx generates add_header directives for a server block, with an exact or prefix
+// location block per route. Locations with add_header do not inherit the server's one.
+// Directory paths are served by an internal redirect to index.html, whose location sets
+// the headers, so index pages get a block for both URLs. Each block repeats the fixed
+// headers for the same reason.
+func emitNginx(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	var buf strings.Builder
+	addHeaders := func(indent, policy string) {
+		fmt.Fprintf(&buf, "%sadd_header %s %s always;\n", indent, header, quoteDoubled(policy))
+		for _, field := range fixed {
+			fmt.Fprintf(&buf, "%sadd_header %s %s always;\n", indent, field.Name, quoteDoubled(field.Value))
+		}
+	}
+	addHeaders("", defaultPolicy)
+	location := func(modifier, path, policy string) {
+		fmt.Fprintf(&buf, "\nlocation %s %s {\n", modifier, nginxPath(path))
+		addHeaders("    ", policy)
+		buf.WriteString("}\n")
+	}
+	for _, route := range routes {
+		switch {
+		case route.Prefix:
+			location("^~", route.Path, route.Policy)
+		case strings.HasSuffix(route.Path, "/"):
+			location("=", route.Path, route.Policy)
+			location("=", route.Path+"index.html", route.Policy)
+		default:
+			location("=", route.Path, route.Policy)
+		}
+	}
+	return buf.String(), nil
+}
+
+// nginxPath quotes a location path that contains spaces or special characters
+func nginxPath(urlPath string) string {
+	if strings.ContainsAny(urlPath, " \t\"';{}\\") {
+		return quoteDoubled(urlPath)
+	}
+	return urlPath
+}
+
+// emitApache generates Header directives, with a LocationMatch section per route. Later
+// sections override earlier ones, so the routes go from general to specific. Directory
+// paths also match their index page, to which mod_dir redirects internally. The fixed
+// headers are set once for every path.
+func emitApache(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	// Header values may contain format specifiers, so literal percent signs are doubled
+	value := func(policy string) string {
+		return quoteArgument(strings.ReplaceAll(policy, "%", "%%"))
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "Header always set %s %s\n", header, value(defaultPolicy))
+	for _, field := range fixed {
+		fmt.Fprintf(&buf, "Header always set %s %s\n", field.Name, value(field.Value))
+	}
+	for _, route := range routes {
+		pattern := "^" + regexp.QuoteMeta(route.Path)
+		switch {
+		case route.Prefix:
+		case strings.HasSuffix(route.Path, "/"):
+			pattern += `(index\.html?)?$`
+		default:
+			pattern += "$"
+		}
+		fmt.Fprintf(&buf, "\n<LocationMatch %s>\n    Header always set %s %s\n</LocationMatch>\n", quoteArgument(pattern), header, value(route.Policy))
+	}
+	return buf.String(), nil
+}
+
+// emitCaddy generates header directives for a site block, with a path matcher per route.
+// The default is set with "?" so that it only applies where no route has set the header.
+// The fixed headers are set once for every path.
+func emitCaddy(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	var buf strings.Builder
+	if len(routes) == 0 {
+		fmt.Fprintf(&buf, "header %s %s\n", header, quoteArgument(defaultPolicy))
+	} else {
+		fmt.Fprintf(&buf, "header ?%s %s\n", header, quoteArgument(defaultPolicy))
+	}
+	for _, field := range fixed {
+		fmt.Fprintf(&buf, "header %s %s\n", field.Name, quoteArgument(field.Value))
+	}
+	if len(routes) == 0 {
+		return buf.String(), nil
+	}
+
+	for i, route := range routes {
+		matcher := route.Path
+		if route.Prefix {
+			matcher += "*"
+		}
+		fmt.Fprintf(&buf, "\n@csp%d path %s\nheader @csp%d %s %s\n", i, quoteArgument(matcher), i, header, quoteArgument(route.Policy))
+	}
+	return buf.String(), nil
+}
+
+// emitHeadersFile generates a _headers file for Netlify and Cloudflare Pages, with a "/*"
+// block for the default policy and the fixed headers and a block per route. Both combine
+// the values of every rule matching a path, so a route's page is held to its own policy
+// and the default one, which can only restrict it further.
+func emitHeadersFile(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	var buf strings.Builder
+	block := func(path, policy string) {
+		fmt.Fprintf(&buf, "%s\n  %s: %s\n", path, header, policy)
+	}
+
+	block("/*", defaultPolicy)
+	for _, field := range fixed {
+		fmt.Fprintf(&buf, "  %s: %s\n", field.Name, field.Value)
+	}
+	for _, route := range routes {
+		path := route.Path
+		if route.Prefix {
+			path += "*"
+		}
+		buf.WriteString("\n")
+		block(path, route.Policy)
+	}
+	return buf.String(), nil
+}
+
+// jsonHeader is a header entry of vercel.json and firebase.json
+type jsonHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// jsonHeaderRule applies headers to the paths matching source
+type jsonHeaderRule struct {
+	Source  string       `json:"source"`
+	Headers []jsonHeader `json:"headers"`
+}
+
+// vercelPathEscaper escapes the characters of a URL path that path-to-regexp treats specially
+var vercelPathEscaper = strings.NewReplacer(":", `\:`, "(", `\(`, ")", `\)`, "*", `\*`, "?", `\?`, "+", `\+`, "{", `\{`, "}", `\}`)
+
+// emitVercel generates the headers section of vercel.json. For a header set by several
+// matching rules, the last one applies, so the routes go from general to specific. The
+// fixed headers are only set by the rule matching every path.
+func emitVercel(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	rules := []jsonHeaderRule{{Source: "/(.*)", Headers: jsonHeaders(header, fixed, defaultPolicy)}}
+	for _, route := range routes {
+		source := vercelPathEscaper.Replace(route.Path)
+		if route.Prefix {
+			source += "(.*)"
+		}
+		rules = append(rules, jsonHeaderRule{Source: source, Headers: []jsonHeader{{Key: header, Value: route.Policy}}})
+	}
+	return marshalIndent(map[string]any{"headers": rules})
+}
+
+// emitFirebase generates the hosting headers section of firebase.json, with glob sources
+// from general to specific. The fixed headers are only set by the rule matching every path.
+func emitFirebase(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	rules := []jsonHeaderRule{{Source: "**", Headers: jsonHeaders(header, fixed, defaultPolicy)}}
+	for _, route := range routes {
+		source := route.Path
+		if route.Prefix {
+			source += "**"
+		}
+		rules = append(rules, jsonHeaderRule{Source: source, Headers: []jsonHeader{{Key: header, Value: route.Policy}}})
+	}
+	return marshalIndent(map[string]any{"hosting": map[string]any{"headers": rules}})
+}
+
+// jsonHeaders returns the policy header followed by the fixed headers
+func jsonHeaders(header string, fixed []HeaderField, policy string) []jsonHeader {
+	headers := []jsonHeader{{Key: header, Value: policy}}
+	for _, field := range fixed {
+		headers = append(headers, jsonHeader{Key: field.Name, Value: field.Value})
+	}
+	return headers
+}
+
+// marshalIndent encodes a JSON configuration without escaping HTML characters
+func marshalIndent(v any) (string, error) {
+	var buf strings.Builder
+	if err := WriteJSON(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// emitK8sIngress generates the metadata annotations of an ingress-nginx Ingress. The
+// configuration snippet selects the route's policy from the request URI, as one Ingress
+// cannot have location blocks per path.
+func emitK8sIngress(header string, fixed []HeaderField, defaultPolicy string, routes []emitRoute) (string, error) {
+	var snippet strings.Builder
+	if len(routes) == 0 {
+		fmt.Fprintf(&snippet, "more_set_headers %s;\n", quoteDoubled(header+": "+defaultPolicy))
+	} else {
+		fmt.Fprintf(&snippet, "set $csp_policy %s;\n", quoteDoubled(defaultPolicy))
+		for _, route := range routes {
+			condition := fmt.Sprintf("$uri = %s", quoteDoubled(route.Path))
+			if route.Prefix {
+				condition = fmt.Sprintf("$uri ~ %s", quoteDoubled("^"+regexp.QuoteMeta(route.Path)))
+			}
+			fmt.Fprintf(&snippet, "if (%s) {\n  set $csp_policy %s;\n}\n", condition, quoteDoubled(route.Policy))
+		}
+		fmt.Fprintf(&snippet, "more_set_headers %s;\n", quoteDoubled(header+": $csp_policy"))
+	}
+	for _, field := range fixed {
+		fmt.Fprintf(&snippet, "more_set_headers %s;\n", quoteDoubled(field.Name+": "+field.Value))
+	}
+
+	var buf strings.Builder
+	buf.WriteString("metadata:\n  annotations:\n    nginx.ingress.kubernetes.io/configuration-snippet: |\n")
+	for _, line := range strings.Split(strings.TrimSuffix(snippet.String(), "\n"), "\n") {
+		buf.WriteString("      " + line + "\n")
+	}
+	return buf.String(), nil
+}
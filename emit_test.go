@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEmitSinglePolicy(t *testing.T) {
+	policy := "default-src 'self'; script-src 'sha256-abc='"
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"nginx", `add_header Content-Security-Policy "default-src 'self'; script-src 'sha256-abc='" always;` + "\n"},
+		{"apache", `Header always set Content-Security-Policy "default-src 'self'; script-src 'sha256-abc='"` + "\n"},
+		{"caddy", `header Content-Security-Policy "default-src 'self'; script-src 'sha256-abc='"` + "\n"},
+		{"netlify", "/*\n  Content-Security-Policy: default-src 'self'; script-src 'sha256-abc='\n"},
+		{"cloudflare-pages", "/*\n  Content-Security-Policy: default-src 'self'; script-src 'sha256-abc='\n"},
+		{"k8s-ingress", "metadata:\n  annotations:\n    nginx.ingress.kubernetes.io/configuration-snippet: |\n" +
+			`      more_set_headers "Content-Security-Policy: default-src 'self'; script-src 'sha256-abc='";` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Emit(tt.format, cspHeaderName, nil, NewManifest(policy, nil, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEmitJSONFormats(t *testing.T) {
+	manifest := NewManifest("default-src 'self'", map[string]string{
+		"/":          "default-src 'self'; script-src 'sha256-a='",
+		"/docs/*":    "default-src 'self'; img-src *",
+		"/a:b+c.htm": "default-src 'none'",
+	}, false)
+
+	tests := []struct {
+		format  string
+		sources []string
+	}{
+		{"vercel", []string{"/(.*)", "/docs/(.*)", "/", `/a\:b\+c.htm`}},
+		{"firebase", []string{"**", "/docs/**", "/", "/a:b+c.htm"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Emit(tt.format, cspHeaderName, nil, manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Headers []jsonHeaderRule `json:"headers"`
+				Hosting struct {
+					Headers []jsonHeaderRule `json:"headers"`
+				} `json:"hosting"`
+			}
+			if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+				t.Fatalf("Expected valid JSON, got %v:\n%s", err, got)
+			}
+			rules := append(decoded.Headers, decoded.Hosting.Headers...)
+			if len(rules) != len(tt.sources) {
+				t.Fatalf("Expected %d rules, got %d:\n%s", len(tt.sources), len(rules), got)
+			}
+			for i, source := range tt.sources {
+				if rules[i].Source != source {
+					t.Errorf("Expected rule %d to match %q, got %q", i, source, rules[i].Source)
+				}
+			}
+			if rules[1].Headers[0].Value != "default-src 'self'; img-src *" {
+				t.Errorf("Expected the /docs/ policy in the second rule, got %+v", rules[1])
+			}
+		})
+	}
+}
+
+func TestEmitRoutes(t *testing.T) {
+	manifest := NewManifest("default-src 'self'; script-src 'sha256-a=' 'sha256-b='", map[string]string{
+		"/":           "default-src 'self'; script-src 'sha256-a='",
+		"/admin/*":    "default-src 'self'; script-src 'sha256-b='",
+		"/about.html": "default-src 'self'",
+	}, false)
+
+	tests := []struct {
+		format string
+		want   []string // in order
+		absent []string
+	}{
+		{"nginx", []string{
+			`add_header Content-Security-Policy "default-src 'self'; script-src 'sha256-a=' 'sha256-b='" always;`,
+			"location ^~ /admin/ {\n    add_header Content-Security-Policy \"default-src 'self'; script-src 'sha256-b='\" always;\n}",
+			"location = / {",
+			"location = /index.html {",
+			"location = /about.html {\n    add_header Content-Security-Policy \"default-src 'self'\" always;\n}",
+		}, nil},
+		{"apache", []string{
+			`Header always set Content-Security-Policy "default-src 'self'; script-src 'sha256-a=' 'sha256-b='"`,
+			`<LocationMatch "^/admin/">`,
+			`<LocationMatch "^/(index\.html?)?$">`,
+			`<LocationMatch "^/about\.html$">`,
+		}, nil},
+		{"caddy", []string{
+			`header ?Content-Security-Policy "default-src 'self'; script-src 'sha256-a=' 'sha256-b='"`,
+			"@csp0 path \"/admin/*\"\nheader @csp0 Content-Security-Policy \"default-src 'self'; script-src 'sha256-b='\"",
+			`@csp1 path "/"`,
+			`@csp2 path "/about.html"`,
+		}, nil},
+		{"netlify", []string{
+			"/*\n  Content-Security-Policy: default-src 'self'; script-src 'sha256-a=' 'sha256-b='\n",
+			"\n/admin/*\n  Content-Security-Policy: default-src 'self'; script-src 'sha256-b='\n",
+			"\n/\n  Content-Security-Policy: default-src 'self'; script-src 'sha256-a='\n",
+			"\n/about.html\n  Content-Security-Policy: default-src 'self'\n",
+		}, nil},
+		{"k8s-ingress", []string{
+			`      set $csp_policy "default-src 'self'; script-src 'sha256-a=' 'sha256-b='";`,
+			"      if ($uri ~ \"^/admin/\") {\n        set $csp_policy \"default-src 'self'; script-src 'sha256-b='\";\n      }",
+			`      if ($uri = "/") {`,
+			`      if ($uri = "/about.html") {`,
+			`      more_set_headers "Content-Security-Policy: $csp_policy";`,
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Emit(tt.format, cspHeaderName, nil, manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest := got
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("Expected %q after the previous blocks in:\n%s", want, got)
+				}
+				rest = rest[i+len(want):]
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(got, absent) {
+					t.Errorf("Expected no %q in:\n%s", absent, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEmitFixedHeaders(t *testing.T) {
+	fixed := []HeaderField{
+		{Name: "Content-Security-Policy", Value: "default-src 'self'"},
+		{Name: "Reporting-Endpoints", Value: `csp="https://csp.example.com/r"`},
+	}
+	manifest := NewManifest("default-src 'none'; report-to csp", map[string]string{
+		"/admin/*": "default-src 'none'; script-src 'sha256-b='; report-to csp",
+	}, false)
+
+	tests := []struct {
+		format string
+		want   []string // in order
+	}{
+		{"nginx", []string{
+			"add_header Content-Security-Policy-Report-Only \"default-src 'none'; report-to csp\" always;\n" +
+				"add_header Content-Security-Policy \"default-src 'self'\" always;\n" +
+				"add_header Reporting-Endpoints \"csp=\\\"https://csp.example.com/r\\\"\" always;\n",
+			"location ^~ /admin/ {\n    add_header Content-Security-Policy-Report-Only \"default-src 'none'; script-src 'sha256-b='; report-to csp\" always;\n" +
+				"    add_header Content-Security-Policy \"default-src 'self'\" always;\n",
+		}},
+		{"apache", []string{
+			`Header always set Content-Security-Policy "default-src 'self'"`,
+			`Header always set Reporting-Endpoints "csp=\"https://csp.example.com/r\""`,
+			"<LocationMatch \"^/admin/\">\n    Header always set Content-Security-Policy-Report-Only \"default-src 'none'; script-src 'sha256-b='; report-to csp\"\n</LocationMatch>",
+		}},
+		{"caddy", []string{
+			`header ?Content-Security-Policy-Report-Only "default-src 'none'; report-to csp"`,
+			`header Content-Security-Policy "default-src 'self'"`,
+			`header Reporting-Endpoints "csp=\"https://csp.example.com/r\""`,
+			`@csp0 path "/admin/*"`,
+		}},
+		{"netlify", []string{
+			"/*\n  Content-Security-Policy-Report-Only: default-src 'none'; report-to csp\n" +
+				"  Content-Security-Policy: default-src 'self'\n  Reporting-Endpoints: csp=\"https://csp.example.com/r\"\n",
+			"\n/admin/*\n  Content-Security-Policy-Report-Only: default-src 'none'; script-src 'sha256-b='; report-to csp\n",
+		}},
+		{"vercel", []string{
+			`"key": "Content-Security-Policy-Report-Only"`,
+			`"key": "Content-Security-Policy",`,
+			`"key": "Reporting-Endpoints"`,
+			`"source": "/admin/(.*)"`,
+		}},
+		{"k8s-ingress", []string{
+			`      more_set_headers "Content-Security-Policy-Report-Only: $csp_policy";`,
+			`      more_set_headers "Content-Security-Policy: default-src 'self'";`,
+			`      more_set_headers "Reporting-Endpoints: csp=\"https://csp.example.com/r\"";`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Emit(tt.format, cspReportOnlyHeaderName, fixed, manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest := got
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("Expected %q after the previous blocks in:\n%s", want, got)
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
+
+func TestEmitWholeSiteRoute(t *testing.T) {
+	manifest := NewManifest("default-src 'self'; img-src *", map[string]string{"/*": "default-src 'self'"}, false)
+	got, err := Emit("nginx", cspHeaderName, nil, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "add_header Content-Security-Policy \"default-src 'self'\" always;\n" {
+		t.Errorf("Expected the /* entry to replace the default policy, got:\n%s", got)
+	}
+}
+
+func TestEmitEscaping(t *testing.T) {
+	policy := `default-src 'self'; report-uri https://example.com/r?a=50%25&b="x\y"`
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"nginx", `"default-src 'self'; report-uri https://example.com/r?a=50%25&b=\"x\\y\"" always;`},
+		{"apache", `"default-src 'self'; report-uri https://example.com/r?a=50%%25&b=\"x\y\""`},
+		{"caddy", `"default-src 'self'; report-uri https://example.com/r?a=50%25&b=\"x\y\""`},
+		{"vercel", `"value": "default-src 'self'; report-uri https://example.com/r?a=50%25&b=\"x\\y\""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Emit(tt.format, cspHeaderName, nil, NewManifest(policy, nil, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Expected %s in:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEmitUnknownFormat(t *testing.T) {
+	_, err := Emit("iis", cspHeaderName, nil, NewManifest("default-src 'self'", nil, false))
+	if err == nil || !strings.Contains(err.Error(), "apache, caddy, cloudflare-pages") {
+		t.Errorf("Expected an error listing the formats, got %v", err)
+	}
+}
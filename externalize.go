@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// assetHashLength is the number of hex digits of the content hash used in asset names
+const assetHashLength = 16
+
+// javaScriptTypes are the <script type> values that are executed as classic or module
+// scripts. Import maps and speculation rules are inline-only; other types are data
+// blocks (JSON-LD, templates) that are never executed, so CSP does not apply to them.
+var javaScriptTypes = map[string]bool{
+	"":                       true,
+	"module":                 true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"text/ecmascript":        true,
+	"application/ecmascript": true,
+}
+
+// inlineOnlyScriptTypes are executable script types that cannot be loaded with src
+var inlineOnlyScriptTypes = map[string]bool{
+	"importmap":        true,
+	"speculationrules": true,
+}
+
+var (
+	// relativeImportRegex matches static and dynamic imports of relative module specifiers
+	relativeImportRegex = regexp.MustCompile(`(?:\bfrom|\bimport)\s*\(?\s*["']\.{1,2}/`)
+	// relativeCSSURLRegex captures the URL of url() and @import references
+	relativeCSSURLRegex = regexp.MustCompile(`(?i)(?:url\(\s*["']?|@import\s+["'])([^"')\s]*)`)
+)
+
+// ExternalizeOptions selects the inline elements moved to external files
+type ExternalizeOptions struct {
+	Scripts   bool
+	Styles    bool
+	AssetsDir string // directory the files are written to
+	Nonce     string // nonce for the generated <script src> elements (with 'strict-dynamic'), "" for none
+}
+
+// InlineAsset is the content of an inline element moved to an external file
+type InlineAsset struct {
+	Name    string // content-addressed file name, e.g. inline-3f2a….js
+	Type    string // ContentTypeScript or ContentTypeStyleTag
+	Content string
+}
+
+// SkippedInline is an inline element that was left in place, with the reason
+type SkippedInline struct {
+	Type   string
+	Line   int
+	Column int
+	Reason string
+}
+
+// inlineKey identifies an inline item by the start tag of its element and its content, so
+// that an item removed from one element is not confused with the same content left elsewhere
+type inlineKey struct {
+	Line, Column int
+	Content      string
+}
+
+// ExternalizeResult describes how the inline elements of one page were externalized
+type ExternalizeResult struct {
+	Elements int // number of elements replaced
+	Assets   []InlineAsset
+	Skipped  []SkippedInline
+}
+
+// Contents returns the set of inline contents moved to external files
+func (er *ExternalizeResult) Contents() map[string]bool {
+	contents := map[string]bool{}
+	for _, asset := range er.Assets {
+		contents[asset.Content] = true
+	}
+	return contents
+}
+
+// Externalize replaces the inline <script> and <style> elements of a page with references
+// to content-addressed files in opts.AssetsDir, for a copy of the page written to outPath.
+// The assets are returned for WriteAssets.
+func Externalize(page *Page, outPath string, opts ExternalizeOptions) (*ExternalizeResult, error) {
+	assetsURL, err := filepath.Rel(filepath.Dir(outPath), opts.AssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	return externalize(page, filepath.ToSlash(assetsURL), opts), nil
+}
+
+// externalize replaces each selected inline element with a reference to its asset in assetsURL
+func externalize(page *Page, assetsURL string, opts ExternalizeOptions) *ExternalizeResult {
+	result := &ExternalizeResult{}
+
+	for _, tag := range page.Tags {
+		switch {
+		case tag.Name == "script" && opts.Scripts && !hasSourceAttr(tag, "src") && !isDataBlock(tag):
+		case tag.Name == "style" && opts.Styles:
+		default:
+			continue
+		}
+
+		content := normalizeNewlines(string(page.Source[tag.ContentStart:tag.ContentEnd]))
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+
+		asset := InlineAsset{Name: assetName(content, tag.Name), Type: ContentTypeScript, Content: content}
+		if tag.Name == "style" {
+			asset.Type = ContentTypeStyleTag
+		}
+		if reason := externalizeProblem(tag, content); reason != "" {
+			result.Skipped = append(result.Skipped, SkippedInline{Type: asset.Type, Line: tag.Line, Column: tag.Column, Reason: reason})
+			continue
+		}
+
+		url := asset.Name
+		if assetsURL != "" && assetsURL != "." {
+			url = assetsURL + "/" + asset.Name
+		}
+
+		var edit htmlEdit
+		if tag.Name == "script" {
+			var attrs []html.Attribute
+			for _, attr := range tag.Attrs {
+				if opts.Nonce == "" || attr.Key != "nonce" {
+					attrs = append(attrs, attr)
+				}
+			}
+			attrs = append(attrs, html.Attribute{Key: "src", Val: url})
+			if opts.Nonce != "" {
+				attrs = append(attrs, html.Attribute{Key: "nonce", Val: opts.Nonce})
+			}
+			edit = rebuildTag(tag, attrs)
+			edit.End = tag.ContentEnd // keep the closing </script>
+		} else {
+			attrs := []html.Attribute{{Key: "rel", Val: "stylesheet"}, {Key: "href", Val: url}}
+			for _, attr := range tag.Attrs {
+				if attr.Key != "type" {
+					attrs = append(attrs, attr)
+				}
+			}
+			edit = rebuildTag(&sourceTag{Name: "link", Start: tag.Start}, attrs)
+			edit.End = endTagEnd(page.Source, tag.ContentEnd)
+		}
+
+		page.Replace(edit)
+		result.Elements++
+		if !containsAsset(result.Assets, asset.Name) {
+			result.Assets = append(result.Assets, asset)
+		}
+	}
+
+	return result
+}
+
+// externalizeProblem returns why an element cannot move to an external file, or ""
+func externalizeProblem(tag *sourceTag, content string) string {
+	if tag.Name == "script" {
+		scriptType := strings.ToLower(strings.TrimSpace(getSourceAttr(tag, "type")))
+		if inlineOnlyScriptTypes[scriptType] {
+			return fmt.Sprintf("scripts of type %q cannot be loaded from an external file", scriptType)
+		}
+		if scriptType == "module" && relativeImportRegex.MatchString(content) {
+			return "relative module imports would resolve against the asset's URL instead of the page's"
+		}
+		return ""
+	}
+
+	for _, match := range relativeCSSURLRegex.FindAllStringSubmatch(content, -1) {
+		if isRelativeURL(match[1]) {
+			return fmt.Sprintf("relative URL %q would resolve against the stylesheet's URL instead of the page's", match[1])
+		}
+	}
+	return ""
+}
+
+// normalizeNewlines converts CRLF and CR line breaks to LF, as the HTML parser does with
+// the content of inline elements, so that assets match the parsed items they replace
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+// isDataBlock reports whether a <script> element is a data block that is never executed
+func isDataBlock(tag *sourceTag) bool {
+	scriptType := strings.ToLower(strings.TrimSpace(getSourceAttr(tag, "type")))
+	return !javaScriptTypes[scriptType] && !inlineOnlyScriptTypes[scriptType]
+}
+
+// isRelativeURL reports whether a URL is resolved relative to the document it appears in
+func isRelativeURL(url string) bool {
+	if url == "" || strings.HasPrefix(url, "/") || strings.HasPrefix(url, "#") {
+		return false
+	}
+	colon := strings.Index(url, ":")
+	return colon < 0 || strings.ContainsAny(url[:colon], "/?#")
+}
+
+// assetName returns the content-addressed file name of an inline script or style
+func assetName(content, element string) string {
+	ext := ".js"
+	if element == "style" {
+		ext = ".css"
+	}
+	return "inline-" + contentHash(content) + ext
+}
+
+// endTagEnd returns the offset just past the end tag that closes raw text ending at offset
+func endTagEnd(source []byte, offset int) int {
+	if i := bytes.IndexByte(source[offset:], '>'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(source)
+}
+
+// containsAsset reports whether an asset with the name is already listed
+func containsAsset(assets []InlineAsset, name string) bool {
+	for _, asset := range assets {
+		if asset.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteAssets writes assets into dir. Identical content always maps to the same file,
+// so blocks shared by several pages are written once.
+func WriteAssets(dir string, assets []InlineAsset) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create assets directory: %w", err)
+	}
+	for _, asset := range assets {
+		path := filepath.Join(dir, asset.Name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(asset.Content), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// AllowSelfForAssets adds 'self' to the directives governing <script src> and
+// <link rel=stylesheet> elements, so that externalized assets served from the page's
+// origin load. A default-src fallback is copied into a new script-src or style-src.
+func AllowSelfForAssets(cspHeader string, scripts, styles bool) string {
+	policy := ParsePolicy(cspHeader)
+
+	allow := func(elemDirective, directive string) {
+		d := policy.Effective(elemDirective)
+		if d == nil || d.Has("'self'") {
+			return
+		}
+		if d.Name == "default-src" {
+			policy.Ensure(directive).Add(d.Values()...)
+			d = policy.Get(directive)
+		}
+		d.Add("'self'")
+	}
+
+	if scripts {
+		allow("script-src-elem", "script-src")
+	}
+	if styles {
+		allow("style-src-elem", "style-src")
+	}
+	return policy.String()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExternalize(t *testing.T) {
+	js := assetName("run()", "script")
+	css := assetName("p{}", "style")
+
+	tests := []struct {
+		name     string
+		source   string
+		opts     ExternalizeOptions
+		expected string
+		assets   int
+		skipped  int
+	}{
+		{
+			name:     "script keeps its attributes",
+			source:   `<script type="module" defer>run()</script>`,
+			opts:     ExternalizeOptions{Scripts: true},
+			expected: `<script type="module" defer src="assets/` + js + `"></script>`,
+			assets:   1,
+		},
+		{
+			name:     "style becomes a stylesheet link",
+			source:   `<style type="text/css" media="print">p{}</style ><p>x</p>`,
+			opts:     ExternalizeOptions{Styles: true},
+			expected: `<link rel="stylesheet" href="assets/` + css + `" media="print"><p>x</p>`,
+			assets:   1,
+		},
+		{
+			name:     "identical blocks share a file",
+			source:   `<script>run()</script><script>run()</script>`,
+			opts:     ExternalizeOptions{Scripts: true},
+			expected: `<script src="assets/` + js + `"></script><script src="assets/` + js + `"></script>`,
+			assets:   1,
+		},
+		{
+			name:     "nonce for strict-dynamic",
+			source:   `<script nonce="old">run()</script>`,
+			opts:     ExternalizeOptions{Scripts: true, Nonce: "abc"},
+			expected: `<script src="assets/` + js + `" nonce="abc"></script>`,
+			assets:   1,
+		},
+		{
+			name:   "external, empty and data block scripts are left alone",
+			source: `<script src="a.js"></script><script> </script><script type="application/ld+json">{}</script>`,
+			opts:   ExternalizeOptions{Scripts: true},
+		},
+		{
+			name:    "import maps cannot be external",
+			source:  `<script type="importmap">{"imports":{}}</script>`,
+			opts:    ExternalizeOptions{Scripts: true},
+			skipped: 1,
+		},
+		{
+			name:    "relative module imports",
+			source:  `<script type="module">import { a } from "./a.js"</script>`,
+			opts:    ExternalizeOptions{Scripts: true},
+			skipped: 1,
+		},
+		{
+			name:    "relative CSS URLs",
+			source:  `<style>body{background:url('img/bg.png')}</style>`,
+			opts:    ExternalizeOptions{Styles: true},
+			skipped: 1,
+		},
+		{
+			name:     "absolute CSS URLs",
+			source:   `<style>@import "/base.css"; b{background:url(data:image/png;base64,AA==)}</style>`,
+			opts:     ExternalizeOptions{Styles: true},
+			expected: `<link rel="stylesheet" href="assets/` + assetName(`@import "/base.css"; b{background:url(data:image/png;base64,AA==)}`, "style") + `">`,
+			assets:   1,
+		},
+		{
+			name:   "disabled",
+			source: `<script>run()</script><style>p{}</style>`,
+			opts:   ExternalizeOptions{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage("", []byte(tt.source))
+			result := externalize(page, "assets", tt.opts)
+
+			expected := tt.expected
+			if expected == "" {
+				expected = tt.source
+			}
+			if got := string(page.Bytes()); got != expected {
+				t.Errorf("Expected %s, got %s", expected, got)
+			}
+			if len(result.Assets) != tt.assets {
+				t.Errorf("Expected %d asset(s), got %d", tt.assets, len(result.Assets))
+			}
+			if len(result.Skipped) != tt.skipped {
+				t.Errorf("Expected %d skipped element(s), got %+v", tt.skipped, result.Skipped)
+			}
+		})
+	}
+}
+
+func TestExternalizeNestedPage(t *testing.T) {
+	out := t.TempDir()
+	page := NewPage("post.html", []byte(`<script>run()</script>`))
+	result, err := Externalize(page, filepath.Join(out, "blog", "post.html"), ExternalizeOptions{Scripts: true, AssetsDir: filepath.Join(out, "assets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<script src="../assets/` + assetName("run()", "script") + `"></script>`
+	if got := string(page.Bytes()); got != expected || result.Elements != 1 {
+		t.Errorf("Expected %s, got %s (%d element(s))", expected, got, result.Elements)
+	}
+	if !result.Contents()["run()"] {
+		t.Error("Expected the script content to be reported as externalized")
+	}
+
+	if err := WriteAssets(filepath.Join(out, "assets"), result.Assets); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "assets", result.Assets[0].Name))
+	if err != nil || string(data) != "run()" {
+		t.Errorf("Expected the asset to contain run(), got %q (%v)", data, err)
+	}
+}
+
+func TestExternalizeCRLF(t *testing.T) {
+	source := []byte("<html><head>\r\n<script>\r\nrun();\r\nstop();\r\n</script>\r\n<style>p {\r\n}\r</style></head></html>\r\n")
+	items, err := ParseInlineItems(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := externalize(NewPage("", source), "assets", ExternalizeOptions{Scripts: true, Styles: true})
+	contents := result.Contents()
+	if len(items) != 2 || len(result.Assets) != 2 {
+		t.Fatalf("Expected 2 items and 2 assets, got %d and %d", len(items), len(result.Assets))
+	}
+	// The policy leaves out the hashes of externalized items, found by their parsed content
+	for _, item := range items {
+		if !contents[item.Content] {
+			t.Errorf("Expected the parsed content %q among the externalized contents %v", item.Content, contents)
+		}
+	}
+	if asset := result.Assets[0]; asset.Content != "\nrun();\nstop();\n" || asset.Name != assetName(asset.Content, "script") {
+		t.Errorf("Expected the asset with LF line breaks, got %+v", asset)
+	}
+}
+
+func TestIsRelativeURL(t *testing.T) {
+	tests := map[string]bool{
+		"img/bg.png":                true,
+		"../fonts/a.woff2":          true,
+		"a.png?v=1:2":               true,
+		"/img/bg.png":               false,
+		"//cdn.example.com/a.png":   false,
+		"https://example.com/a.png": false,
+		"data:image/png;base64,AA":  false,
+		"#filter":                   false,
+		"":                          false,
+	}
+	for url, expected := range tests {
+		if got := isRelativeURL(url); got != expected {
+			t.Errorf("isRelativeURL(%q) = %v, expected %v", url, got, expected)
+		}
+	}
+}
+
+func TestAllowSelfForAssets(t *testing.T) {
+	tests := []struct {
+		name     string
+		csp      string
+		scripts  bool
+		styles   bool
+		expected string
+	}{
+		{"already allowed", "default-src 'self'", true, true, "default-src 'self'"},
+		{"added to script-src", "script-src https://cdn.example.com", true, false, "script-src https://cdn.example.com 'self'"},
+		{"copied from default-src", "default-src https://a.com", false, true, "default-src https://a.com; style-src https://a.com 'self'"},
+		{"replaces 'none'", "default-src 'none'; script-src 'none'", true, false, "default-src 'none'; script-src 'self'"},
+		{"element directive", "script-src 'self'; script-src-elem 'sha256-AA=='", true, false, "script-src 'self'; script-src-elem 'sha256-AA==' 'self'"},
+		{"unrestricted", "img-src 'self'", true, true, "img-src 'self'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllowSelfForAssets(tt.csp, tt.scripts, tt.styles); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"csp/policy"
+)
+
+// keywordSources are the quoted keywords allowed in a CSP3 source list
+var keywordSources = []string{
+	"'self'",
+	"'none'",
+	"'unsafe-inline'",
+	"'unsafe-eval'",
+	"'strict-dynamic'",
+	"'unsafe-hashes'",
+	"'report-sample'",
+	"'unsafe-allow-redirects'",
+	"'wasm-unsafe-eval'",
+	"'inline-speculation-rules'",
+}
+
+// hashDigestLengths maps a hash-source algorithm to its digest length in bytes
+var hashDigestLengths = map[string]int{
+	"sha256": 32,
+	"sha384": 48,
+	"sha512": 64,
+}
+
+// sourceProblem describes why a token is not a valid source expression
+type sourceProblem struct {
+	Severity string // "warning" or "error"
+	Message  string
+	Fix      string
+}
+
+// checkSourceExpression validates a single source list token against the CSP3 grammar.
+// It returns nil when the token is valid.
+func checkSourceExpression(token string) *sourceProblem {
+	src := ParseSourceExpression(token)
+
+	switch src.Kind {
+	case SourceKindKeyword:
+		return checkKeywordSource(token)
+	case SourceKindNonce:
+		return checkNonceSource(token)
+	case SourceKindHash:
+		return checkHashSource(token)
+	case SourceKindScheme:
+		return nil
+	default:
+		return checkHostSource(token)
+	}
+}
+
+// isKeywordSource reports whether token is a known (quoted) keyword
+func isKeywordSource(token string) bool {
+	for _, keyword := range keywordSources {
+		if strings.EqualFold(token, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeywordSource validates a quoted token that is neither a nonce nor a hash
+func checkKeywordSource(token string) *sourceProblem {
+	if len(token) < 2 || !strings.HasSuffix(token, "'") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "quoted source is missing its closing quote",
+			Fix:      fmt.Sprintf("Close the quote: %s'", token),
+		}
+	}
+
+	if isKeywordSource(token) {
+		return nil
+	}
+
+	inner := token[1 : len(token)-1]
+	if strings.Contains(inner, "://") || strings.Contains(inner, ".") || inner == "*" {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "host sources must not be quoted",
+			Fix:      fmt.Sprintf("Remove the quotes: %s", inner),
+		}
+	}
+
+	if policy.IsSchemeSource(inner) {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "scheme sources must not be quoted",
+			Fix:      fmt.Sprintf("Remove the quotes: %s", inner),
+		}
+	}
+
+	return &sourceProblem{
+		Severity: "error",
+		Message:  "unknown keyword",
+		Fix:      "Use one of: " + strings.Join(keywordSources, ", "),
+	}
+}
+
+// checkNonceSource validates a 'nonce-<base64-value>' token
+func checkNonceSource(token string) *sourceProblem {
+	if !strings.HasSuffix(token, "'") || len(token) < len("'nonce-'") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "nonce source is missing its closing quote",
+			Fix:      "Use the form 'nonce-<base64-value>'",
+		}
+	}
+
+	value := token[len("'nonce-") : len(token)-1]
+	if !isBase64Value(value) {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "nonce value is not a base64 value",
+			Fix:      "Use a base64 encoded random value of at least 128 bits, e.g. 'nonce-rAnd0m123+/='",
+		}
+	}
+	return nil
+}
+
+// checkHashSource validates a 'shaNNN-<base64-value>' token, including the digest length
+func checkHashSource(token string) *sourceProblem {
+	if !strings.HasSuffix(token, "'") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "hash source is missing its closing quote",
+			Fix:      "Use the form 'sha256-<base64-value>'",
+		}
+	}
+
+	inner := token[1 : len(token)-1]
+	dash := strings.Index(inner, "-")
+	algorithm := strings.ToLower(inner[:dash])
+	value := inner[dash+1:]
+
+	if !isBase64Value(value) {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "hash value is not a base64 value",
+			Fix:      "Compute the hash with the tool or with: openssl dgst -" + algorithm + " -binary | openssl base64",
+		}
+	}
+
+	if strings.ContainsAny(value, "-_") {
+		return &sourceProblem{
+			Severity: "warning",
+			Message:  "hash uses URL-safe base64 ('-' and '_'), which not all browsers accept",
+			Fix:      "Use standard base64: replace '-' with '+' and '_' with '/'",
+		}
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "hash value is not valid base64",
+			Fix:      "Make sure the hash is complete, including any trailing '=' padding",
+		}
+	}
+
+	if expected := hashDigestLengths[algorithm]; len(digest) != expected {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  fmt.Sprintf("%s hash decodes to %d bytes, expected %d", algorithm, len(digest), expected),
+			Fix:      "Make sure the hash was computed with " + algorithm + " and was not truncated",
+		}
+	}
+	return nil
+}
+
+// isBase64Value reports whether s matches 1*( ALPHA / DIGIT / "+" / "/" / "-" / "_" )*2( "=" )
+func isBase64Value(s string) bool {
+	trimmed := strings.TrimRight(s, "=")
+	if trimmed == "" || len(s)-len(trimmed) > 2 {
+		return false
+	}
+	for _, c := range trimmed {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '+', c == '/', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkHostSource validates an unquoted token that is not a scheme source
+func checkHostSource(token string) *sourceProblem {
+	if isKeywordSource("'" + token + "'") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "keyword must be quoted; unquoted it is treated as a hostname",
+			Fix:      fmt.Sprintf("Use '%s' (with single quotes)", strings.ToLower(token)),
+		}
+	}
+
+	if strings.HasPrefix(token, "'") || strings.HasSuffix(token, "'") || strings.HasPrefix(token, "\"") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "source has mismatched quotes",
+			Fix:      "Keywords, nonces and hashes use single quotes on both sides; hosts and schemes are unquoted",
+		}
+	}
+
+	hs, ok := parseHostSource(token)
+	if !ok || strings.Count(token, "://") > 1 {
+		return invalidHostSource()
+	}
+
+	if strings.Contains(token, "://") && !policy.IsSchemeSource(hs.Scheme+":") {
+		return invalidHostSource()
+	}
+
+	if !isValidHostPart(hs.Host) {
+		return invalidHostSource()
+	}
+
+	if hs.Port != "" && hs.Port != "*" {
+		for _, c := range hs.Port {
+			if c < '0' || c > '9' {
+				return &sourceProblem{
+					Severity: "error",
+					Message:  "port must be a number or '*'",
+					Fix:      "Use a numeric port, e.g. https://example.com:8443",
+				}
+			}
+		}
+	}
+	if strings.HasSuffix(token, ":") && hs.Port == "" {
+		return invalidHostSource()
+	}
+
+	if strings.ContainsAny(hs.Path, "'\"<>\\{}|^`,;") {
+		return &sourceProblem{
+			Severity: "error",
+			Message:  "path contains characters that are not allowed in a source expression",
+			Fix:      "Percent-encode the path or shorten it to a directory prefix ending in '/'",
+		}
+	}
+	return nil
+}
+
+// isValidHostPart checks host-part = "*" / [ "*." ] 1*host-char *( "." 1*host-char ) [ "." ]
+func isValidHostPart(host string) bool {
+	if host == "*" {
+		return true
+	}
+	host = strings.TrimPrefix(host, "*.")
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// invalidHostSource is the generic problem for tokens that match no source grammar
+func invalidHostSource() *sourceProblem {
+	return &sourceProblem{
+		Severity: "error",
+		Message:  "not a valid source expression",
+		Fix:      "Use a keyword ('self'), a scheme (https:), a host ([scheme://]host[:port][/path]), a nonce or a hash",
+	}
+}
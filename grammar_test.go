@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSourceExpression(t *testing.T) {
+	validSHA256 := ComputeHash("test", SHA256)
+	validSHA384 := ComputeHash("test", SHA384)
+	validSHA512 := ComputeHash("test", SHA512)
+
+	tests := []struct {
+		token          string
+		expectSeverity string // "" means valid
+		expectMessage  string
+	}{
+		{"'self'", "", ""},
+		{"'SELF'", "", ""},
+		{"'none'", "", ""},
+		{"'strict-dynamic'", "", ""},
+		{"'wasm-unsafe-eval'", "", ""},
+		{"'nonce-r4nd0m+/='", "", ""},
+		{validSHA256, "", ""},
+		{validSHA384, "", ""},
+		{validSHA512, "", ""},
+		{"https:", "", ""},
+		{"data:", "", ""},
+		{"*", "", ""},
+		{"example.com", "", ""},
+		{"*.example.com", "", ""},
+		{"https://cdn.example.com", "", ""},
+		{"https://*.example.com:443/js/", "", ""},
+		{"wss://example.com:*", "", ""},
+		{"self", "error", "must be quoted"},
+		{"none", "error", "must be quoted"},
+		{"unsafe-inline", "error", "must be quoted"},
+		{"'example.com'", "error", "must not be quoted"},
+		{"'https://cdn.example.com'", "error", "must not be quoted"},
+		{"'https:'", "error", "must not be quoted"},
+		{"'unsafe-line'", "error", "unknown keyword"},
+		{"'self", "error", "closing quote"},
+		{"self'", "error", "mismatched quotes"},
+		{"'nonce-'", "error", "not a base64 value"},
+		{"'nonce-abc!'", "error", "not a base64 value"},
+		{"'sha256-abc123'", "error", "not valid base64"},
+		{"'sha256-dGVzdA=='", "error", "decodes to 4 bytes, expected 32"},
+		{strings.Replace(validSHA384, "sha384", "sha256", 1), "error", "decodes to 48 bytes, expected 32"},
+		{"'sha256-n4bQgYhMfWWaL-qgxVrQFaO_TxsrC4Is0V1sFbDwCgg='", "warning", "URL-safe base64"},
+		{"https://exa_mple.com", "error", "not a valid source expression"},
+		{"https://", "error", "not a valid source expression"},
+		{"https://example.com:", "error", "not a valid source expression"},
+		{"example.com:80a", "error", "port must be a number"},
+		{"https://example.com/a<b", "error", "path contains characters"},
+		{"1ttp://example.com", "error", "not a valid source expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			problem := checkSourceExpression(tt.token)
+
+			if tt.expectSeverity == "" {
+				if problem != nil {
+					t.Errorf("Expected %q to be valid, got: %s", tt.token, problem.Message)
+				}
+				return
+			}
+
+			if problem == nil {
+				t.Fatalf("Expected %q to be reported as %s", tt.token, tt.expectSeverity)
+			}
+			if problem.Severity != tt.expectSeverity {
+				t.Errorf("Expected severity %q, got %q", tt.expectSeverity, problem.Severity)
+			}
+			if !strings.Contains(problem.Message, tt.expectMessage) {
+				t.Errorf("Expected message to contain %q, got: %s", tt.expectMessage, problem.Message)
+			}
+			if problem.Fix == "" {
+				t.Error("Expected a suggested fix")
+			}
+		})
+	}
+}
+
+func TestIsValidHostPart(t *testing.T) {
+	valid := []string{"*", "example.com", "*.example.com", "localhost", "example.com.", "xn--bcher-kva.example"}
+	invalid := []string{"", "*.", "ex ample.com", "example..com", "exa*mple.com", "*example.com"}
+
+	for _, host := range valid {
+		if !isValidHostPart(host) {
+			t.Errorf("Expected %q to be a valid host part", host)
+		}
+	}
+	for _, host := range invalid {
+		if isValidHostPart(host) {
+			t.Errorf("Expected %q to be an invalid host part", host)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// handlerIDAttr is the attribute that links an element to its handlers in the generated script
+const handlerIDAttr = "data-csp-handler"
+
+// windowEventHandlers are the event handler attributes of <body> and <frameset> that set
+// handlers on the window rather than on the element
+var windowEventHandlers = map[string]bool{
+	"onafterprint": true, "onbeforeprint": true, "onbeforeunload": true, "onhashchange": true,
+	"onlanguagechange": true, "onmessage": true, "onmessageerror": true, "onoffline": true,
+	"ononline": true, "onpagehide": true, "onpageshow": true, "onpopstate": true,
+	"onrejectionhandled": true, "onstorage": true, "onunhandledrejection": true, "onunload": true,
+	"onblur": true, "onerror": true, "onfocus": true, "onload": true, "onresize": true, "onscroll": true,
+}
+
+// eventHandler is the code of one inline event handler attribute
+type eventHandler struct {
+	Event string // event type, e.g. "click"
+	Code  string
+}
+
+// DelegateResult describes the event handlers moved out of one page
+type DelegateResult struct {
+	Elements int         // number of elements whose handlers were removed
+	Script   InlineAsset // generated script attaching the handlers; empty Name when the page has none
+	Handlers []inlineKey // the removed handlers with their element's position
+	Skipped  []SkippedInline
+}
+
+// DelegateEventHandlers removes the inline event handler attributes of a page, for a copy
+// written to outPath. Elements are tagged with a data-csp-handler id, and a generated
+// script in opts.AssetsDir attaches equivalent listeners. Only AssetsDir and Nonce of
+// opts are used.
+func DelegateEventHandlers(page *Page, outPath string, opts ExternalizeOptions) (*DelegateResult, error) {
+	assetsURL, err := filepath.Rel(filepath.Dir(outPath), opts.AssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	return delegateEventHandlers(page, filepath.ToSlash(assetsURL), opts.Nonce), nil
+}
+
+// delegateEventHandlers moves the handlers of a page into a script referenced from assetsURL
+func delegateEventHandlers(page *Page, assetsURL, nonce string) *DelegateResult {
+	result := &DelegateResult{}
+	var ids []string
+	elementHandlers := map[string][]eventHandler{}
+	var windowHandlers []eventHandler
+
+	for _, tag := range page.Tags {
+		var handlers, onWindow []eventHandler
+		for _, attr := range tag.Attrs {
+			if !isEventHandler(attr.Key) {
+				continue
+			}
+			handler := eventHandler{Event: strings.TrimPrefix(attr.Key, "on"), Code: attr.Val}
+			if (tag.Name == "body" || tag.Name == "frameset") && windowEventHandlers[attr.Key] {
+				onWindow = append(onWindow, handler)
+			} else {
+				handlers = append(handlers, handler)
+			}
+		}
+		if len(handlers) == 0 && len(onWindow) == 0 {
+			continue
+		}
+		if len(handlers) > 0 && hasSourceAttr(tag, handlerIDAttr) {
+			result.Skipped = append(result.Skipped, SkippedInline{Type: ContentTypeEventHandler, Line: tag.Line, Column: tag.Column,
+				Reason: "the element already has a " + handlerIDAttr + " attribute"})
+			continue
+		}
+		windowHandlers = append(windowHandlers, onWindow...)
+
+		for _, attr := range append(tag.Attrs[:0:0], tag.Attrs...) {
+			if isEventHandler(attr.Key) {
+				tag.removeAttr(attr.Key)
+				result.Handlers = append(result.Handlers, inlineKey{Line: tag.Line, Column: tag.Column, Content: attr.Val})
+			}
+		}
+		if len(handlers) > 0 {
+			id := handlerID(handlers)
+			tag.setAttr(handlerIDAttr, id)
+			if _, ok := elementHandlers[id]; !ok {
+				ids = append(ids, id)
+				elementHandlers[id] = handlers
+			}
+		}
+		result.Elements++
+	}
+
+	if result.Elements == 0 {
+		return result
+	}
+
+	content := handlersScript(ids, elementHandlers, windowHandlers)
+	result.Script = InlineAsset{Name: "handlers-" + contentHash(content) + ".js", Type: ContentTypeScript, Content: content}
+
+	url := result.Script.Name
+	if assetsURL != "" && assetsURL != "." {
+		url = assetsURL + "/" + url
+	}
+	tag := fmt.Sprintf(`<script src="%s"`, escapeAttrValue(url))
+	if nonce != "" {
+		tag += fmt.Sprintf(` nonce="%s"`, escapeAttrValue(nonce))
+	}
+	pos := headStart(page.Tags)
+	page.Replace(htmlEdit{Start: pos, End: pos, Text: tag + "></script>"})
+
+	return result
+}
+
+// handlerID returns a stable id for a set of handlers, so that elements with identical
+// handlers share an entry in the generated script
+func handlerID(handlers []eventHandler) string {
+	var buf strings.Builder
+	for _, handler := range handlers {
+		buf.WriteString(handler.Event + "\x00" + handler.Code + "\x00")
+	}
+	return "h" + contentHash(buf.String())[:8]
+}
+
+// contentHash returns the hex digits of the SHA-256 of content used in asset names
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])[:assetHashLength]
+}
+
+// handlersScript generates the script attaching the handlers. A capturing listener on the
+// document adds a bubbling listener to each element of the event path that has handlers
+// before the event reaches it, so the handlers run in the same phase as inline ones and
+// stopPropagation works both ways. Window handlers are attached to the window directly.
+func handlersScript(ids []string, elementHandlers map[string][]eventHandler, windowHandlers []eventHandler) string {
+	var buf strings.Builder
+	buf.WriteString("// Event handlers moved out of inline attributes by csp\n")
+	buf.WriteString("(function () {\n")
+
+	types := []string{}
+	buf.WriteString("  var handlers = {")
+	for i, id := range ids {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, "\n    %s: {", jsString(id))
+		for j, handler := range elementHandlers[id] {
+			if j > 0 {
+				buf.WriteString(",")
+			}
+			writeHandlerFunction(&buf, handler, "      ", "event", elementHandlerScope)
+			if !containsString(types, handler.Event) {
+				types = append(types, handler.Event)
+			}
+		}
+		buf.WriteString("\n    }")
+	}
+	buf.WriteString("\n  };\n")
+
+	buf.WriteString("  var windowHandlers = {")
+	for i, handler := range windowHandlers {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		params := "event"
+		if handler.Event == "error" {
+			params = "event, source, lineno, colno, error"
+		}
+		writeHandlerFunction(&buf, handler, "    ", params, windowHandlerScope)
+	}
+	buf.WriteString("\n  };\n\n")
+
+	quoted := make([]string, len(types))
+	for i, eventType := range types {
+		quoted[i] = jsString(eventType)
+	}
+	buf.WriteString(`  function run(fn, target, event) {
+    var windowError = target === window && event.type === "error";
+    var result = windowError
+      ? fn.call(target, event.message, event.filename, event.lineno, event.colno, event.error)
+      : fn.call(target, event);
+    var cancel = event.type === "beforeunload" ? result != null : windowError ? result === true : result === false;
+    if (cancel) {
+      event.preventDefault();
+    }
+  }
+
+  function dispatch(event) {
+    var id = this.getAttribute("` + handlerIDAttr + `");
+    var fn = handlers[id] && handlers[id][event.type];
+    if (fn) {
+      run(fn, this, event);
+    }
+  }
+
+  // Adding the same listener again is a no-op, so each element gets it once
+  function listen(event) {
+    var path = event.composedPath();
+    for (var i = 0; i < path.length; i++) {
+      if (path[i].hasAttribute && path[i].hasAttribute("` + handlerIDAttr + `")) {
+        path[i].addEventListener(event.type, dispatch);
+      }
+    }
+  }
+
+  [` + strings.Join(quoted, ", ") + `].forEach(function (type) {
+    document.addEventListener(type, listen, true);
+  });
+  Object.keys(windowHandlers).forEach(function (type) {
+    window.addEventListener(type, function (event) {
+      run(windowHandlers[type], window, event);
+    });
+  });
+})();
+`)
+	return buf.String()
+}
+
+// Inline handlers resolve names in the element, its form owner and the document before the
+// globals, so that onclick="submit()" calls the form's submit. The with statements rebuild
+// that scope chain; the generated script is not strict code, where with is forbidden.
+const (
+	elementHandlerScope = "with (document) with (this.form || {}) with (this)"
+	windowHandlerScope  = "with (document) with (document.body || {})" // handlers of <body> are scoped to it
+)
+
+// writeHandlerFunction writes `"event": function (params) { scope { code } }` with the
+// original code on its own lines, so that a trailing // comment cannot swallow the
+// closing braces
+func writeHandlerFunction(buf *strings.Builder, handler eventHandler, indent, params, scope string) {
+	fmt.Fprintf(buf, "\n%s%s: function (%s) { %s {\n%s\n%s} }", indent, jsString(handler.Event), params, scope, handler.Code, indent)
+}
+
+// jsString quotes a string as a JavaScript string literal
+func jsString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDelegateEventHandlers(t *testing.T) {
+	source := `<html><head></head><body><button onclick="go(this); return false" class="b">a</button>` +
+		`<button onclick="go(this); return false">b</button><img src="a.png" onload="loaded()" onerror="failed(event)"></body></html>`
+	page := NewPage("", []byte(source))
+	result := delegateEventHandlers(page, "assets", "")
+
+	if result.Elements != 3 {
+		t.Errorf("Expected 3 elements, got %d", result.Elements)
+	}
+	if len(result.Handlers) != 4 {
+		t.Errorf("Expected 4 handlers removed, got %v", result.Handlers)
+	}
+
+	buttonID := handlerID([]eventHandler{{Event: "click", Code: "go(this); return false"}})
+	imgID := handlerID([]eventHandler{{Event: "load", Code: "loaded()"}, {Event: "error", Code: "failed(event)"}})
+	expected := `<html><head><script src="assets/` + result.Script.Name + `"></script></head><body>` +
+		`<button class="b" data-csp-handler="` + buttonID + `">a</button><button data-csp-handler="` + buttonID + `">b</button>` +
+		`<img src="a.png" data-csp-handler="` + imgID + `"></body></html>`
+	if got := string(page.Bytes()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	script := result.Script.Content
+	for _, want := range []string{
+		`"click": function (event) { with (document) with (this.form || {}) with (this) {` + "\ngo(this); return false\n      } }",
+		`"error": function (event) { with (document) with (this.form || {}) with (this) {` + "\nfailed(event)\n",
+		`["click", "load", "error"].forEach`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the script to contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Count(script, `"`+buttonID+`"`) != 1 {
+		t.Error("Expected elements with identical handlers to share one entry")
+	}
+}
+
+func TestDelegateWindowHandlers(t *testing.T) {
+	page := NewPage("", []byte(`<body onload="init() // start" onerror="return report(event)" onclick="clicked()"><p>x</p></body>`))
+	result := delegateEventHandlers(page, ".", "abc")
+
+	expected := `<script src="` + result.Script.Name + `" nonce="abc"></script><body data-csp-handler="` +
+		handlerID([]eventHandler{{Event: "click", Code: "clicked()"}}) + `"><p>x</p></body>`
+	if got := string(page.Bytes()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	script := result.Script.Content
+	for _, want := range []string{
+		"  var windowHandlers = {\n    \"load\": function (event) { with (document) with (document.body || {}) {\ninit() // start\n    } },",
+		`"error": function (event, source, lineno, colno, error) { with (document) with (document.body || {}) {`,
+		`["click"].forEach`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the script to contain %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestDelegateEventHandlersSkipped(t *testing.T) {
+	source := `<p>none</p><div data-csp-handler="x" onclick="a()">taken</div>`
+	page := NewPage("", []byte(source))
+	result := delegateEventHandlers(page, "assets", "")
+
+	if result.Elements != 0 || result.Script.Name != "" || len(result.Skipped) != 1 {
+		t.Errorf("Expected one skipped element and no script, got %+v", result)
+	}
+	if got := string(page.Bytes()); got != source {
+		t.Errorf("Expected the page to be unchanged, got %s", got)
+	}
+}
+
+func TestDelegateEventHandlersRemovedByElement(t *testing.T) {
+	page := NewPage("", []byte("<div data-csp-handler=\"x\" onclick=\"a()\">taken</div>\n<p onclick=\"a()\">moved</p>"))
+	result := delegateEventHandlers(page, "assets", "")
+
+	// The handler left on the first element must keep its hash although the code is the same
+	expected := []inlineKey{{Line: 2, Column: 1, Content: "a()"}}
+	if !reflect.DeepEqual(result.Handlers, expected) || len(result.Skipped) != 1 {
+		t.Errorf("Expected only the second element's handler removed, got %+v", result)
+	}
+}
+
+func TestDelegateEventHandlersNestedPage(t *testing.T) {
+	out := t.TempDir()
+	page := NewPage("", []byte(`<a onclick="a()">x</a>`))
+	result, err := DelegateEventHandlers(page, filepath.Join(out, "blog", "post.html"), ExternalizeOptions{AssetsDir: filepath.Join(out, "assets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(page.Bytes()), `<script src="../assets/`+result.Script.Name+`">`) {
+		t.Errorf("Expected a relative script URL, got %s", page.Bytes())
+	}
+}
+
+// eventPropagationHarness is a minimal DOM with capturing and bubbling dispatch, in which
+// the generated script runs. Elements are created by the test code appended to it.
+const eventPropagationHarness = `
+var log = [];
+function Node(parent, attrs) {
+  this.parentNode = parent || null;
+  this.attrs = attrs || {};
+  this.listeners = [];
+}
+Node.prototype.getAttribute = function (key) { return key in this.attrs ? this.attrs[key] : null; };
+Node.prototype.hasAttribute = function (key) { return key in this.attrs; };
+Node.prototype.addEventListener = function (type, fn, capture) {
+  capture = !!capture;
+  if (!this.listeners.some(function (l) { return l.type === type && l.fn === fn && l.capture === capture; })) {
+    this.listeners.push({ type: type, fn: fn, capture: capture });
+  }
+};
+Node.prototype.click = function () {
+  var event = { type: "click", bubbles: true, stopped: false,
+    stopPropagation: function () { this.stopped = true; }, preventDefault: function () {} };
+  var path = [];
+  for (var node = this; node; node = node.parentNode) path.push(node);
+  path.push(window);
+  event.target = this;
+  event.composedPath = function () { return path.slice(); };
+  function invoke(node, phase) {
+    node.listeners.slice().forEach(function (l) {
+      if (l.type === event.type && (phase === "target" || l.capture === (phase === "capture"))) {
+        event.currentTarget = node;
+        l.fn.call(node, event);
+      }
+    });
+  }
+  for (var i = path.length - 1; i > 0 && !event.stopped; i--) invoke(path[i], "capture");
+  if (!event.stopped) invoke(path[0], "target");
+  for (var j = 1; j < path.length && !event.stopped; j++) invoke(path[j], "bubble");
+};
+var window = new Node();
+var document = new Node();
+`
+
+func TestHandlersScriptStopPropagation(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	outer := []eventHandler{{Event: "click", Code: `log.push("outer " + (this === event.currentTarget))`}}
+	stopping := []eventHandler{{Event: "click", Code: `log.push("inner"); event.stopPropagation()`}}
+	quiet := []eventHandler{{Event: "click", Code: `log.push("parent")`}}
+	ids := []string{handlerID(outer), handlerID(stopping), handlerID(quiet)}
+	script := handlersScript(ids, map[string][]eventHandler{ids[0]: outer, ids[1]: stopping, ids[2]: quiet}, nil)
+
+	test := script + `
+var body = new Node(document);
+var outer = new Node(body, { "data-csp-handler": "` + ids[0] + `" });
+outer.addEventListener("click", function () { log.push("outer listener"); });
+var inner = new Node(outer, { "data-csp-handler": "` + ids[1] + `" });
+var other = new Node(outer);
+var parent = new Node(body, { "data-csp-handler": "` + ids[2] + `" });
+var child = new Node(parent);
+child.addEventListener("click", function (event) { log.push("child listener"); event.stopPropagation(); });
+
+inner.click();
+other.click();
+child.click();
+console.log(log.join(", "));
+`
+	file := filepath.Join(t.TempDir(), "test.js")
+	if err := os.WriteFile(file, []byte(eventPropagationHarness+test), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(node, file).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, out)
+	}
+
+	// A handler that stops propagation hides the event from its ancestors, and a listener
+	// below a handler that stops propagation keeps it from running
+	expected := "inner, outer listener, outer true, child listener"
+	if got := strings.TrimSpace(string(out)); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
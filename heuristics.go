@@ -7,12 +7,12 @@ import (
 
 // HeuristicResource represents an inferred external resource
 type HeuristicResource struct {
-	URL        string
-	Type       string
-	Confidence string // "high", "medium", "low"
-	Reason     string
-	SourceURL  string // The URL that triggered this inference
-	SourceType string // The type of the source resource
+	URL        string `json:"url"`
+	Type       string `json:"type"`
+	Confidence string `json:"confidence"` // "high", "medium", "low"
+	Reason     string `json:"reason"`
+	SourceURL  string `json:"source_url"`  // The URL that triggered this inference
+	SourceType string `json:"source_type"` // The type of the source resource
 }
 
 // ApplyHeuristics analyzes existing external resources and infers additional ones
@@ -385,6 +385,40 @@ func ConvertHeuristicToExternalResource(heuristic HeuristicResource) ExternalRes
 	}
 }
 
+// AddHeuristicResources applies heuristics to a set of external resources and adds the
+// inferred resources to it
+func AddHeuristicResources(resources *ExternalResources) []HeuristicResource {
+	// Collect all external resources into a flat list for heuristics
+	var all []ExternalResource
+	all = append(all, resources.Scripts...)
+	all = append(all, resources.Stylesheets...)
+	all = append(all, resources.Images...)
+	all = append(all, resources.Fonts...)
+	all = append(all, resources.Frames...)
+
+	inferred := ApplyHeuristics(all)
+
+	// Convert heuristic resources back to external resources and merge
+	for _, h := range inferred {
+		externalRes := ConvertHeuristicToExternalResource(h)
+		switch h.Type {
+		case "script":
+			resources.Scripts = append(resources.Scripts, externalRes)
+		case "stylesheet":
+			resources.Stylesheets = append(resources.Stylesheets, externalRes)
+		case "image":
+			resources.Images = append(resources.Images, externalRes)
+		case "font":
+			resources.Fonts = append(resources.Fonts, externalRes)
+		case "frame":
+			resources.Frames = append(resources.Frames, externalRes)
+		case "connect":
+			resources.Other = append(resources.Other, externalRes)
+		}
+	}
+	return inferred
+}
+
 // GetHeuristicsSummary returns a formatted summary of inferred resources
 func GetHeuristicsSummary(heuristics []HeuristicResource) map[string]int {
 	summary := make(map[string]int)
@@ -399,3 +399,20 @@ func TestApplyHeuristics_NoDuplicates(t *testing.T) {
 		t.Errorf("Expected fonts.gstatic.com to appear once, got %d times", fontStaticCount)
 	}
 }
+
+func TestAddHeuristicResources(t *testing.T) {
+	resources := &ExternalResources{
+		Stylesheets: []ExternalResource{{URL: "https://fonts.googleapis.com/css?family=Roboto", Type: "stylesheet", Domain: "fonts.googleapis.com"}},
+	}
+	inferred := AddHeuristicResources(resources)
+	if len(inferred) == 0 {
+		t.Fatal("Expected resources to be inferred from Google Fonts")
+	}
+	found := false
+	for _, font := range resources.Fonts {
+		found = found || font.URL == "https://fonts.gstatic.com"
+	}
+	if !found {
+		t.Errorf("Expected fonts.gstatic.com to be added to the fonts, got %+v", resources.Fonts)
+	}
+}
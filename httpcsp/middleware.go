@@ -0,0 +1,97 @@
+// Package httpcsp sends a Content Security Policy from net/http handlers. Its middleware
+// generates a fresh nonce for every request, adds it to the policy and stores it in the
+// request context, where html/template templates read it through FuncMap.
+package httpcsp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"csp/policy"
+)
+
+const (
+	headerName           = "Content-Security-Policy"
+	reportOnlyHeaderName = "Content-Security-Policy-Report-Only"
+)
+
+// DefaultNonceDirectives are the directives that receive the nonce when none are given
+var DefaultNonceDirectives = []string{"script-src", "style-src"}
+
+// Options configures the middleware
+type Options struct {
+	Policy        string   // base policy, GenerateStrictCSP(GetDefaultStrictTemplate()) if empty
+	ReportOnly    bool     // send Content-Security-Policy-Report-Only instead of enforcing the policy
+	Directives    []string // directives that allow the nonce, DefaultNonceDirectives if empty
+	StrictDynamic bool     // also add 'strict-dynamic' to script-src
+	Placeholder   string   // nonce placeholder already in Policy, e.g. from csp --nonce-placeholder
+}
+
+// Middleware sets the policy header on every response, with a nonce of its own
+type Middleware struct {
+	header      string
+	policy      string // policy with placeholder in place of every nonce
+	placeholder string
+}
+
+// New returns a middleware sending the policy of opts. Unless the policy already contains
+// 'nonce-<placeholder>' sources, a nonce source is added to each directive of
+// opts.Directives, creating the directive when the policy lacks it.
+func New(opts Options) (*Middleware, error) {
+	raw := opts.Policy
+	if strings.TrimSpace(raw) == "" {
+		raw = GenerateStrictCSP(GetDefaultStrictTemplate())
+	}
+	if strings.ContainsAny(raw, "\r\n") {
+		return nil, fmt.Errorf("policy must not contain line breaks")
+	}
+
+	m := &Middleware{header: headerName, placeholder: opts.Placeholder}
+	if opts.ReportOnly {
+		m.header = reportOnlyHeaderName
+	}
+
+	if m.placeholder != "" {
+		if !strings.Contains(raw, "'nonce-"+m.placeholder+"'") {
+			return nil, fmt.Errorf("policy has no 'nonce-%s' source", m.placeholder)
+		}
+		m.policy = raw
+		return m, nil
+	}
+
+	// Header values cannot contain NUL, so this cannot clash with the policy's sources
+	m.placeholder = "\x00nonce\x00"
+	directives := opts.Directives
+	if len(directives) == 0 {
+		directives = DefaultNonceDirectives
+	}
+	p := policy.Parse(raw)
+	for _, name := range directives {
+		p.AddSources(name, "'nonce-"+m.placeholder+"'")
+	}
+	if opts.StrictDynamic {
+		p.AddSources("script-src", "'strict-dynamic'")
+	}
+	m.policy = p.String()
+	return m, nil
+}
+
+// Policy returns the policy sent with a nonce
+func (m *Middleware) Policy(nonce string) string {
+	return strings.ReplaceAll(m.policy, m.placeholder, nonce)
+}
+
+// Handler wraps next so that each request gets a fresh nonce, available to next through
+// Nonce(r.Context()), and each response the policy allowing it
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := GenerateNonce()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(m.header, m.Policy(nonce))
+		next.ServeHTTP(w, r.WithContext(WithNonce(r.Context(), nonce)))
+	})
+}
@@ -0,0 +1,139 @@
+package httpcsp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+		err      string
+	}{
+		{
+			name:     "adds nonce to existing directives",
+			opts:     Options{Policy: "default-src 'self'; script-src 'self'; style-src 'none'"},
+			expected: "default-src 'self'; script-src 'self' 'nonce-N'; style-src 'nonce-N'",
+		},
+		{
+			name:     "creates missing directives",
+			opts:     Options{Policy: "default-src 'self' https://cdn.example.com;"},
+			expected: "default-src 'self' https://cdn.example.com; script-src 'self' https://cdn.example.com 'nonce-N'; style-src 'self' https://cdn.example.com 'nonce-N'",
+		},
+		{
+			name:     "creates missing directives under default-src 'none'",
+			opts:     Options{Policy: "default-src 'none'; img-src 'self'"},
+			expected: "default-src 'none'; img-src 'self'; script-src 'nonce-N'; style-src 'nonce-N'",
+		},
+		{
+			name:     "selected directives with strict-dynamic",
+			opts:     Options{Policy: "Script-Src 'self'", Directives: []string{"script-src"}, StrictDynamic: true},
+			expected: "script-src 'self' 'nonce-N' 'strict-dynamic'",
+		},
+		{
+			name:     "only the first of duplicate directives",
+			opts:     Options{Policy: "script-src 'self'; script-src 'none'", Directives: []string{"script-src"}},
+			expected: "script-src 'self' 'nonce-N'; script-src 'none'",
+		},
+		{
+			name:     "default strict policy",
+			opts:     Options{Directives: []string{"script-src"}},
+			expected: "default-src 'none'; script-src 'self' 'nonce-N'; style-src 'self'",
+		},
+		{
+			name:     "placeholder",
+			opts:     Options{Policy: "script-src 'nonce-{{CSP_NONCE}}'; style-src 'nonce-{{CSP_NONCE}}'", Placeholder: "{{CSP_NONCE}}"},
+			expected: "script-src 'nonce-N'; style-src 'nonce-N'",
+		},
+		{
+			name: "missing placeholder",
+			opts: Options{Policy: "script-src 'self'", Placeholder: "{{CSP_NONCE}}"},
+			err:  "policy has no 'nonce-{{CSP_NONCE}}' source",
+		},
+		{
+			name: "line break",
+			opts: Options{Policy: "script-src 'self'\r\nX-Injected: 1"},
+			err:  "policy must not contain line breaks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.opts)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy := m.Policy("N")
+			if tt.opts.Policy == "" {
+				policy = policy[:strings.Index(policy, "; img-src")]
+			}
+			if policy != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, policy)
+			}
+		})
+	}
+}
+
+func TestMiddlewareHandler(t *testing.T) {
+	m, err := New(Options{Policy: "default-src 'self'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nonces []string
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, Nonce(r.Context()))
+	}))
+
+	var headers []string
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		headers = append(headers, rec.Header().Get("Content-Security-Policy"))
+		if rec.Header().Get("Content-Security-Policy-Report-Only") != "" {
+			t.Error("Expected no Report-Only header")
+		}
+	}
+
+	if nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Fatalf("Expected a fresh nonce per request, got %q", nonces)
+	}
+	for i, nonce := range nonces {
+		expected := "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'; style-src 'self' 'nonce-" + nonce + "'"
+		if headers[i] != expected {
+			t.Errorf("Request %d: expected header %q, got %q", i, expected, headers[i])
+		}
+	}
+}
+
+func TestMiddlewareReportOnly(t *testing.T) {
+	m, err := New(Options{Policy: "default-src 'self'", ReportOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	m.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Header().Get("Content-Security-Policy") != "" {
+		t.Error("Expected no enforced policy")
+	}
+	if policy := rec.Header().Get("Content-Security-Policy-Report-Only"); !strings.Contains(policy, "script-src 'self' 'nonce-") {
+		t.Errorf("Expected a Report-Only policy with a nonce, got %q", policy)
+	}
+}
+
+func TestNonceWithoutMiddleware(t *testing.T) {
+	if nonce := Nonce(httptest.NewRequest(http.MethodGet, "/", nil).Context()); nonce != "" {
+		t.Errorf("Expected no nonce, got %q", nonce)
+	}
+}
@@ -0,0 +1,35 @@
+package httpcsp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// nonceBytes is the nonce size; CSP3 recommends at least 128 bits of randomness
+const nonceBytes = 16
+
+// GenerateNonce returns a base64 encoded random nonce
+func GenerateNonce() (string, error) {
+	buf := make([]byte, nonceBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// nonceKey is the context key of the request nonce
+type nonceKey struct{}
+
+// WithNonce returns a copy of ctx carrying a nonce
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey{}, nonce)
+}
+
+// Nonce returns the nonce of a request context, or "" when the request did not go
+// through the middleware
+func Nonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey{}).(string)
+	return nonce
+}
@@ -0,0 +1,156 @@
+package httpcsp
+
+import "strings"
+
+// StrictCSPTemplate defines the structure of a strict CSP policy
+type StrictCSPTemplate struct {
+	DefaultSrc             []string
+	ScriptSrc              []string
+	StyleSrc               []string
+	ImgSrc                 []string
+	FontSrc                []string
+	ConnectSrc             []string
+	ManifestSrc            []string
+	WorkerSrc              []string
+	FrameSrc               []string
+	ObjectSrc              []string
+	MediaSrc               []string
+	ChildSrc               []string
+	ScriptSrcElem          []string
+	ScriptSrcAttr          []string
+	StyleSrcElem           []string
+	StyleSrcAttr           []string
+	Sandbox                []string
+	TrustedTypes           []string
+	ReportTo               []string
+	BaseURI                []string
+	FormAction             []string
+	FrameAncestors         []string
+	UpgradeInsecure        bool
+	RequireTrustedTypesFor bool
+}
+
+// GetDefaultStrictTemplate returns a recommended strict CSP template
+func GetDefaultStrictTemplate() StrictCSPTemplate {
+	return StrictCSPTemplate{
+		DefaultSrc:      []string{"'none'"},
+		ScriptSrc:       []string{"'self'"},
+		StyleSrc:        []string{"'self'"},
+		ImgSrc:          []string{"'self'"},
+		FontSrc:         []string{"'self'"},
+		ConnectSrc:      []string{"'self'"},
+		ManifestSrc:     []string{"'self'"},
+		WorkerSrc:       []string{"'self'"},
+		FrameSrc:        []string{"'none'"},
+		ObjectSrc:       []string{"'none'"},
+		MediaSrc:        []string{"'self'"},
+		BaseURI:         []string{"'self'"},
+		FormAction:      []string{"'self'"},
+		FrameAncestors:  []string{"'none'"},
+		UpgradeInsecure: true,
+	}
+}
+
+// GenerateStrictCSP generates a strict CSP from a template
+func GenerateStrictCSP(template StrictCSPTemplate) string {
+	var parts []string
+
+	// Order matters for readability
+	if len(template.DefaultSrc) > 0 {
+		parts = append(parts, "default-src "+strings.Join(template.DefaultSrc, " "))
+	}
+
+	if len(template.ScriptSrc) > 0 {
+		parts = append(parts, "script-src "+strings.Join(template.ScriptSrc, " "))
+	}
+
+	if len(template.StyleSrc) > 0 {
+		parts = append(parts, "style-src "+strings.Join(template.StyleSrc, " "))
+	}
+
+	if len(template.ImgSrc) > 0 {
+		parts = append(parts, "img-src "+strings.Join(template.ImgSrc, " "))
+	}
+
+	if len(template.FontSrc) > 0 {
+		parts = append(parts, "font-src "+strings.Join(template.FontSrc, " "))
+	}
+
+	if len(template.ConnectSrc) > 0 {
+		parts = append(parts, "connect-src "+strings.Join(template.ConnectSrc, " "))
+	}
+
+	if len(template.ManifestSrc) > 0 {
+		parts = append(parts, "manifest-src "+strings.Join(template.ManifestSrc, " "))
+	}
+
+	if len(template.WorkerSrc) > 0 {
+		parts = append(parts, "worker-src "+strings.Join(template.WorkerSrc, " "))
+	}
+
+	if len(template.FrameSrc) > 0 {
+		parts = append(parts, "frame-src "+strings.Join(template.FrameSrc, " "))
+	}
+
+	if len(template.ObjectSrc) > 0 {
+		parts = append(parts, "object-src "+strings.Join(template.ObjectSrc, " "))
+	}
+
+	if len(template.MediaSrc) > 0 {
+		parts = append(parts, "media-src "+strings.Join(template.MediaSrc, " "))
+	}
+
+	if len(template.ChildSrc) > 0 {
+		parts = append(parts, "child-src "+strings.Join(template.ChildSrc, " "))
+	}
+
+	if len(template.ScriptSrcElem) > 0 {
+		parts = append(parts, "script-src-elem "+strings.Join(template.ScriptSrcElem, " "))
+	}
+
+	if len(template.ScriptSrcAttr) > 0 {
+		parts = append(parts, "script-src-attr "+strings.Join(template.ScriptSrcAttr, " "))
+	}
+
+	if len(template.StyleSrcElem) > 0 {
+		parts = append(parts, "style-src-elem "+strings.Join(template.StyleSrcElem, " "))
+	}
+
+	if len(template.StyleSrcAttr) > 0 {
+		parts = append(parts, "style-src-attr "+strings.Join(template.StyleSrcAttr, " "))
+	}
+
+	if len(template.Sandbox) > 0 {
+		parts = append(parts, "sandbox "+strings.Join(template.Sandbox, " "))
+	}
+
+	if len(template.TrustedTypes) > 0 {
+		parts = append(parts, "trusted-types "+strings.Join(template.TrustedTypes, " "))
+	}
+
+	if len(template.ReportTo) > 0 {
+		parts = append(parts, "report-to "+strings.Join(template.ReportTo, " "))
+	}
+
+	if len(template.BaseURI) > 0 {
+		parts = append(parts, "base-uri "+strings.Join(template.BaseURI, " "))
+	}
+
+	if len(template.FormAction) > 0 {
+		parts = append(parts, "form-action "+strings.Join(template.FormAction, " "))
+	}
+
+	if len(template.FrameAncestors) > 0 {
+		parts = append(parts, "frame-ancestors "+strings.Join(template.FrameAncestors, " "))
+	}
+
+	if template.RequireTrustedTypesFor {
+		parts = append(parts, "require-trusted-types-for 'script'")
+	}
+
+	if template.UpgradeInsecure {
+		parts = append(parts, "upgrade-insecure-requests")
+	}
+
+	return strings.Join(parts, "; ")
+}
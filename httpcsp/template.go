@@ -0,0 +1,33 @@
+package httpcsp
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+)
+
+// FuncMap returns the template functions of a request: cspNonce returns its nonce, for
+// nonce="{{cspNonce}}" attributes, and cspHash returns the 'sha256-…' source of a string
+func FuncMap(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string { return Nonce(ctx) },
+		"cspHash":  func(content string) string { return ComputeHash(content, SHA256) },
+	}
+}
+
+// Funcs returns the template functions with no request, to parse templates before they
+// are bound to a request by ForRequest
+func Funcs() template.FuncMap {
+	return FuncMap(context.Background())
+}
+
+// ForRequest returns a copy of a parsed template whose functions use the nonce of r.
+// The template must have been parsed with Funcs and must not be executed itself, as
+// html/template cannot clone a template after it has been executed.
+func ForRequest(t *template.Template, r *http.Request) (*template.Template, error) {
+	clone, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(FuncMap(r.Context())), nil
+}
@@ -0,0 +1,45 @@
+package httpcsp
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForRequest(t *testing.T) {
+	page := template.Must(template.New("page").Funcs(Funcs()).Parse(
+		`<script nonce="{{cspNonce}}">go()</script><meta name="hash" content="{{cspHash "go()"}}">`))
+
+	m, err := New(Options{Policy: "default-src 'self'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonce string
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r.Context())
+		tmpl, err := ForRequest(page, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tmpl.Execute(w, nil); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+		}
+
+		body := html.UnescapeString(rec.Body.String())
+		expected := `<script nonce="` + nonce + `">go()</script><meta name="hash" content="` + ComputeHash("go()", SHA256) + `">`
+		if body != expected {
+			t.Errorf("Expected %q, got %q", expected, body)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONFormatVersion is the version of the --format json document. It is incremented
+// only when a field is removed or changes meaning; new fields may be added at any time.
+const JSONFormatVersion = 1
+
+// JSONDirective is a directive and its sources
+type JSONDirective struct {
+	Name    string   `json:"name"`
+	Sources []string `json:"sources"`
+}
+
+// JSONPolicy is a policy as a header string and per directive, with optional validation results
+type JSONPolicy struct {
+	Header     string            `json:"header"`
+	Directives []JSONDirective   `json:"directives"`
+	Validation *ValidationResult `json:"validation,omitempty"`
+}
+
+// JSONDocument is the document written by --format json
+type JSONDocument struct {
+	Version    int                 `json:"version"`
+	Input      JSONPolicy          `json:"input"`
+	Output     *JSONPolicy         `json:"output,omitempty"`
+	Changes    []DirectiveChange   `json:"changes,omitempty"`
+	Files      []FileReport        `json:"files,omitempty"`
+	Hashes     []HashInfo          `json:"hashes,omitempty"`
+	External   *ExternalResources  `json:"external_resources,omitempty"`
+	Domains    []string            `json:"domains,omitempty"`
+	Heuristics []HeuristicResource `json:"heuristics,omitempty"`
+	Nonce      string              `json:"nonce,omitempty"`   // build nonce used with --nonce
+	Headers    []HeaderField       `json:"headers,omitempty"` // response headers with --report-only, --dual or --report-endpoint
+}
+
+// NewJSONPolicy converts a CSP header to its JSON form, validating it unless validate is false
+func NewJSONPolicy(header string, validate bool) JSONPolicy {
+	policy := ParsePolicy(header)
+	jp := JSONPolicy{Header: policy.String(), Directives: []JSONDirective{}}
+	for _, d := range policy.Directives {
+		jp.Directives = append(jp.Directives, JSONDirective{Name: d.Name, Sources: d.Values()})
+	}
+
+	if validate {
+		result := ValidateCSP(header)
+		if result.Warnings == nil {
+			result.Warnings = []ValidationWarning{}
+		}
+		jp.Validation = &result
+	}
+	return jp
+}
+
+// NewJSONDocument assembles the JSON document for a generation run
+func NewJSONDocument(inputCSP, outputCSP string, validate bool, files []FileReport, hashes []HashInfo, resources *ExternalResources, heuristics []HeuristicResource) *JSONDocument {
+	output := NewJSONPolicy(outputCSP, validate)
+	doc := &JSONDocument{
+		Version:    JSONFormatVersion,
+		Input:      NewJSONPolicy(inputCSP, validate),
+		Output:     &output,
+		Changes:    DiffPolicies(ParsePolicy(inputCSP), ParsePolicy(outputCSP)),
+		Files:      files,
+		Hashes:     hashes,
+		External:   resources,
+		Heuristics: heuristics,
+	}
+	if resources != nil {
+		doc.Domains = resources.GetUniqueDomains()
+	}
+	return doc
+}
+
+// WriteJSON writes v as indented JSON followed by a newline
+func WriteJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewJSONPolicy(t *testing.T) {
+	jp := NewJSONPolicy("default-src 'self'; upgrade-insecure-requests; script-src 'unsafe-eval'", true)
+
+	if jp.Header != "default-src 'self'; upgrade-insecure-requests; script-src 'unsafe-eval'" {
+		t.Errorf("Unexpected header: %s", jp.Header)
+	}
+	if len(jp.Directives) != 3 {
+		t.Fatalf("Expected 3 directives, got %d", len(jp.Directives))
+	}
+	if jp.Directives[1].Name != "upgrade-insecure-requests" || jp.Directives[1].Sources == nil || len(jp.Directives[1].Sources) != 0 {
+		t.Errorf("Expected value-less directive with empty sources, got %+v", jp.Directives[1])
+	}
+	if jp.Validation == nil || len(jp.Validation.Warnings) == 0 {
+		t.Fatal("Expected validation warnings for 'unsafe-eval'")
+	}
+
+	if NewJSONPolicy("default-src 'self'", false).Validation != nil {
+		t.Error("Expected no validation when disabled")
+	}
+}
+
+func TestJSONDocumentEncoding(t *testing.T) {
+	hashes := []HashInfo{{Hash: "'sha256-abc='", ContentType: "script", SourceFile: "index.html", Content: "full content", Snippet: "full content"}}
+	resources := &ExternalResources{
+		Scripts:      []ExternalResource{{Type: "script", URL: "https://cdn.example.com/app.js", Domain: "https://cdn.example.com"}},
+		UsesDataURLs: map[string]bool{"image": true},
+	}
+	heuristics := []HeuristicResource{{URL: "https://fonts.gstatic.com", Type: "font", Confidence: "high", Reason: "Google Fonts"}}
+	files := []FileReport{{File: "index.html", Scripts: 1, Domains: []string{"https://cdn.example.com"}}}
+
+	doc := NewJSONDocument("script-src 'self'", "script-src 'self' 'sha256-abc='", true, files, hashes, resources, heuristics)
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if decoded["version"] != float64(JSONFormatVersion) {
+		t.Errorf("Expected version %d, got %v", JSONFormatVersion, decoded["version"])
+	}
+	for _, key := range []string{"input", "output", "changes", "files", "hashes", "external_resources", "domains", "heuristics"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("Expected key %q in JSON document", key)
+		}
+	}
+
+	hash := decoded["hashes"].([]any)[0].(map[string]any)
+	if hash["type"] != "script" || hash["file"] != "index.html" || hash["snippet"] != "full content" {
+		t.Errorf("Unexpected hash entry: %v", hash)
+	}
+	if _, ok := hash["Content"]; ok {
+		t.Error("Full content should not be part of the JSON document")
+	}
+
+	// Quotes in sources must not be HTML-escaped
+	if !strings.Contains(buf.String(), `"'sha256-abc='"`) {
+		t.Errorf("Expected unescaped hash source in output:\n%s", buf.String())
+	}
+
+	changes := decoded["changes"].([]any)
+	if len(changes) != 1 || changes[0].(map[string]any)["status"] != ChangeModified {
+		t.Errorf("Expected one modified directive, got %v", changes)
+	}
+}
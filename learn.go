@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of LearnFinding
+const (
+	FindingInline      = "inline"
+	FindingEval        = "eval"
+	FindingTrustedType = "trusted-types"
+	FindingDynamic     = "strict-dynamic"
+)
+
+// learnedSchemes are the schemes whose blocked URLs are allowed by a source. Others,
+// such as chrome-extension:, come from browser extensions injecting into the page.
+var learnedSchemes = map[string]bool{
+	"http": true, "https": true, "ws": true, "wss": true,
+	"data": true, "blob": true, "filesystem": true, "mediastream": true,
+}
+
+// LearnOptions configures how violations turn into policy changes
+type LearnOptions struct {
+	MinCount int // sources reported by fewer violations are not proposed
+}
+
+// LearnedSource is a source proposed for a directive, with the violations it resolves
+type LearnedSource struct {
+	Directive   string   `json:"directive"`
+	Source      string   `json:"source"`
+	Count       int      `json:"count"`
+	BlockedURLs []string `json:"blockedURLs"` // distinct blocked URLs, in order of first report
+}
+
+// LearnFinding is a group of violations that adding a source should not fix, such as
+// inline code that needs a hash or a refactoring
+type LearnFinding struct {
+	Kind      string   `json:"kind"` // one of the Finding* constants
+	Directive string   `json:"directive"`
+	Count     int      `json:"count"`
+	Documents []string `json:"documents"`         // distinct document URLs
+	Samples   []string `json:"samples,omitempty"` // distinct code samples, truncated by the browser
+	Locations []string `json:"locations,omitempty"`
+	Advice    string   `json:"advice"`
+}
+
+// LearnResult is the outcome of learning from violations: the modifications to apply to
+// the policy, the sources they add, the violations left for review and the reviewed policy
+type LearnResult struct {
+	Violations    int               `json:"violations"`
+	Ignored       int               `json:"ignored"` // from extensions, already allowed, below the minimum count or not restricted
+	Modifications []CSPModification `json:"modifications"`
+	Sources       []LearnedSource   `json:"sources"`
+	Findings      []LearnFinding    `json:"findings"`
+	Policy        string            `json:"policy"` // the policy with the modifications applied
+}
+
+// Learn proposes changes to a policy that would allow the resources its violations
+// report. Sources are added to the directive that blocked them; when that is
+// default-src, the specific directive is created from a copy of default-src instead,
+// so that other resource types are not allowed too. Inline code, eval and the like are
+// reported as findings rather than allowed.
+func Learn(cspHeader string, violations []Violation, opts LearnOptions) *LearnResult {
+	policy := ParsePolicy(cspHeader)
+	result := &LearnResult{Violations: len(violations), Modifications: []CSPModification{}, Sources: []LearnedSource{}, Findings: []LearnFinding{}}
+
+	sources := map[[2]string]*LearnedSource{}
+	var sourceOrder [][2]string
+	findings := map[[2]string]*LearnFinding{}
+	var findingOrder [][2]string
+	addFinding := func(kind, directive string, v Violation, advice string) {
+		key := [2]string{kind, directive}
+		f, ok := findings[key]
+		if !ok {
+			f = &LearnFinding{Kind: kind, Directive: directive, Advice: advice}
+			findings[key] = f
+			findingOrder = append(findingOrder, key)
+		}
+		f.Count++
+		f.Documents = appendUnique(f.Documents, v.DocumentURL)
+		if v.Sample != "" {
+			f.Samples = appendUnique(f.Samples, v.Sample)
+		}
+		if v.SourceFile != "" {
+			f.Locations = appendUnique(f.Locations, fmt.Sprintf("%s:%d:%d", v.SourceFile, v.Line, v.Column))
+		}
+	}
+
+	for _, v := range violations {
+		governing := policy.Effective(v.Directive)
+		if v.Directive == "" || governing == nil {
+			result.Ignored++
+			continue
+		}
+
+		blocked := strings.ToLower(strings.TrimSpace(v.BlockedURL))
+		switch blocked {
+		case "inline":
+			addFinding(FindingInline, v.Directive, v, inlineAdvice(v.Directive))
+			continue
+		case "eval", "wasm-eval":
+			addFinding(FindingEval, v.Directive, v, "The page evaluates strings as code (eval, new Function, string timers); refactor it rather than adding 'unsafe-eval'")
+			continue
+		case "trusted-types-policy", "trusted-types-sink":
+			addFinding(FindingTrustedType, v.Directive, v, "A Trusted Types policy or sink was blocked; declare the policy name in trusted-types or pass a TrustedHTML/TrustedScript value")
+			continue
+		}
+
+		source := learnedSource(v.BlockedURL, v.DocumentURL)
+		if source == "" {
+			result.Ignored++
+			continue
+		}
+		if governing.Has("'strict-dynamic'") && strings.HasPrefix(governing.Name, "script-src") && !strings.HasSuffix(source, ":") {
+			addFinding(FindingDynamic, v.Directive, v, "'strict-dynamic' ignores host sources; load the script from a trusted script or give it a nonce or hash")
+			continue
+		}
+		if governing.Has(source) {
+			result.Ignored++
+			continue
+		}
+
+		directive := governing.Name
+		if directive == "default-src" {
+			directive = baseDirective(v.Directive)
+		}
+		key := [2]string{directive, source}
+		s, ok := sources[key]
+		if !ok {
+			s = &LearnedSource{Directive: directive, Source: source}
+			sources[key] = s
+			sourceOrder = append(sourceOrder, key)
+		}
+		s.Count++
+		s.BlockedURLs = appendUnique(s.BlockedURLs, v.BlockedURL)
+	}
+
+	// Propose sources by directive, in a stable order
+	sort.SliceStable(sourceOrder, func(i, j int) bool {
+		if sourceOrder[i][0] != sourceOrder[j][0] {
+			return sourceOrder[i][0] < sourceOrder[j][0]
+		}
+		return sourceOrder[i][1] < sourceOrder[j][1]
+	})
+	created := map[string]bool{}
+	for _, key := range sourceOrder {
+		s := sources[key]
+		if s.Count < opts.MinCount {
+			result.Ignored += s.Count
+			continue
+		}
+		if policy.Get(s.Directive) == nil && !created[s.Directive] {
+			created[s.Directive] = true
+			if defaultSrc := policy.Get("default-src"); defaultSrc != nil {
+				for _, value := range defaultSrc.Values() {
+					if value != "'none'" {
+						result.Modifications = append(result.Modifications, CSPModification{Action: "add", Directive: s.Directive, Value: value})
+					}
+				}
+			}
+		}
+		result.Modifications = append(result.Modifications, CSPModification{Action: "add", Directive: s.Directive, Value: s.Source})
+		result.Sources = append(result.Sources, *s)
+	}
+
+	for _, key := range findingOrder {
+		result.Findings = append(result.Findings, *findings[key])
+	}
+	result.Policy = ApplyCSPModifications(cspHeader, result.Modifications)
+	return result
+}
+
+// learnedSource returns the source allowing a blocked URL loaded by a document: 'self'
+// for the document's origin, the scheme for data:, blob: and the like, or the origin of
+// the blocked URL. It returns "" for browser extensions and relative or invalid URLs.
+func learnedSource(blockedURL, documentURL string) string {
+	blocked, err := url.Parse(strings.TrimSpace(blockedURL))
+	if err != nil {
+		return ""
+	}
+
+	// Reports may give a scheme without a colon, e.g. "data" for data: URLs
+	scheme := strings.ToLower(blocked.Scheme)
+	if scheme == "" && blocked.Host == "" {
+		scheme = strings.ToLower(blocked.Path)
+	}
+	switch {
+	case !learnedSchemes[scheme]:
+		return ""
+	case scheme != "http" && scheme != "https" && scheme != "ws" && scheme != "wss":
+		return scheme + ":"
+	case blocked.Host == "":
+		return ""
+	}
+
+	origin := scheme + "://" + strings.ToLower(blocked.Host)
+	if document, err := url.Parse(documentURL); err == nil && strings.ToLower(document.Scheme)+"://"+strings.ToLower(document.Host) == origin {
+		return "'self'"
+	}
+	return origin
+}
+
+// baseDirective returns the directive to create for an effective directive that fell
+// back to default-src: the -elem and -attr variants use their common directive
+func baseDirective(effective string) string {
+	for _, base := range []string{"script-src", "style-src"} {
+		if strings.HasPrefix(effective, base+"-") {
+			return base
+		}
+	}
+	return effective
+}
+
+// inlineAdvice explains how to allow the inline code blocked by a directive
+func inlineAdvice(directive string) string {
+	switch {
+	case strings.HasSuffix(directive, "-attr") && strings.HasPrefix(directive, "script-src"):
+		return "An inline event handler was blocked; replace it with --delegate-handlers, or hash the page with csp so that 'unsafe-hashes' allows it"
+	case strings.HasSuffix(directive, "-attr"):
+		return "A style attribute was blocked; replace it with --style-classes, or hash the page with csp so that 'unsafe-hashes' allows it"
+	case strings.HasPrefix(directive, "style-src"):
+		return "An inline <style> was blocked; hash the page with csp, give it a nonce or move it into a file with --externalize"
+	}
+	return "An inline <script> was blocked; hash the page with csp, give it a nonce or move it into a file with --externalize"
+}
+
+// appendUnique appends s to list unless it is already present
+func appendUnique(list []string, s string) []string {
+	if containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+// ReadReports reads violations from a file or from the directory written by csp collect.
+// Files hold violation records or raw reports, as one JSON document or one per line:
+// csp-report objects, Reporting API batches or single Reporting API reports.
+func ReadReports(path string) ([]Violation, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return ReadViolations(path, time.Time{})
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reports: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if trimmed := bytes.TrimSpace(data); json.Valid(trimmed) {
+		violations, err := parseReportDocument(trimmed, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return violations, nil
+	}
+
+	var violations []Violation
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		parsed, err := parseReportDocument(line, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		violations = append(violations, parsed...)
+	}
+	return violations, nil
+}
+
+// parseReportDocument converts one JSON document holding reports or a violation record
+func parseReportDocument(data []byte, now time.Time) ([]Violation, error) {
+	if data[0] == '[' {
+		return parseReportBatch(data, now)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	switch {
+	case fields["csp-report"] != nil:
+		return parseLegacyReport(data, now)
+	case fields["type"] != nil && fields["body"] != nil:
+		return parseReportBatch(append(append([]byte("["), data...), ']'), now)
+	case fields["directive"] != nil:
+		var v Violation
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("invalid violation record: %w", err)
+		}
+		return []Violation{v}, nil
+	}
+	return nil, fmt.Errorf("not a report or violation record")
+}
+
+// PrintLearnResult prints the proposed modifications as flags, the findings to review
+// and the reviewed policy
+func PrintLearnResult(w io.Writer, result *LearnResult, serializeOpts SerializeOptions) {
+	fmt.Fprintf(w, "Learned from %d violation(s), %d ignored\n", result.Violations, result.Ignored)
+
+	if len(result.Modifications) > 0 {
+		fmt.Fprintln(w, "\nProposed changes:")
+		counts := map[[2]string]int{}
+		for _, s := range result.Sources {
+			counts[[2]string{s.Directive, s.Source}] = s.Count
+		}
+		for _, mod := range result.Modifications {
+			note := "copied from default-src"
+			if count, ok := counts[[2]string{mod.Directive, mod.Value}]; ok {
+				note = fmt.Sprintf("%d violation(s)", count)
+			}
+			fmt.Fprintf(w, "  --%s-%s %s  (%s)\n", mod.Action, mod.Directive, shellQuote(mod.Value), note)
+		}
+	}
+
+	if len(result.Findings) > 0 {
+		fmt.Fprintln(w, "\nNeeds review:")
+		for _, f := range result.Findings {
+			documents := f.Documents
+			more := ""
+			if len(documents) > maxListedDocuments {
+				more = fmt.Sprintf(" and %d more", len(documents)-maxListedDocuments)
+				documents = documents[:maxListedDocuments]
+			}
+			fmt.Fprintf(w, "  %s %s (%d violation(s)) on %s%s\n", f.Kind, f.Directive, f.Count, strings.Join(documents, ", "), more)
+			for _, location := range f.Locations {
+				fmt.Fprintf(w, "    at %s\n", location)
+			}
+			for _, sample := range f.Samples {
+				fmt.Fprintf(w, "    sample: %q\n", sample)
+			}
+			fmt.Fprintf(w, "    %s\n", f.Advice)
+		}
+	}
+
+	fmt.Fprintln(w, "\nReviewed policy:")
+	fmt.Fprintln(w, ParsePolicy(result.Policy).Serialize(serializeOpts))
+}
+
+// shellQuote quotes a source for a shell command line when it contains quotes
+func shellQuote(value string) string {
+	if strings.ContainsAny(value, `'"*;$ `) {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// runLearn implements the "csp learn" subcommand: it proposes the policy changes that
+// would allow the violations of collected reports. It returns the process exit code.
+func runLearn(args []string) int {
+	fs := flag.NewFlagSet("learn", flag.ContinueOnError)
+	var reportPaths stringList
+	fs.Var(&reportPaths, "reports", "Violations written by csp collect (file or directory), or raw report JSON (can be repeated)")
+	cspFlag := fs.String("csp", "", "Policy the reports were sent for")
+	minCount := fs.Int("min-count", 1, "Only propose sources reported by at least this many violations")
+	format := fs.String("format", "text", "Output format: text or json (the modifications can be pasted into "+configFileName+")")
+	canonical := fs.Bool("canonical", false, "Output directives in canonical order with normalized, de-duplicated sources")
+	pretty := fs.Bool("pretty", false, "Output one directive per line for human review")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: csp learn --reports FILE --csp \"CSP_HEADER\" [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Propose the changes that would allow the resources blocked in violation reports,\n")
+		fmt.Fprintf(os.Stderr, "as --add-* modifications and the reviewed policy. Inline code, eval and Trusted\n")
+		fmt.Fprintf(os.Stderr, "Types violations are listed for review instead.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  csp learn --reports csp-reports/ --csp \"$(cat csp-header.txt)\"\n")
+		fmt.Fprintf(os.Stderr, "  csp learn --reports reports.json --csp \"default-src 'self'\" --min-count 5 --format json\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(reportPaths) == 0 || *cspFlag == "" || fs.NArg() > 0 || (*format != "text" && *format != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	var violations []Violation
+	for _, path := range reportPaths {
+		read, err := ReadReports(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		violations = append(violations, read...)
+	}
+
+	result := Learn(*cspFlag, violations, LearnOptions{MinCount: *minCount})
+	serializeOpts := SerializeOptions{Canonical: *canonical, Pretty: *pretty}
+	if *format == "json" {
+		serializeOpts.Pretty = false
+		result.Policy = ParsePolicy(result.Policy).Serialize(serializeOpts)
+		if err := WriteJSON(os.Stdout, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	PrintLearnResult(os.Stdout, result, serializeOpts)
+	return 0
+}
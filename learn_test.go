@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLearn(t *testing.T) {
+	violation := func(directive, blocked string) Violation {
+		return Violation{DocumentURL: "https://example.com/page", Directive: directive, BlockedURL: blocked}
+	}
+
+	tests := []struct {
+		name          string
+		csp           string
+		violations    []Violation
+		opts          LearnOptions
+		modifications []CSPModification
+		policy        string
+		findings      []string // kind and directive of each finding
+		ignored       int
+	}{
+		{
+			name: "host sources on the blocking directive",
+			csp:  "default-src 'self'; script-src 'self'",
+			violations: []Violation{
+				violation("script-src-elem", "https://CDN.example.com/lib.js?v=1"),
+				violation("script-src-elem", "https://cdn.example.com/other.js"),
+				violation("script-src-elem", "https://example.com/app.js"),
+			},
+			modifications: []CSPModification{
+				{Action: "add", Directive: "script-src", Value: "https://cdn.example.com"},
+			},
+			policy:  "default-src 'self'; script-src 'self' https://cdn.example.com",
+			ignored: 1,
+		},
+		{
+			name: "directive created from default-src",
+			csp:  "default-src 'self' https://static.example.com",
+			violations: []Violation{
+				violation("img-src", "data"),
+				violation("style-src-elem", "https://fonts.googleapis.com/css?family=x"),
+			},
+			modifications: []CSPModification{
+				{Action: "add", Directive: "img-src", Value: "'self'"},
+				{Action: "add", Directive: "img-src", Value: "https://static.example.com"},
+				{Action: "add", Directive: "img-src", Value: "data:"},
+				{Action: "add", Directive: "style-src", Value: "'self'"},
+				{Action: "add", Directive: "style-src", Value: "https://static.example.com"},
+				{Action: "add", Directive: "style-src", Value: "https://fonts.googleapis.com"},
+			},
+			policy: "default-src 'self' https://static.example.com; img-src 'self' https://static.example.com data:; style-src 'self' https://static.example.com https://fonts.googleapis.com",
+		},
+		{
+			name: "default-src 'none' is not copied",
+			csp:  "default-src 'none'",
+			violations: []Violation{
+				violation("connect-src", "wss://live.example.com/socket"),
+			},
+			modifications: []CSPModification{
+				{Action: "add", Directive: "connect-src", Value: "wss://live.example.com"},
+			},
+			policy: "default-src 'none'; connect-src wss://live.example.com",
+		},
+		{
+			name: "inline, eval and trusted types are findings",
+			csp:  "script-src 'self'; style-src 'self'; require-trusted-types-for 'script'",
+			violations: []Violation{
+				violation("script-src-elem", "inline"),
+				violation("script-src-attr", "inline"),
+				violation("style-src-attr", "inline"),
+				violation("script-src", "eval"),
+				violation("script-src-elem", "inline"),
+				violation("require-trusted-types-for", "trusted-types-sink"),
+			},
+			policy:   "script-src 'self'; style-src 'self'; require-trusted-types-for 'script'",
+			findings: []string{"inline script-src-elem", "inline script-src-attr", "inline style-src-attr", "eval script-src", "trusted-types require-trusted-types-for"},
+		},
+		{
+			name: "strict-dynamic ignores host sources",
+			csp:  "script-src 'nonce-abc' 'strict-dynamic'; img-src 'self'",
+			violations: []Violation{
+				violation("script-src-elem", "https://cdn.example.com/lib.js"),
+			},
+			policy:   "script-src 'nonce-abc' 'strict-dynamic'; img-src 'self'",
+			findings: []string{"strict-dynamic script-src-elem"},
+		},
+		{
+			name: "extensions, allowed sources and unrestricted directives are ignored",
+			csp:  "script-src 'self' https://cdn.example.com",
+			violations: []Violation{
+				violation("script-src-elem", "chrome-extension://abcdef/inject.js"),
+				violation("script-src-elem", "https://cdn.example.com/lib.js"),
+				violation("img-src", "https://img.example.com/a.png"),
+				violation("script-src-elem", ""),
+			},
+			policy:  "script-src 'self' https://cdn.example.com",
+			ignored: 4,
+		},
+		{
+			name: "minimum count",
+			csp:  "img-src 'self'",
+			violations: []Violation{
+				violation("img-src", "https://a.example.com/1.png"),
+				violation("img-src", "https://a.example.com/2.png"),
+				violation("img-src", "https://b.example.com/1.png"),
+			},
+			opts: LearnOptions{MinCount: 2},
+			modifications: []CSPModification{
+				{Action: "add", Directive: "img-src", Value: "https://a.example.com"},
+			},
+			policy:  "img-src 'self' https://a.example.com",
+			ignored: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Learn(tt.csp, tt.violations, tt.opts)
+			if tt.modifications == nil {
+				tt.modifications = []CSPModification{}
+			}
+			if !reflect.DeepEqual(result.Modifications, tt.modifications) {
+				t.Errorf("Expected modifications %v, got %v", tt.modifications, result.Modifications)
+			}
+			if result.Policy != tt.policy {
+				t.Errorf("Expected policy %q, got %q", tt.policy, result.Policy)
+			}
+			if result.Policy != ApplyCSPModifications(tt.csp, result.Modifications) {
+				t.Error("Expected the policy to be the modifications applied to the input")
+			}
+			var findings []string
+			for _, f := range result.Findings {
+				findings = append(findings, f.Kind+" "+f.Directive)
+			}
+			if !reflect.DeepEqual(findings, tt.findings) {
+				t.Errorf("Expected findings %v, got %v", tt.findings, findings)
+			}
+			if result.Ignored != tt.ignored {
+				t.Errorf("Expected %d ignored, got %d", tt.ignored, result.Ignored)
+			}
+		})
+	}
+}
+
+func TestLearnedSource(t *testing.T) {
+	tests := []struct {
+		blocked  string
+		expected string
+	}{
+		{"https://cdn.example.com:8443/a.js", "https://cdn.example.com:8443"},
+		{"https://example.com/a.js", "'self'"},
+		{"http://example.com/a.js", "http://example.com"},
+		{"data", "data:"},
+		{"blob:https://example.com/uuid", "blob:"},
+		{"moz-extension://uuid/a.js", ""},
+		{"/relative.js", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if result := learnedSource(tt.blocked, "https://example.com/page"); result != tt.expected {
+			t.Errorf("learnedSource(%q) = %q, expected %q", tt.blocked, result, tt.expected)
+		}
+	}
+}
+
+func TestLearnFindingDetails(t *testing.T) {
+	violations := []Violation{
+		{DocumentURL: "https://example.com/", Directive: "script-src-elem", BlockedURL: "inline", Sample: "alert(1)", SourceFile: "https://example.com/", Line: 3, Column: 9},
+		{DocumentURL: "https://example.com/about", Directive: "script-src-elem", BlockedURL: "inline", Sample: "alert(1)", SourceFile: "https://example.com/", Line: 3, Column: 9},
+	}
+	result := Learn("script-src 'self'", violations, LearnOptions{})
+
+	expected := []LearnFinding{{
+		Kind:      FindingInline,
+		Directive: "script-src-elem",
+		Count:     2,
+		Documents: []string{"https://example.com/", "https://example.com/about"},
+		Samples:   []string{"alert(1)"},
+		Locations: []string{"https://example.com/:3:9"},
+		Advice:    inlineAdvice("script-src-elem"),
+	}}
+	if !reflect.DeepEqual(result.Findings, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result.Findings)
+	}
+}
+
+func TestReadReports(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name       string
+		content    string
+		directives []string
+		err        string
+	}{
+		{
+			name:       "violation records",
+			content:    `{"time":"2026-01-01T00:00:00Z","directive":"img-src","blockedURL":"data"}` + "\n" + `{"directive":"font-src"}` + "\n",
+			directives: []string{"img-src", "font-src"},
+		},
+		{
+			name:       "raw legacy report",
+			content:    "{\n  \"csp-report\": {\n    \"document-uri\": \"https://example.com/\",\n    \"violated-directive\": \"frame-src\"\n  }\n}\n",
+			directives: []string{"frame-src"},
+		},
+		{
+			name:       "reporting API batch",
+			content:    reportBatchBody,
+			directives: []string{"style-src-attr"},
+		},
+		{
+			name: "mixed report lines",
+			content: `{"csp-report": {"document-uri": "https://example.com/", "effective-directive": "img-src"}}` + "\n" +
+				`{"type": "csp-violation", "url": "https://example.com/", "body": {"effectiveDirective": "connect-src"}}` + "\n" +
+				`[{"type": "csp-violation", "body": {"documentURL": "https://example.com/", "effectiveDirective": "media-src"}}]` + "\n",
+			directives: []string{"img-src", "connect-src", "media-src"},
+		},
+		{
+			name:    "unknown document",
+			content: `{"hello": "world"}` + "\n" + `{"directive": "img-src"}` + "\n",
+			err:     "unknown document.json:1: not a report or violation record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := write(tt.name+".json", tt.content)
+			violations, err := ReadReports(path)
+			if tt.err != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+					t.Fatalf("Expected error ending in %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var directives []string
+			for _, v := range violations {
+				directives = append(directives, v.Directive)
+			}
+			if !reflect.DeepEqual(directives, tt.directives) {
+				t.Errorf("Expected directives %v, got %v", tt.directives, directives)
+			}
+		})
+	}
+}
+
+func TestPrintLearnResult(t *testing.T) {
+	result := Learn("default-src 'self'", []Violation{
+		{DocumentURL: "https://example.com/", Directive: "img-src", BlockedURL: "https://img.example.com/a.png"},
+		{DocumentURL: "https://example.com/", Directive: "script-src", BlockedURL: "eval"},
+	}, LearnOptions{})
+
+	var out strings.Builder
+	PrintLearnResult(&out, result, SerializeOptions{})
+	expected := "Learned from 2 violation(s), 0 ignored\n" +
+		"\nProposed changes:\n" +
+		"  --add-img-src \"'self'\"  (copied from default-src)\n" +
+		"  --add-img-src https://img.example.com  (1 violation(s))\n" +
+		"\nNeeds review:\n" +
+		"  eval script-src (1 violation(s)) on https://example.com/\n" +
+		"    The page evaluates strings as code (eval, new Function, string timers); refactor it rather than adding 'unsafe-eval'\n" +
+		"\nReviewed policy:\n" +
+		"default-src 'self'; img-src 'self' https://img.example.com\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// sourceTag is a start tag and its position in the HTML source
+type sourceTag struct {
+	Name         string
+	Attrs        []html.Attribute
+	Line         int
+	Column       int
+	Start        int             // byte offset of the start tag
+	End          int             // byte offset just past the start tag
+	ContentStart int             // byte range of the raw text of <script> and <style> elements,
+	ContentEnd   int             // empty (at End) for other elements
+	SelfClosing  bool            // the tag was written as <tag/>
+	contentUsed  bool            // element content has been matched to an inline item
+	attrsUsed    map[string]bool // attributes that have been matched to an inline item
+	changed      bool            // Attrs has been changed by a rewrite
+	origAttrs    []html.Attribute
+}
+
+// scanSourceTags tokenizes HTML source and returns every start tag with its 1-based line
+// and column. The tree parser does not keep positions, so findings are mapped back to
+// the source through this list.
+func scanSourceTags(source []byte) []*sourceTag {
+	tags := []*sourceTag{}
+	z := html.NewTokenizer(bytes.NewReader(source))
+	offset := 0
+	var rawTextTag *sourceTag // <script> or <style> whose content is the next token
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return tags
+		}
+		raw := len(z.Raw())
+
+		if rawTextTag != nil {
+			if tt == html.TextToken {
+				rawTextTag.ContentEnd = offset + raw
+			}
+			rawTextTag = nil
+		}
+
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			token := z.Token()
+			line, column := lineAndColumn(source, offset)
+			tag := &sourceTag{
+				Name:         token.Data,
+				Attrs:        token.Attr,
+				Line:         line,
+				Column:       column,
+				Start:        offset,
+				End:          offset + raw,
+				ContentStart: offset + raw,
+				ContentEnd:   offset + raw,
+				SelfClosing:  tt == html.SelfClosingTagToken,
+				attrsUsed:    map[string]bool{},
+			}
+			tags = append(tags, tag)
+			if tt == html.StartTagToken && (tag.Name == "script" || tag.Name == "style") {
+				rawTextTag = tag
+			}
+		}
+		offset += raw
+	}
+}
+
+// lineAndColumn converts a byte offset to a 1-based line and (rune) column
+func lineAndColumn(source []byte, offset int) (int, int) {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	before := source[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// locateInlineItems sets the position of each inline item by matching it, in document
+// order, to the start tag it came from. Items that cannot be matched keep line 0.
+func locateInlineItems(tags []*sourceTag, items []InlineContent) {
+	cursor := 0
+	for i := range items {
+		item := &items[i]
+		for j := cursor; j < len(tags); j++ {
+			tag := tags[j]
+			if tag.Name != item.Element {
+				continue
+			}
+
+			if item.Attribute == "" {
+				if tag.contentUsed || (tag.Name == "script" && hasSourceAttr(tag, "src")) {
+					continue
+				}
+				tag.contentUsed = true
+			} else {
+				if tag.attrsUsed[item.Attribute] || !hasSourceAttrValue(tag, item.Attribute, item.Content) {
+					continue
+				}
+				tag.attrsUsed[item.Attribute] = true
+			}
+
+			item.Line, item.Column = tag.Line, tag.Column
+			cursor = j
+			break
+		}
+	}
+}
+
+// locateURL returns the position of the first start tag with an attribute whose value
+// contains the URL, or 0, 0 if none does (e.g. for url() references inside CSS)
+func locateURL(tags []*sourceTag, target string) (int, int) {
+	for _, tag := range tags {
+		for _, attr := range tag.Attrs {
+			if attr.Key != "style" && attr.Val == target {
+				return tag.Line, tag.Column
+			}
+		}
+	}
+	return 0, 0
+}
+
+// hasSourceAttr reports whether a source tag has the attribute
+func hasSourceAttr(tag *sourceTag, key string) bool {
+	for _, attr := range tag.Attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// getSourceAttr returns the value of a start tag's attribute, or ""
+func getSourceAttr(tag *sourceTag, key string) string {
+	for _, attr := range tag.Attrs {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// hasSourceAttrValue reports whether a source tag has the attribute with the given value
+func hasSourceAttrValue(tag *sourceTag, key, value string) bool {
+	for _, attr := range tag.Attrs {
+		if attr.Key == key && attr.Val == value {
+			return true
+		}
+	}
+	return false
+}
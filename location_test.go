@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestLineAndColumn(t *testing.T) {
+	source := []byte("<a>\n  <b>\n<é><c>")
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 1},
+		{6, 2, 3},
+		{10, 3, 1},
+		{14, 3, 4}, // "é" is two bytes but one column
+		{100, 3, 7},
+	}
+	for _, tt := range tests {
+		line, column := lineAndColumn(source, tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("lineAndColumn(%d) = %d:%d, expected %d:%d", tt.offset, line, column, tt.line, tt.column)
+		}
+	}
+}
+
+func TestLocateInlineItems(t *testing.T) {
+	source := []byte("<script>a()</script>\n<script src=\"x.js\"></script>\n<script>a()</script>\n" +
+		"<button onclick=\"go()\">1</button>\n<button onclick=\"go()\">2</button>\n<p onclick=\"&quot;\"></p>")
+	items := []InlineContent{
+		{Type: ContentTypeScript, Content: "a()", Element: "script"},
+		{Type: ContentTypeScript, Content: "a()", Element: "script"},
+		{Type: ContentTypeEventHandler, Content: "go()", Element: "button", Attribute: "onclick"},
+		{Type: ContentTypeEventHandler, Content: "go()", Element: "button", Attribute: "onclick"},
+		{Type: ContentTypeEventHandler, Content: "\"", Element: "p", Attribute: "onclick"},
+		{Type: ContentTypeStyleAttr, Content: "color:red", Element: "div", Attribute: "style"},
+	}
+
+	locateInlineItems(scanSourceTags(source), items)
+
+	expectedLines := []int{1, 3, 4, 5, 6, 0}
+	for i, line := range expectedLines {
+		if items[i].Line != line {
+			t.Errorf("Item %d: expected line %d, got %d", i, line, items[i].Line)
+		}
+	}
+}
+
+func TestLocateURL(t *testing.T) {
+	tags := scanSourceTags([]byte("<html>\n<img src=\"/a.png\">\n<div style=\"background:url(/a.png)\"></div>"))
+
+	if line, column := locateURL(tags, "/a.png"); line != 2 || column != 1 {
+		t.Errorf("Expected 2:1, got %d:%d", line, column)
+	}
+	if line, _ := locateURL(tags, "/b.png"); line != 0 {
+		t.Errorf("Expected unknown location, got line %d", line)
+	}
+}
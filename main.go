@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -22,6 +23,18 @@ func (cml *CSPModificationList) Set(value string) error {
 	return nil
 }
 
+// stringList implements flag.Value to collect the values of a repeatable flag
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ", ")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
 // DirectiveModification creates a flag type for a specific directive and action
 func DirectiveModification(directive, action string) flag.Value {
 	return &directiveFlag{directive: directive, action: action, modifications: &[]CSPModification{}}
@@ -47,14 +60,37 @@ func (df *directiveFlag) Set(value string) error {
 }
 
 func main() {
+	// Dispatch subcommands before parsing the generator flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "proxy":
+			os.Exit(runProxy(os.Args[2:]))
+		case "collect":
+			os.Exit(runCollect(os.Args[2:]))
+		case "violations":
+			os.Exit(runViolations(os.Args[2:]))
+		case "learn":
+			os.Exit(runLearn(os.Args[2:]))
+		}
+	}
+
 	// Shared modifications list for all add/remove flags
 	var modifications []CSPModification
 
 	// Define command-line flags
 	cspFlag := flag.String("csp", "", "Existing CSP header to update with hashes (optional, defaults to --generate-strict)")
+	cspFile := flag.String("csp-file", "", "Read the existing CSP header from a file instead of --csp; SARIF output points the policy's warnings at it")
 	hashAlgo := flag.String("hash-algo", "sha256", "Hash algorithm to use: sha256, sha384, or sha512")
 	validateOnly := flag.Bool("validate-only", false, "Only validate the CSP without processing HTML files")
 	noValidate := flag.Bool("no-validate", false, "Skip CSP validation checks")
+	verifyOnly := flag.Bool("verify", false, "Report inline content and external resources the --csp policy would block, without updating it (exits 1 if anything is blocked)")
+	originFlag := flag.String("origin", "https://localhost", "Origin the HTML files are served from, used by --verify to resolve relative URLs and 'self'")
+	var reportMode bool
+	flag.BoolVar(&reportMode, "report", false, "Print per-file analysis and a before/after policy diff instead of the header")
+	flag.BoolVar(&reportMode, "dry-run", false, "Alias for --report")
+	effectiveOnly := flag.Bool("effective", false, "Print the effective policy enforced by a comma-separated --csp list without processing HTML files")
 	noScripts := flag.Bool("no-scripts", false, "Skip processing inline <script> elements")
 	noStyles := flag.Bool("no-styles", false, "Skip processing inline <style> tags")
 	noInlineStyles := flag.Bool("no-inline-styles", false, "Skip processing inline style attributes")
@@ -65,102 +101,59 @@ func main() {
 	requireTrustedTypes := flag.Bool("require-trusted-types", false, "Add require-trusted-types-for 'script' directive (requires Trusted Types API support)")
 	verbose := flag.Bool("verbose", false, "Show detailed information about hash generation")
 	verboseShort := flag.Bool("v", false, "Show detailed information about hash generation (short)")
+	canonical := flag.Bool("canonical", false, "Output directives in canonical order with normalized, de-duplicated sources")
+	sortSourceLists := flag.Bool("sort-sources", false, "Sort host and hash sources within each directive")
+	pretty := flag.Bool("pretty", false, "Output one directive per line for human review")
+	nonceMode := flag.Bool("nonce", false, "Tag inline <script> and <style> elements with a random nonce and use it in the policy instead of hashes (requires --out-dir)")
+	noncePlaceholder := flag.String("nonce-placeholder", "", "Like --nonce, but use a placeholder such as {{CSP_NONCE}} that the server replaces with a fresh nonce per response")
+	strictDynamic := flag.Bool("strict-dynamic", false, "With --nonce, add 'strict-dynamic' to script-src and tag external scripts with the nonce too")
+	metaTag := flag.Bool("meta-tag", false, "Use each file's <meta http-equiv=\"Content-Security-Policy\"> policy as its base and write the updated policy back into it, or insert one (requires --out-dir)")
+	externalizeMode := flag.Bool("externalize", false, "Move inline <script> and <style> elements into content-addressed files in --assets-dir and reference them from the pages (requires --out-dir)")
+	delegateHandlers := flag.Bool("delegate-handlers", false, "Replace inline event handler attributes with data-csp-handler ids and a generated script in --assets-dir that attaches the same handlers, so 'unsafe-hashes' is not needed (requires --out-dir)")
+	styleClassesMode := flag.Bool("style-classes", false, "Replace style attributes with generated classes in a single stylesheet in --assets-dir, so they need no hashes or 'unsafe-hashes' (requires --out-dir)")
+	forceStyleClasses := flag.Bool("force-style-classes", false, "With --style-classes, also convert the style attributes of pages with their own stylesheets, whose rules may then override the generated classes")
+	assetsDir := flag.String("assets-dir", "assets", "Directory inside --out-dir for the files written by --externalize, --delegate-handlers and --style-classes")
+	perPage := flag.Bool("per-page", false, "Compute a separate policy for each file, allowing only its own hashes and resources, for --meta-tag and --manifest")
+	manifestPath := flag.String("manifest", "", "Write a JSON manifest mapping the URL path of each file to its own policy (implies --per-page)")
+	groupByDir := flag.Bool("group-by-dir", false, "With --manifest, collapse the pages of a directory that share a policy into one /dir/* entry")
+	siteRoot := flag.String("site-root", "", "Directory served at / used for the --manifest URL paths (default: the directory argument if there is only one, else the working directory)")
+	emitFormat := flag.String("emit", "", "Print the server or hosting configuration sending the policy instead of the header, with a block per route with --per-page: "+strings.Join(EmitFormats(), ", "))
+	reportOnly := flag.Bool("report-only", false, "Print the policy as a Content-Security-Policy-Report-Only header, which reports violations without blocking them (also with --emit)")
+	dualMode := flag.Bool("dual", false, "Keep enforcing the --csp policy unchanged and print the strict policy for the pages as a Content-Security-Policy-Report-Only candidate next to it (implies --generate-strict)")
+	var reportEndpoints stringList
+	flag.Var(&reportEndpoints, "report-endpoint", "Reporting endpoint as name=URL: sets report-to name and adds report-uri URL to the policy, and prints the Reporting-Endpoints header (can be repeated, the policy reports to the first)")
+	legacyReportTo := flag.Bool("legacy-report-to", false, "With --report-endpoint, also print the Report-To header for browsers that predate Reporting-Endpoints")
+	outDir := flag.String("out-dir", "", "Directory to write rewritten HTML files to (used by --nonce, --meta-tag, --externalize, --delegate-handlers and --style-classes)")
+	var includePatterns, excludePatterns stringList
+	flag.Var(&includePatterns, "include", "Pattern of the files processed in directory arguments, with .gitignore syntax (can be repeated, default **/*.html and **/*.htm)")
+	flag.Var(&excludePatterns, "exclude", "Pattern of the files and directories skipped in directory arguments, with .gitignore syntax (can be repeated)")
+	configPath := flag.String("config", "", "JSON config file providing defaults for these options (default: "+configFileName+" in the working directory, if present)")
+	profile := flag.String("profile", "", "Apply a named profile of the config file on top of its top-level settings")
+	format := flag.String("format", "text", "Output format: text, json (a versioned document with policies, hashes, resources and warnings) or sarif (with --validate-only or --verify)")
+
+	// Register add/remove flags for every directive in the registry that takes a value
+	for _, info := range knownDirectives {
+		if info.NoValue || info.Deprecated {
+			continue
+		}
+		flag.Var(&directiveFlag{directive: info.Name, action: "add", modifications: &modifications},
+			"add-"+info.Name, fmt.Sprintf("Add value to %s directive (can be repeated, evaluated in order)", info.Name))
+		flag.Var(&directiveFlag{directive: info.Name, action: "remove", modifications: &modifications},
+			"remove-"+info.Name, fmt.Sprintf("Remove value from %s directive (can be repeated, evaluated in order)", info.Name))
+	}
 
-	// Create shared modifications list for add/remove directives
-	addScriptSrc := &directiveFlag{directive: "script-src", action: "add", modifications: &modifications}
-	removeScriptSrc := &directiveFlag{directive: "script-src", action: "remove", modifications: &modifications}
-	addStyleSrc := &directiveFlag{directive: "style-src", action: "add", modifications: &modifications}
-	removeStyleSrc := &directiveFlag{directive: "style-src", action: "remove", modifications: &modifications}
-	addImgSrc := &directiveFlag{directive: "img-src", action: "add", modifications: &modifications}
-	removeImgSrc := &directiveFlag{directive: "img-src", action: "remove", modifications: &modifications}
-	addFontSrc := &directiveFlag{directive: "font-src", action: "add", modifications: &modifications}
-	removeFontSrc := &directiveFlag{directive: "font-src", action: "remove", modifications: &modifications}
-	addConnectSrc := &directiveFlag{directive: "connect-src", action: "add", modifications: &modifications}
-	removeConnectSrc := &directiveFlag{directive: "connect-src", action: "remove", modifications: &modifications}
-	addManifestSrc := &directiveFlag{directive: "manifest-src", action: "add", modifications: &modifications}
-	removeManifestSrc := &directiveFlag{directive: "manifest-src", action: "remove", modifications: &modifications}
-	addWorkerSrc := &directiveFlag{directive: "worker-src", action: "add", modifications: &modifications}
-	removeWorkerSrc := &directiveFlag{directive: "worker-src", action: "remove", modifications: &modifications}
-	addFrameSrc := &directiveFlag{directive: "frame-src", action: "add", modifications: &modifications}
-	removeFrameSrc := &directiveFlag{directive: "frame-src", action: "remove", modifications: &modifications}
-	addDefaultSrc := &directiveFlag{directive: "default-src", action: "add", modifications: &modifications}
-	removeDefaultSrc := &directiveFlag{directive: "default-src", action: "remove", modifications: &modifications}
-	addObjectSrc := &directiveFlag{directive: "object-src", action: "add", modifications: &modifications}
-	removeObjectSrc := &directiveFlag{directive: "object-src", action: "remove", modifications: &modifications}
-	addMediaSrc := &directiveFlag{directive: "media-src", action: "add", modifications: &modifications}
-	removeMediaSrc := &directiveFlag{directive: "media-src", action: "remove", modifications: &modifications}
-	addBaseURI := &directiveFlag{directive: "base-uri", action: "add", modifications: &modifications}
-	removeBaseURI := &directiveFlag{directive: "base-uri", action: "remove", modifications: &modifications}
-	addFormAction := &directiveFlag{directive: "form-action", action: "add", modifications: &modifications}
-	removeFormAction := &directiveFlag{directive: "form-action", action: "remove", modifications: &modifications}
-	addFrameAncestors := &directiveFlag{directive: "frame-ancestors", action: "add", modifications: &modifications}
-	removeFrameAncestors := &directiveFlag{directive: "frame-ancestors", action: "remove", modifications: &modifications}
-	addChildSrc := &directiveFlag{directive: "child-src", action: "add", modifications: &modifications}
-	removeChildSrc := &directiveFlag{directive: "child-src", action: "remove", modifications: &modifications}
-	addScriptSrcElem := &directiveFlag{directive: "script-src-elem", action: "add", modifications: &modifications}
-	removeScriptSrcElem := &directiveFlag{directive: "script-src-elem", action: "remove", modifications: &modifications}
-	addScriptSrcAttr := &directiveFlag{directive: "script-src-attr", action: "add", modifications: &modifications}
-	removeScriptSrcAttr := &directiveFlag{directive: "script-src-attr", action: "remove", modifications: &modifications}
-	addStyleSrcElem := &directiveFlag{directive: "style-src-elem", action: "add", modifications: &modifications}
-	removeStyleSrcElem := &directiveFlag{directive: "style-src-elem", action: "remove", modifications: &modifications}
-	addStyleSrcAttr := &directiveFlag{directive: "style-src-attr", action: "add", modifications: &modifications}
-	removeStyleSrcAttr := &directiveFlag{directive: "style-src-attr", action: "remove", modifications: &modifications}
-	addSandbox := &directiveFlag{directive: "sandbox", action: "add", modifications: &modifications}
-	removeSandbox := &directiveFlag{directive: "sandbox", action: "remove", modifications: &modifications}
-	addTrustedTypes := &directiveFlag{directive: "trusted-types", action: "add", modifications: &modifications}
-	removeTrustedTypes := &directiveFlag{directive: "trusted-types", action: "remove", modifications: &modifications}
-	addReportTo := &directiveFlag{directive: "report-to", action: "add", modifications: &modifications}
-	removeReportTo := &directiveFlag{directive: "report-to", action: "remove", modifications: &modifications}
-
-	// Register add/remove flags
-	flag.Var(addScriptSrc, "add-script-src", "Add value to script-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeScriptSrc, "remove-script-src", "Remove value from script-src directive (can be repeated, evaluated in order)")
-	flag.Var(addStyleSrc, "add-style-src", "Add value to style-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeStyleSrc, "remove-style-src", "Remove value from style-src directive (can be repeated, evaluated in order)")
-	flag.Var(addImgSrc, "add-img-src", "Add value to img-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeImgSrc, "remove-img-src", "Remove value from img-src directive (can be repeated, evaluated in order)")
-	flag.Var(addFontSrc, "add-font-src", "Add value to font-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeFontSrc, "remove-font-src", "Remove value from font-src directive (can be repeated, evaluated in order)")
-	flag.Var(addConnectSrc, "add-connect-src", "Add value to connect-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeConnectSrc, "remove-connect-src", "Remove value from connect-src directive (can be repeated, evaluated in order)")
-	flag.Var(addManifestSrc, "add-manifest-src", "Add value to manifest-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeManifestSrc, "remove-manifest-src", "Remove value from manifest-src directive (can be repeated, evaluated in order)")
-	flag.Var(addWorkerSrc, "add-worker-src", "Add value to worker-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeWorkerSrc, "remove-worker-src", "Remove value from worker-src directive (can be repeated, evaluated in order)")
-	flag.Var(addFrameSrc, "add-frame-src", "Add value to frame-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeFrameSrc, "remove-frame-src", "Remove value from frame-src directive (can be repeated, evaluated in order)")
-	flag.Var(addDefaultSrc, "add-default-src", "Add value to default-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeDefaultSrc, "remove-default-src", "Remove value from default-src directive (can be repeated, evaluated in order)")
-	flag.Var(addObjectSrc, "add-object-src", "Add value to object-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeObjectSrc, "remove-object-src", "Remove value from object-src directive (can be repeated, evaluated in order)")
-	flag.Var(addMediaSrc, "add-media-src", "Add value to media-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeMediaSrc, "remove-media-src", "Remove value from media-src directive (can be repeated, evaluated in order)")
-	flag.Var(addBaseURI, "add-base-uri", "Add value to base-uri directive (can be repeated, evaluated in order)")
-	flag.Var(removeBaseURI, "remove-base-uri", "Remove value from base-uri directive (can be repeated, evaluated in order)")
-	flag.Var(addFormAction, "add-form-action", "Add value to form-action directive (can be repeated, evaluated in order)")
-	flag.Var(removeFormAction, "remove-form-action", "Remove value from form-action directive (can be repeated, evaluated in order)")
-	flag.Var(addFrameAncestors, "add-frame-ancestors", "Add value to frame-ancestors directive (can be repeated, evaluated in order)")
-	flag.Var(removeFrameAncestors, "remove-frame-ancestors", "Remove value from frame-ancestors directive (can be repeated, evaluated in order)")
-	flag.Var(addChildSrc, "add-child-src", "Add value to child-src directive (can be repeated, evaluated in order)")
-	flag.Var(removeChildSrc, "remove-child-src", "Remove value from child-src directive (can be repeated, evaluated in order)")
-	flag.Var(addScriptSrcElem, "add-script-src-elem", "Add value to script-src-elem directive (can be repeated, evaluated in order)")
-	flag.Var(removeScriptSrcElem, "remove-script-src-elem", "Remove value from script-src-elem directive (can be repeated, evaluated in order)")
-	flag.Var(addScriptSrcAttr, "add-script-src-attr", "Add value to script-src-attr directive (can be repeated, evaluated in order)")
-	flag.Var(removeScriptSrcAttr, "remove-script-src-attr", "Remove value from script-src-attr directive (can be repeated, evaluated in order)")
-	flag.Var(addStyleSrcElem, "add-style-src-elem", "Add value to style-src-elem directive (can be repeated, evaluated in order)")
-	flag.Var(removeStyleSrcElem, "remove-style-src-elem", "Remove value from style-src-elem directive (can be repeated, evaluated in order)")
-	flag.Var(addStyleSrcAttr, "add-style-src-attr", "Add value to style-src-attr directive (can be repeated, evaluated in order)")
-	flag.Var(removeStyleSrcAttr, "remove-style-src-attr", "Remove value from style-src-attr directive (can be repeated, evaluated in order)")
-	flag.Var(addSandbox, "add-sandbox", "Add value to sandbox directive (can be repeated, evaluated in order)")
-	flag.Var(removeSandbox, "remove-sandbox", "Remove value from sandbox directive (can be repeated, evaluated in order)")
-	flag.Var(addTrustedTypes, "add-trusted-types", "Add value to trusted-types directive (can be repeated, evaluated in order)")
-	flag.Var(removeTrustedTypes, "remove-trusted-types", "Remove value from trusted-types directive (can be repeated, evaluated in order)")
-	flag.Var(addReportTo, "add-report-to", "Add value to report-to directive (can be repeated, evaluated in order)")
-	flag.Var(removeReportTo, "remove-report-to", "Remove value from report-to directive (can be repeated, evaluated in order)")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: csp [options] file1.html [file2.html ...]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: csp [options] [file1.html dir/ ...]\n")
+		fmt.Fprintf(os.Stderr, "       csp check [options] url1 [url2 ...]\n")
+		fmt.Fprintf(os.Stderr, "       csp proxy --upstream URL [options]\n")
+		fmt.Fprintf(os.Stderr, "       csp collect [--listen ADDR] [--dir DIR]\n")
+		fmt.Fprintf(os.Stderr, "       csp violations [--dir DIR] [--since DURATION]\n")
+		fmt.Fprintf(os.Stderr, "       csp learn --reports FILE --csp \"CSP_HEADER\"\n\n")
 		fmt.Fprintf(os.Stderr, "Generate CSP hashes for inline content in HTML files.\n")
-		fmt.Fprintf(os.Stderr, "If no CSP is provided, a strict CSP will be generated by default.\n\n")
+		fmt.Fprintf(os.Stderr, "Directories are scanned recursively for the files matching --include, skipping\n")
+		fmt.Fprintf(os.Stderr, "--exclude and the paths listed in %s files.\n", ignoreFileName)
+		fmt.Fprintf(os.Stderr, "If no CSP is provided, a strict CSP will be generated by default.\n")
+		fmt.Fprintf(os.Stderr, "Options not given on the command line are read from %s or --config.\n\n", configFileName)
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -174,20 +167,208 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --include-external index.html\n")
 		fmt.Fprintf(os.Stderr, "  csp --include-external --heuristics index.html\n")
 		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" -v index.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --canonical --sort-sources --pretty index.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --include-external --report index.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --nonce --strict-dynamic --out-dir dist/ index.html about.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --meta-tag --out-dir dist/ index.html about.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --externalize --out-dir dist/ *.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --externalize --delegate-handlers --style-classes --out-dir dist/ *.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --nonce-placeholder \"{{CSP_NONCE}}\" --out-dir templates-csp/ templates/*.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --include-external --heuristics --format json index.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"$(cat csp-header.txt)\" --verify --origin https://example.com *.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp-file csp-header.txt --verify --format sarif *.html > csp.sarif\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self', script-src https://cdn.example.com\" --effective\n")
+		fmt.Fprintf(os.Stderr, "  csp --config csp.json --profile prod\n")
+		fmt.Fprintf(os.Stderr, "  csp --include \"**/*.html\" --exclude drafts/ --meta-tag --out-dir dist/ site/\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --include-external --manifest csp-manifest.json --group-by-dir site/\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"default-src 'self'\" --per-page --group-by-dir --emit nginx site/ > csp.conf\n")
+		fmt.Fprintf(os.Stderr, "  csp --report-only --report-endpoint csp=https://csp.example.com/ index.html\n")
+		fmt.Fprintf(os.Stderr, "  csp --csp \"$(cat csp-header.txt)\" --dual --report-endpoint csp=https://csp.example.com/ site/\n")
 	}
 
 	flag.Parse()
+	cspOnCommandLine := false
+	flag.Visit(func(f *flag.Flag) {
+		cspOnCommandLine = cspOnCommandLine || f.Name == "csp"
+	})
+
+	// Fill in the options not given on the command line from the config file
+	config, err := FindConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config == nil && *profile != "" {
+		fmt.Fprintf(os.Stderr, "Error: --profile requires a config file (%s or --config)\n", configFileName)
+		os.Exit(1)
+	}
+	var settings ConfigSettings
+	if config != nil {
+		if settings, err = config.Resolve(*profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", config.Path, err)
+			os.Exit(1)
+		}
+		if err := settings.Apply(flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", config.Path, err)
+			os.Exit(1)
+		}
+		// Config modifications come first, so that the flags can undo them
+		modifications = append(settings.Modifications, modifications...)
+	}
 
 	// Handle verbose flag (either -v or --verbose)
 	verboseEnabled := *verbose || *verboseShort
+	if verboseEnabled && config != nil {
+		if *profile != "" {
+			fmt.Fprintf(os.Stderr, "Using config %s (profile %s)\n", config.Path, *profile)
+		} else {
+			fmt.Fprintf(os.Stderr, "Using config %s\n", config.Path)
+		}
+	}
+
+	// Read the policy from --csp-file. SARIF results for the policy point at that file, or at
+	// the config file the policy came from.
+	var policySource PolicySource
+	switch {
+	case *cspFile != "":
+		if cspOnCommandLine {
+			fmt.Fprintln(os.Stderr, "Error: --csp and --csp-file cannot be combined")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(*cspFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --csp-file: %v\n", err)
+			os.Exit(1)
+		}
+		*cspFlag = strings.Join(strings.Fields(string(data)), " ")
+		policySource = PolicySource{Path: *cspFile, Content: string(data)}
+	case config != nil && !cspOnCommandLine && *cspFlag != "":
+		if data, err := os.ReadFile(config.Path); err == nil {
+			policySource = PolicySource{Path: config.Path, Content: string(data)}
+		}
+	}
 
 	// Use safe default: generate strict CSP if neither --csp nor --generate-strict is specified
+	explicitStrict := *generateStrict
 	if *cspFlag == "" && !*generateStrict {
 		if verboseEnabled {
 			fmt.Fprintln(os.Stderr, "No CSP provided, using --generate-strict as safe default")
 		}
 		*generateStrict = true
 	}
+	// Adding the pages' sources to the enforced policy would only loosen it, so the
+	// --dual candidate is always the strict policy
+	if *dualMode {
+		*generateStrict = true
+	}
+
+	switch *format {
+	case "text", "json":
+	case "sarif":
+		if !*validateOnly && !*verifyOnly {
+			fmt.Fprintln(os.Stderr, "Error: --format sarif requires --validate-only or --verify")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid format '%s'. Must be text, json or sarif\n", *format)
+		os.Exit(1)
+	}
+	jsonOutput := *format == "json"
+	sarifOutput := *format == "sarif"
+
+	if *noncePlaceholder != "" {
+		if err := CheckNoncePlaceholder(*noncePlaceholder); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		*nonceMode = true
+	}
+	if *nonceMode && *outDir == "" && !reportMode {
+		fmt.Fprintln(os.Stderr, "Error: --nonce requires --out-dir to write the rewritten HTML files")
+		os.Exit(1)
+	}
+	if *metaTag && *outDir == "" && !reportMode {
+		fmt.Fprintln(os.Stderr, "Error: --meta-tag requires --out-dir to write the rewritten HTML files")
+		os.Exit(1)
+	}
+	if *externalizeMode && *outDir == "" && !reportMode {
+		fmt.Fprintln(os.Stderr, "Error: --externalize requires --out-dir to write the rewritten HTML files and assets")
+		os.Exit(1)
+	}
+	if *delegateHandlers && *outDir == "" && !reportMode {
+		fmt.Fprintln(os.Stderr, "Error: --delegate-handlers requires --out-dir to write the rewritten HTML files and the handlers script")
+		os.Exit(1)
+	}
+	if *delegateHandlers && *noEventHandlers {
+		fmt.Fprintln(os.Stderr, "Error: --delegate-handlers cannot be combined with --no-event-handlers")
+		os.Exit(1)
+	}
+	if *styleClassesMode && *outDir == "" && !reportMode {
+		fmt.Fprintln(os.Stderr, "Error: --style-classes requires --out-dir to write the rewritten HTML files and the stylesheet")
+		os.Exit(1)
+	}
+	if *forceStyleClasses && !*styleClassesMode {
+		fmt.Fprintln(os.Stderr, "Error: --force-style-classes requires --style-classes")
+		os.Exit(1)
+	}
+	if *styleClassesMode && *noInlineStyles {
+		fmt.Fprintln(os.Stderr, "Error: --style-classes cannot be combined with --no-inline-styles")
+		os.Exit(1)
+	}
+	if *manifestPath != "" {
+		*perPage = true
+	}
+	if *groupByDir && *manifestPath == "" && *emitFormat == "" {
+		fmt.Fprintln(os.Stderr, "Error: --group-by-dir requires --manifest or --emit")
+		os.Exit(1)
+	}
+	if *emitFormat != "" {
+		if _, ok := emitters[*emitFormat]; !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid --emit format '%s'. Must be one of %s\n", *emitFormat, strings.Join(EmitFormats(), ", "))
+			os.Exit(1)
+		}
+		if *format != "text" || reportMode {
+			fmt.Fprintln(os.Stderr, "Error: --emit cannot be combined with --format or --report")
+			os.Exit(1)
+		}
+	}
+	if *dualMode && *cspFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: --dual requires --csp, the policy to keep enforcing")
+		os.Exit(1)
+	}
+	if *dualMode && *reportOnly {
+		fmt.Fprintln(os.Stderr, "Error: --dual cannot be combined with --report-only, it already prints the candidate as report-only")
+		os.Exit(1)
+	}
+	if (*reportOnly || *dualMode) && *metaTag {
+		fmt.Fprintln(os.Stderr, "Error: --report-only and --dual cannot be combined with --meta-tag, browsers ignore report-only policies in <meta> tags")
+		os.Exit(1)
+	}
+	if *legacyReportTo && len(reportEndpoints) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --legacy-report-to requires --report-endpoint")
+		os.Exit(1)
+	}
+	reporting := ReportingOptions{ReportOnly: *reportOnly || *dualMode, LegacyReportTo: *legacyReportTo}
+	for _, value := range reportEndpoints {
+		endpoint, err := ParseReportEndpoint(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --report-endpoint: %v\n", err)
+			os.Exit(1)
+		}
+		reporting.Endpoints = append(reporting.Endpoints, endpoint)
+	}
+	if *strictDynamic && !*nonceMode {
+		fmt.Fprintln(os.Stderr, "Error: --strict-dynamic requires --nonce")
+		os.Exit(1)
+	}
+
+	// Validate add/remove modifications before doing any work
+	for _, mod := range modifications {
+		if err := CheckCSPModification(mod); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --%s-%s: %v\n", mod.Action, mod.Directive, err)
+			os.Exit(1)
+		}
+	}
 
 	// Validate hash algorithm
 	var algorithm HashAlgorithm
@@ -210,13 +391,41 @@ func main() {
 			os.Exit(1)
 		}
 		result := ValidateCSP(*cspFlag)
-		PrintValidationResult(result, true)
+		if len(reporting.Endpoints) > 0 {
+			CheckReportGroups(&result, *cspFlag, reporting.Endpoints)
+		}
+		if jsonOutput {
+			input := NewJSONPolicy(*cspFlag, true)
+			input.Validation = &result
+			if err := WriteJSON(os.Stdout, &JSONDocument{Version: JSONFormatVersion, Input: input}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				os.Exit(1)
+			}
+		} else if sarifOutput {
+			if err := WriteJSON(os.Stdout, NewSARIFLog(result.Warnings, nil, policySource)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing SARIF: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			PrintValidationResult(result, true)
+		}
 		if !result.Valid {
 			os.Exit(1)
 		}
 		os.Exit(0)
 	}
 
+	// Handle effective policy mode
+	if *effectiveOnly {
+		if *cspFlag == "" {
+			fmt.Fprintln(os.Stderr, "Error: --csp flag is required for --effective")
+			os.Exit(1)
+		}
+		serializeOpts := SerializeOptions{Canonical: *canonical, SortSources: *sortSourceLists, Pretty: *pretty}
+		fmt.Println(ParsePolicyList(*cspFlag).Effective().Serialize(serializeOpts))
+		os.Exit(0)
+	}
+
 	// Validate input CSP before processing (unless disabled or generating strict)
 	if !*noValidate && *cspFlag != "" && !*generateStrict {
 		result := ValidateCSP(*cspFlag)
@@ -229,32 +438,112 @@ func main() {
 		}
 	}
 
+	// Scan directory arguments; with include patterns and no arguments, scan the working directory
+	scanOpts := ScanOptions{Include: includePatterns, Exclude: excludePatterns, OutDir: *outDir}
+	if len(scanOpts.Include) == 0 {
+		scanOpts.Include = settings.Include
+	}
+	if len(scanOpts.Exclude) == 0 {
+		scanOpts.Exclude = settings.Exclude
+	}
 	htmlFiles := flag.Args()
+	if *siteRoot == "" {
+		*siteRoot = "."
+		if info, err := os.Stat(flag.Arg(0)); err == nil && info.IsDir() && flag.NArg() == 1 {
+			*siteRoot = flag.Arg(0)
+		}
+	}
+	if len(htmlFiles) == 0 && len(scanOpts.Include) > 0 {
+		htmlFiles = []string{"."}
+	}
+	if htmlFiles, err = CollectFiles(htmlFiles, scanOpts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	if len(htmlFiles) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: at least one HTML file is required")
 		fmt.Fprintln(os.Stderr, "Usage: csp --csp \"CSP_HEADER\" [options] file1.html file2.html ...")
 		os.Exit(1)
 	}
 
+	// Content selection shared by hashing, --verify and --report
+	auditOpts := AuditOptions{
+		Origin:          *originFlag,
+		Algorithm:       algorithm,
+		NoScripts:       *noScripts,
+		NoStyles:        *noStyles,
+		NoInlineStyles:  *noInlineStyles,
+		NoEventHandlers: *noEventHandlers,
+	}
+
+	// Handle verify mode: audit the pages against the policy instead of updating it
+	if *verifyOnly {
+		if *cspFlag == "" {
+			fmt.Fprintln(os.Stderr, "Error: --csp flag is required for --verify")
+			os.Exit(1)
+		}
+		policies := ParsePolicyList(*cspFlag)
+		var findings []AuditFinding
+		for _, filePath := range htmlFiles {
+			fileFindings, err := AuditFile(filePath, policies, auditOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error auditing %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			findings = append(findings, fileFindings...)
+		}
+		if sarifOutput {
+			// Include the policy's own validation findings alongside the blocked content
+			if err := WriteJSON(os.Stdout, NewSARIFLog(ValidateCSP(*cspFlag).Warnings, findings, policySource)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing SARIF: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			PrintAuditFindings(findings, len(htmlFiles))
+		}
+		if len(findings) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Initialize or use provided CSP
 	var baseCSP string
+	strictBase := *generateStrict
 	if *generateStrict {
 		// Generate a strict CSP from the default template
 		template := GetDefaultStrictTemplate()
 		template.RequireTrustedTypesFor = *requireTrustedTypes
-		baseCSP = GenerateStrictCSP(template)
+		baseCSP = OverrideStrictDirectives(GenerateStrictCSP(template), settings.Template)
 	} else {
 		baseCSP = *cspFlag
 	}
 
+	// Generate the nonce shared by all pages of this build
+	var nonce string
+	nonceOpts := NonceOptions{Scripts: !*noScripts, Styles: !*noStyles, ExternalScripts: *strictDynamic}
+	if *noncePlaceholder != "" {
+		nonce = *noncePlaceholder
+	} else if *nonceMode {
+		var err error
+		nonce, err = GenerateNonce()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize verbose output
 	verboseOut := NewVerboseOutput(verboseEnabled)
+	verboseOut.Collect = jsonOutput
 
 	// Collect all script and style hashes from all HTML files
 	var allScriptHashes []string
 	var allStyleTagHashes []string
 	var allStyleAttrHashes []string
 	hasEventHandlers := false
+	var fileReports []FileReport
+	pageSources := map[string]*PageSources{}
 
 	// Track counts for verbose output
 	totalScripts := 0
@@ -276,37 +565,173 @@ func main() {
 		}
 	}
 
+	// Policies read from the pages' meta tags, by file
+	metaBases := map[string]string{}
+	firstMetaBase := ""
+
+	// Pages rewritten into --out-dir, and the elements moved to external files, by file
+	rewriteMode := *nonceMode || *metaTag || *externalizeMode || *delegateHandlers || *styleClassesMode
+	pages := map[string]*Page{}
+	outPaths := map[string]string{}
+	externalizeResults := map[string]*ExternalizeResult{}
+	delegateResults := map[string]*DelegateResult{}
+	styleClasses := NewStyleClasses()
+	styleClasses.IgnorePageStyles = *forceStyleClasses
+	styleClassResults := map[string]*StyleClassResult{}
+	externalizeOpts := ExternalizeOptions{Scripts: !*noScripts, Styles: !*noStyles, AssetsDir: filepath.Join(*outDir, *assetsDir)}
+	if *strictDynamic {
+		externalizeOpts.Nonce = nonce
+	}
+	externalizedScripts := false
+	externalizedStyles := false
+
 	for i, filePath := range htmlFiles {
 		verboseOut.PrintProgress(filePath, i+1, len(htmlFiles))
+		sources := &PageSources{}
 
-		scripts, styleTags, styleAttrs, hasEvents, err := ExtractInlineContent(filePath, *noScripts, *noStyles, *noInlineStyles, *noEventHandlers)
+		if *metaTag {
+			policy, found, err := ReadMetaPolicy(filePath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			if found {
+				metaBases[filePath] = policy
+				if firstMetaBase == "" {
+					firstMetaBase = policy
+				}
+			}
+		}
+
+		items, err := ExtractInlineItems(filePath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", filePath, err)
 			os.Exit(1)
 		}
-		if hasEvents {
-			hasEventHandlers = true
+
+		// Load the page for rewriting; in report mode nothing is written
+		var page *Page
+		if rewriteMode {
+			outPath := filePath
+			if !reportMode {
+				if outPath, err = OutputPath(*outDir, filePath); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if page, err = LoadPage(filePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			pages[filePath] = page
+			outPaths[filePath] = outPath
+		}
+
+		// Move event handlers to the generated script first, so that externalized
+		// elements are written without them; moved handlers need no hash
+		delegated := map[inlineKey]bool{}
+		if *delegateHandlers {
+			result, err := DelegateEventHandlers(page, outPaths[filePath], externalizeOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error delegating event handlers in %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			for _, skipped := range result.Skipped {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%d:%d: %s left inline: %s\n", filePath, skipped.Line, skipped.Column, skipped.Type, skipped.Reason)
+			}
+			for _, handler := range result.Handlers {
+				delegated[handler] = true
+			}
+			sources.Scripts = result.Script.Name != ""
+			delegateResults[filePath] = result
+		}
+
+		// Replace style attributes with classes; converted attributes need no hash
+		converted := map[string]bool{}
+		if *styleClassesMode {
+			result := styleClasses.Convert(page)
+			for _, skipped := range result.Skipped {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%d:%d: %s left inline: %s\n", filePath, skipped.Line, skipped.Column, skipped.Type, skipped.Reason)
+			}
+			for _, value := range result.Values {
+				converted[value] = true
+			}
+			sources.Styles = result.Classes > 0
+			styleClassResults[filePath] = result
 		}
 
-		// Count event handlers for verbose output
-		eventHandlerCount := 0
-		if hasEvents {
-			for _, script := range scripts {
-				// Simple heuristic: very short scripts are likely event handlers
-				if len(script) < 200 && !strings.Contains(script, "\n") {
-					eventHandlerCount++
+		// Move inline elements to external files; those need no hash
+		externalized := map[string]bool{}
+		if *externalizeMode {
+			result, err := Externalize(page, outPaths[filePath], externalizeOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error externalizing %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			for _, skipped := range result.Skipped {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%d:%d: %s left inline: %s\n", filePath, skipped.Line, skipped.Column, skipped.Type, skipped.Reason)
+			}
+			for _, asset := range result.Assets {
+				sources.Scripts = sources.Scripts || asset.Type == ContentTypeScript
+				sources.Styles = sources.Styles || asset.Type == ContentTypeStyleTag
+			}
+			externalized = result.Contents()
+			externalizeResults[filePath] = result
+		}
+
+		// Compute hashes for inline content (unless disabled)
+		fileReport := FileReport{File: filePath}
+		for _, item := range items {
+			if skipInlineItem(item, auditOpts) {
+				continue
+			}
+			fileReport.Count(item)
+
+			// In nonce mode, elements carry the nonce instead of a hash, and
+			// externalized elements are loaded from 'self'
+			isElement := item.Type == ContentTypeScript || item.Type == ContentTypeStyleTag
+			if isElement && (*nonceMode || externalized[item.Content]) {
+				continue
+			}
+			if item.Type == ContentTypeEventHandler && delegated[inlineKey{Line: item.Line, Column: item.Column, Content: item.Content}] ||
+				item.Type == ContentTypeStyleAttr && converted[item.Content] {
+				continue
+			}
+
+			hash := ComputeHash(item.Content, algorithm)
+			switch item.Type {
+			case ContentTypeScript, ContentTypeEventHandler:
+				allScriptHashes = append(allScriptHashes, hash)
+				sources.ScriptHashes = append(sources.ScriptHashes, hash)
+				totalScripts++
+				if item.Type == ContentTypeEventHandler {
+					hasEventHandlers = true
+					sources.EventHandlers = true
 				}
+			case ContentTypeStyleTag:
+				allStyleTagHashes = append(allStyleTagHashes, hash)
+				sources.StyleTagHashes = append(sources.StyleTagHashes, hash)
+				totalStyleTags++
+			case ContentTypeStyleAttr:
+				allStyleAttrHashes = append(allStyleAttrHashes, hash)
+				sources.StyleAttrHashes = append(sources.StyleAttrHashes, hash)
+				totalStyleAttrs++
 			}
+			verboseOut.AddHash(hash, item.Type, filePath, item.Content)
 		}
 
-		verboseOut.PrintFileSummary(filePath, len(scripts), len(styleTags), len(styleAttrs), eventHandlerCount)
+		verboseOut.PrintFileSummary(filePath, fileReport.Scripts, fileReport.StyleTags, fileReport.StyleAttributes, fileReport.EventHandlers)
 
-		// Extract external resources if requested
-		if *includeExternal {
+		// Extract external resources if requested (the report lists domains either way)
+		if *includeExternal || reportMode {
 			externalRes, err := ExtractExternalResources(filePath)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to extract external resources from %s: %v\n", filePath, err)
 			} else {
+				fileReport.Domains = externalRes.GetUniqueDomains()
+			}
+			if err == nil && *includeExternal {
+				sources.External = externalRes
 				// Merge resources
 				allExternalResources.Scripts = append(allExternalResources.Scripts, externalRes.Scripts...)
 				allExternalResources.Stylesheets = append(allExternalResources.Stylesheets, externalRes.Stylesheets...)
@@ -323,74 +748,20 @@ func main() {
 			}
 		}
 
-		// Compute hashes for scripts (unless disabled)
-		if !*noScripts {
-			for _, script := range scripts {
-				hash := ComputeHash(script, algorithm)
-				allScriptHashes = append(allScriptHashes, hash)
-				totalScripts++
-
-				// Determine if this is an event handler
-				contentType := "script"
-				if len(script) < 200 && !strings.Contains(script, "\n") && hasEvents {
-					contentType = "event-handler"
-				}
-				verboseOut.AddHash(hash, contentType, filePath, script)
-			}
-		}
-
-		// Compute hashes for style tags (unless disabled)
-		if !*noStyles {
-			for _, style := range styleTags {
-				hash := ComputeHash(style, algorithm)
-				allStyleTagHashes = append(allStyleTagHashes, hash)
-				totalStyleTags++
-				verboseOut.AddHash(hash, "style-tag", filePath, style)
-			}
+		// Per-page policies infer resources from the page's own resources only
+		if *perPage && *useHeuristics && sources.External != nil {
+			AddHeuristicResources(sources.External)
 		}
+		externalizedScripts = externalizedScripts || sources.Scripts
+		externalizedStyles = externalizedStyles || sources.Styles
+		pageSources[filePath] = sources
 
-		// Compute hashes for style attributes (unless disabled)
-		if !*noInlineStyles {
-			for _, style := range styleAttrs {
-				hash := ComputeHash(style, algorithm)
-				allStyleAttrHashes = append(allStyleAttrHashes, hash)
-				totalStyleAttrs++
-				verboseOut.AddHash(hash, "style-attr", filePath, style)
-			}
-		}
+		fileReports = append(fileReports, fileReport)
 	}
 
 	// Apply heuristics if requested
 	if *includeExternal && *useHeuristics && allExternalResources != nil {
-		// Collect all external resources into a flat list for heuristics
-		var allResources []ExternalResource
-		allResources = append(allResources, allExternalResources.Scripts...)
-		allResources = append(allResources, allExternalResources.Stylesheets...)
-		allResources = append(allResources, allExternalResources.Images...)
-		allResources = append(allResources, allExternalResources.Fonts...)
-		allResources = append(allResources, allExternalResources.Frames...)
-
-		// Apply heuristics
-		allHeuristicResources = ApplyHeuristics(allResources)
-
-		// Convert heuristic resources back to external resources and merge
-		for _, h := range allHeuristicResources {
-			externalRes := ConvertHeuristicToExternalResource(h)
-			switch h.Type {
-			case "script":
-				allExternalResources.Scripts = append(allExternalResources.Scripts, externalRes)
-			case "stylesheet":
-				allExternalResources.Stylesheets = append(allExternalResources.Stylesheets, externalRes)
-			case "image":
-				allExternalResources.Images = append(allExternalResources.Images, externalRes)
-			case "font":
-				allExternalResources.Fonts = append(allExternalResources.Fonts, externalRes)
-			case "frame":
-				allExternalResources.Frames = append(allExternalResources.Frames, externalRes)
-			case "connect":
-				allExternalResources.Other = append(allExternalResources.Other, externalRes)
-			}
-		}
+		allHeuristicResources = AddHeuristicResources(allExternalResources)
 	}
 
 	// Remove duplicate hashes
@@ -434,40 +805,261 @@ func main() {
 			len(allScriptHashes), len(allStyleTagHashes), len(allStyleAttrHashes))
 	}
 
-	// Update CSP header with hashes
-	var updatedCSP string
-	var err error
-	if *generateStrict {
-		// Use strict CSP merge function
-		updatedCSP, err = MergeStrictCSPWithHashes(baseCSP, allScriptHashes, allStyleTagHashes, allStyleAttrHashes, hasEventHandlers)
-	} else {
-		updatedCSP, err = UpdateCSP(baseCSP, allScriptHashes, allStyleTagHashes, allStyleAttrHashes, hasEventHandlers)
+	// With --meta-tag and no --csp, the first page's meta policy is the base of the header
+	if *metaTag && *cspFlag == "" && !explicitStrict && firstMetaBase != "" {
+		baseCSP = firstMetaBase
+		strictBase = false
+	}
+
+	// The sources of all pages, allowed by the header policy
+	allSources := &PageSources{
+		ScriptHashes:    allScriptHashes,
+		StyleTagHashes:  allStyleTagHashes,
+		StyleAttrHashes: allStyleAttrHashes,
+		EventHandlers:   hasEventHandlers,
+		External:        allExternalResources,
+		Scripts:         externalizedScripts,
+		Styles:          externalizedStyles,
+	}
+
+	// buildPolicy adds the hashes, nonce, external domains and modifications of a set of
+	// pages to a base policy
+	buildPolicy := func(base string, strict bool, sources *PageSources) (string, error) {
+		var updated string
+		var err error
+		if strict {
+			// Use strict CSP merge function
+			updated, err = MergeStrictCSPWithHashes(base, sources.ScriptHashes, sources.StyleTagHashes, sources.StyleAttrHashes, sources.EventHandlers)
+		} else {
+			updated, err = UpdateCSP(base, sources.ScriptHashes, sources.StyleTagHashes, sources.StyleAttrHashes, sources.EventHandlers)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// Allow the nonce-tagged elements
+		if *nonceMode {
+			updated = AddNonceToCSP(updated, nonce, nonceOpts, *strictDynamic)
+		}
+
+		// Add external resource domains if requested
+		if *includeExternal && sources.External != nil {
+			updated = AddExternalResourcesToCSP(updated, sources.External)
+		}
+
+		// Allow the externalized scripts and styles, once hashes and nonces have created
+		// the directives that govern them
+		if sources.Scripts || sources.Styles {
+			updated = AllowSelfForAssets(updated, sources.Scripts, sources.Styles)
+		}
+
+		// Report to the first endpoint, before the modifications so that they can adjust it
+		if len(reporting.Endpoints) > 0 {
+			updated = AddReportEndpoint(updated, reporting.Endpoints[0])
+		}
+
+		// Apply any add/remove modifications in order
+		if len(modifications) > 0 {
+			updated = ApplyCSPModifications(updated, modifications)
+		}
+		return updated, nil
 	}
+
+	// Update CSP header with hashes
+	updatedCSP, err := buildPolicy(baseCSP, strictBase, allSources)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error updating CSP: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Add external resource domains if requested
-	if *includeExternal && allExternalResources != nil {
-		updatedCSP = AddExternalResourcesToCSP(updatedCSP, allExternalResources)
+	// Write a copy of each page with the policy in its meta tag and nonces on its elements
+	if rewriteMode && !reportMode {
+		// All pages share the stylesheet of the classes generated for style attributes
+		var stylesheet InlineAsset
+		if !styleClasses.Empty() {
+			stylesheet = styleClasses.Stylesheet()
+			if err := WriteAssets(externalizeOpts.AssetsDir, []InlineAsset{stylesheet}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var ignoredInMeta []string
+		for _, filePath := range htmlFiles {
+			page := pages[filePath]
+			outPath := outPaths[filePath]
+
+			if *metaTag {
+				base, strict, sources := baseCSP, strictBase, allSources
+				if metaBase, ok := metaBases[filePath]; ok {
+					base, strict = metaBase, false
+				}
+				if *perPage {
+					sources = pageSources[filePath]
+				}
+				pagePolicy, err := buildPolicy(base, strict, sources)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error updating the meta policy of %s: %v\n", filePath, err)
+					os.Exit(1)
+				}
+				metaPolicy, removed := MetaPolicy(ParsePolicy(pagePolicy).Serialize(SerializeOptions{Canonical: *canonical, SortSources: *sortSourceLists}))
+				SetMetaPolicy(page, metaPolicy)
+				for _, name := range removed {
+					if !containsString(ignoredInMeta, name) {
+						ignoredInMeta = append(ignoredInMeta, name)
+					}
+				}
+			}
+
+			var details []string
+			if *nonceMode {
+				count := AddNonces(page, nonce, nonceOpts)
+				details = append(details, fmt.Sprintf("%d element(s) tagged with nonce", count))
+			}
+			if result := externalizeResults[filePath]; result != nil {
+				if err := WriteAssets(externalizeOpts.AssetsDir, result.Assets); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				details = append(details, fmt.Sprintf("%d element(s) externalized", result.Elements))
+			}
+			if result := delegateResults[filePath]; result != nil && result.Script.Name != "" {
+				if err := WriteAssets(externalizeOpts.AssetsDir, []InlineAsset{result.Script}); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				details = append(details, fmt.Sprintf("event handlers of %d element(s) delegated", result.Elements))
+			}
+			if result := styleClassResults[filePath]; result != nil {
+				if result.Classes > 0 {
+					if err := LinkStylesheet(page, outPath, externalizeOpts.AssetsDir, stylesheet.Name); err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				details = append(details, fmt.Sprintf("%d style attribute(s) converted", result.Elements))
+			}
+
+			if err := page.Save(outPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error rewriting %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			if verboseEnabled {
+				if len(details) > 0 {
+					fmt.Fprintf(os.Stderr, "  Wrote %s (%s)\n", outPath, strings.Join(details, ", "))
+				} else {
+					fmt.Fprintf(os.Stderr, "  Wrote %s\n", outPath)
+				}
+			}
+		}
+
+		if len(ignoredInMeta) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: browsers ignore %s in <meta> policies; left out of the meta tags, send them in the HTTP header instead\n\n",
+				strings.Join(ignoredInMeta, ", "))
+		}
 	}
 
-	// Apply any add/remove modifications in order
-	if len(modifications) > 0 {
-		updatedCSP = ApplyCSPModifications(updatedCSP, modifications)
+	// Map the URL path of each page to its own policy
+	manifestOpts := SerializeOptions{Canonical: *canonical, SortSources: *sortSourceLists}
+	manifest := NewManifest(ParsePolicy(updatedCSP).Serialize(manifestOpts), nil, false)
+	if *perPage && (*manifestPath != "" || *emitFormat != "") && !reportMode {
+		policies := map[string]string{}
+		for _, filePath := range htmlFiles {
+			urlPath, err := URLPath(*siteRoot, filePath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			pagePolicy, err := buildPolicy(baseCSP, strictBase, pageSources[filePath])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error updating the policy of %s: %v\n", filePath, err)
+				os.Exit(1)
+			}
+			policies[urlPath] = ParsePolicy(pagePolicy).Serialize(manifestOpts)
+		}
+		manifest = NewManifest(manifest.Default, policies, *groupByDir)
+	}
+	if *manifestPath != "" && !reportMode {
+		if err := WriteManifest(*manifestPath, manifest); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if verboseEnabled {
+			fmt.Fprintf(os.Stderr, "Wrote %s (%d entries)\n", *manifestPath, len(manifest.Policies))
+		}
 	}
 
 	// Validate output CSP (unless disabled)
 	if !*noValidate {
 		result := ValidateCSP(updatedCSP)
+		if *noncePlaceholder != "" {
+			result = ValidateNonceTemplate(updatedCSP, *noncePlaceholder)
+		}
+		if len(reporting.Endpoints) > 0 {
+			CheckReportGroups(&result, updatedCSP, reporting.Endpoints)
+		}
 		if len(result.Warnings) > 0 {
 			fmt.Fprintf(os.Stderr, "Output CSP has %d warning(s). Use --validate-only to check.\n\n", len(result.Warnings))
 		}
 	}
 
-	// Output the updated CSP header
-	fmt.Println(updatedCSP)
+	serializeOpts := SerializeOptions{Canonical: *canonical, SortSources: *sortSourceLists, Pretty: *pretty}
+
+	// Emit the whole run as a JSON document
+	if jsonOutput {
+		serializeOpts.Pretty = false
+		doc := NewJSONDocument(baseCSP, ParsePolicy(updatedCSP).Serialize(serializeOpts), !*noValidate,
+			fileReports, verboseOut.Hashes, allExternalResources, allHeuristicResources)
+		doc.Nonce = nonce
+		if *noncePlaceholder != "" && doc.Output.Validation != nil {
+			result := ValidateNonceTemplate(doc.Output.Header, *noncePlaceholder)
+			doc.Output.Validation = &result
+		}
+		if len(reporting.Endpoints) > 0 && doc.Output.Validation != nil {
+			CheckReportGroups(doc.Output.Validation, doc.Output.Header, reporting.Endpoints)
+		}
+		if reporting.Enabled() {
+			if *dualMode {
+				reporting.Enforced = ParsePolicy(*cspFlag).Serialize(serializeOpts)
+			}
+			doc.Headers = reporting.Headers(doc.Output.Header)
+		}
+		if err := WriteJSON(os.Stdout, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// In report mode, show what would change instead of printing the header
+	if reportMode {
+		PrintReport(fileReports, baseCSP, updatedCSP)
+		return
+	}
+
+	// Output the configuration sending the policies
+	if *emitFormat != "" {
+		if *dualMode {
+			reporting.Enforced = ParsePolicy(*cspFlag).Serialize(manifestOpts)
+		}
+		config, err := Emit(*emitFormat, reporting.PolicyHeader(), reporting.FixedHeaders(), manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(config)
+		return
+	}
+
+	// Output the updated CSP header, with the names of the headers when there are several
+	if reporting.Enabled() {
+		if *dualMode {
+			reporting.Enforced = ParsePolicy(*cspFlag).Serialize(serializeOpts)
+		}
+		PrintHeaders(os.Stdout, reporting.Headers(ParsePolicy(updatedCSP).Serialize(serializeOpts)))
+		return
+	}
+	fmt.Println(ParsePolicy(updatedCSP).Serialize(serializeOpts))
 }
 
 // removeDuplicates removes duplicate strings from a slice while preserving order
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestVersion is the version of the policy manifest format
+const ManifestVersion = 1
+
+// PageSources are the hashes and external resources that the policy of a page allows
+type PageSources struct {
+	ScriptHashes    []string
+	StyleTagHashes  []string
+	StyleAttrHashes []string
+	EventHandlers   bool
+	External        *ExternalResources // nil unless external resources are included
+	Scripts         bool               // scripts were moved to files loaded from 'self'
+	Styles          bool               // styles were moved to files loaded from 'self'
+}
+
+// Manifest maps the URL paths of a site to the policies of its pages
+type Manifest struct {
+	Version  int               `json:"version"`
+	Default  string            `json:"default"`  // policy allowing every page, for paths not listed
+	Policies map[string]string `json:"policies"` // by URL path, or "/dir/*" for a whole directory
+}
+
+// NewManifest builds a manifest from the policies of pages by URL path. With groupByDir,
+// the pages of a directory that all have the same policy collapse into one "/dir/*" entry.
+func NewManifest(defaultPolicy string, pages map[string]string, groupByDir bool) *Manifest {
+	manifest := &Manifest{Version: ManifestVersion, Default: defaultPolicy, Policies: map[string]string{}}
+	if !groupByDir {
+		for urlPath, policy := range pages {
+			manifest.Policies[urlPath] = policy
+		}
+		return manifest
+	}
+	groupPolicies(pages, "/", manifest.Policies)
+	return manifest
+}
+
+// groupPolicies adds the policies of the pages below dir to out, collapsing directories
+// whose pages share a policy, from the top down
+func groupPolicies(pages map[string]string, dir string, out map[string]string) {
+	var paths []string
+	policies := map[string]bool{}
+	for urlPath, policy := range pages {
+		if strings.HasPrefix(urlPath, dir) {
+			paths = append(paths, urlPath)
+			policies[policy] = true
+		}
+	}
+	if len(paths) > 1 && len(policies) == 1 {
+		out[dir+"*"] = pages[paths[0]]
+		return
+	}
+
+	subdirs := map[string]bool{}
+	for _, urlPath := range paths {
+		rest := urlPath[len(dir):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			subdirs[dir+rest[:i+1]] = true
+		} else {
+			out[urlPath] = pages[urlPath]
+		}
+	}
+	for subdir := range subdirs {
+		groupPolicies(pages, subdir, out)
+	}
+}
+
+// URLPath returns the URL path a file below the site root is served at. Index pages are
+// served at the path of their directory.
+func URLPath(siteRoot, filePath string) (string, error) {
+	rel, err := filepath.Rel(siteRoot, filePath)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside the site root %s", filePath, siteRoot)
+	}
+
+	urlPath := "/" + rel
+	if name := path.Base(urlPath); name == "index.html" || name == "index.htm" {
+		urlPath = strings.TrimSuffix(urlPath, name)
+	}
+	return urlPath, nil
+}
+
+// WriteManifest writes a manifest as JSON to a file
+func WriteManifest(filePath string, manifest *Manifest) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	if err := WriteJSON(file, manifest); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return file.Close()
+}
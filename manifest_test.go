@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestURLPath(t *testing.T) {
+	tests := []struct {
+		root     string
+		file     string
+		expected string
+		wantErr  bool
+	}{
+		{"site", "site/index.html", "/", false},
+		{"site", "site/about.html", "/about.html", false},
+		{"site", "site/docs/index.htm", "/docs/", false},
+		{"site", "site/docs/guide/setup.html", "/docs/guide/setup.html", false},
+		{".", "index.html", "/", false},
+		{"site", "other/index.html", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := URLPath(filepath.FromSlash(tt.root), filepath.FromSlash(tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	pages := map[string]string{
+		"/":                   "default-src 'self'; script-src 'sha256-a'",
+		"/admin/":             "default-src 'self'; script-src 'sha256-b'",
+		"/admin/users.html":   "default-src 'self'; script-src 'sha256-b'",
+		"/blog/":              "default-src 'self'",
+		"/blog/a.html":        "default-src 'self'",
+		"/blog/2024/b.html":   "default-src 'self'",
+		"/docs/index.html":    "default-src 'self'",
+		"/docs/api/x.html":    "default-src 'self'; img-src *",
+		"/docs/api/y.html":    "default-src 'self'; img-src *",
+		"/docs/guide/z.html":  "default-src 'self'",
+		"/single/only.html":   "default-src 'self'",
+		"/mixed/one.html":     "default-src 'self'",
+		"/mixed/two.html":     "default-src 'self'; img-src *",
+		"/mixed/sub/3.html":   "default-src 'self'",
+		"/mixed/sub/4.html":   "default-src 'self'",
+		"/mixed/other/5.html": "default-src 'self'",
+	}
+
+	flat := NewManifest("default-src 'self'", pages, false)
+	if flat.Version != ManifestVersion || flat.Default != "default-src 'self'" || !reflect.DeepEqual(flat.Policies, pages) {
+		t.Errorf("Expected one entry per page, got %+v", flat)
+	}
+
+	grouped := NewManifest("default-src 'self'", pages, true)
+	expected := map[string]string{
+		"/":                   "default-src 'self'; script-src 'sha256-a'",
+		"/admin/*":            "default-src 'self'; script-src 'sha256-b'",
+		"/blog/*":             "default-src 'self'",
+		"/docs/index.html":    "default-src 'self'",
+		"/docs/api/*":         "default-src 'self'; img-src *",
+		"/docs/guide/z.html":  "default-src 'self'",
+		"/single/only.html":   "default-src 'self'",
+		"/mixed/one.html":     "default-src 'self'",
+		"/mixed/two.html":     "default-src 'self'; img-src *",
+		"/mixed/sub/*":        "default-src 'self'",
+		"/mixed/other/5.html": "default-src 'self'",
+	}
+	if !reflect.DeepEqual(grouped.Policies, expected) {
+		t.Errorf("Expected %v, got %v", expected, grouped.Policies)
+	}
+
+	same := NewManifest("default-src 'self'", map[string]string{"/": "default-src 'self'", "/a/b.html": "default-src 'self'"}, true)
+	if !reflect.DeepEqual(same.Policies, map[string]string{"/*": "default-src 'self'"}) {
+		t.Errorf("Expected a site with one policy to collapse into /*, got %v", same.Policies)
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	manifest := NewManifest("default-src 'self'", map[string]string{"/": "default-src 'self'; script-src 'sha256-a'"}, false)
+	if err := WriteManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Manifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, manifest) {
+		t.Errorf("Expected %+v, got %+v", manifest, decoded)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// destinationDirectives maps a request destination to its effective directive
+var destinationDirectives = map[string]string{
+	"script":       "script-src-elem",
+	"style":        "style-src-elem",
+	"stylesheet":   "style-src-elem",
+	"image":        "img-src",
+	"font":         "font-src",
+	"frame":        "frame-src",
+	"iframe":       "frame-src",
+	"fenced-frame": "fenced-frame-src",
+	"connect":      "connect-src",
+	"fetch":        "connect-src",
+	"websocket":    "connect-src",
+	"manifest":     "manifest-src",
+	"worker":       "worker-src",
+	"media":        "media-src",
+	"audio":        "media-src",
+	"video":        "media-src",
+	"track":        "media-src",
+	"object":       "object-src",
+	"embed":        "object-src",
+	"form":         "form-action",
+	"base":         "base-uri",
+}
+
+// MatchRequest describes a resource load to check against a policy
+type MatchRequest struct {
+	Origin      string // document origin, e.g. "https://example.com"
+	URL         string // requested URL, absolute or relative to Origin
+	Destination string // "script", "style", "image", "font", "frame", "connect", ...
+}
+
+// MatchResult describes whether a request is allowed and which directive decided
+type MatchResult struct {
+	Allowed   bool
+	Directive string // effective directive for the destination, e.g. "script-src-elem"
+	DecidedBy string // directive that was enforced after fallback, "" if none restricts the request
+	Source    string // source expression that allowed the request
+	Reason    string
+}
+
+// DirectiveForDestination returns the effective directive name for a request destination
+func DirectiveForDestination(destination string) (string, error) {
+	directive, ok := destinationDirectives[strings.ToLower(destination)]
+	if !ok {
+		return "", fmt.Errorf("unknown destination %q", destination)
+	}
+	return directive, nil
+}
+
+// policyAllows checks whether a policy allows a request, following the CSP3
+// "does request violate policy" algorithm for URL-based sources
+func policyAllows(p *Policy, req MatchRequest) (MatchResult, error) {
+	directiveName, err := DirectiveForDestination(req.Destination)
+	if err != nil {
+		return MatchResult{}, err
+	}
+
+	origin, err := url.Parse(req.Origin)
+	if err != nil || origin.Scheme == "" || origin.Host == "" {
+		return MatchResult{}, fmt.Errorf("invalid origin %q: must be an absolute URL such as https://example.com", req.Origin)
+	}
+
+	target, err := origin.Parse(req.URL)
+	if err != nil {
+		return MatchResult{}, fmt.Errorf("invalid URL %q: %w", req.URL, err)
+	}
+
+	result := MatchResult{Directive: directiveName}
+
+	// upgrade-insecure-requests rewrites http:/ws: requests before they are checked
+	upgraded := ""
+	if p.Has("upgrade-insecure-requests") {
+		switch target.Scheme {
+		case "http":
+			target.Scheme = "https"
+			upgraded = " (upgraded to https by upgrade-insecure-requests)"
+		case "ws":
+			target.Scheme = "wss"
+			upgraded = " (upgraded to wss by upgrade-insecure-requests)"
+		}
+	}
+
+	directive := p.Effective(directiveName)
+	if directive == nil {
+		result.Allowed = true
+		result.Reason = fmt.Sprintf("no %s or fallback directive restricts this request", directiveName)
+		return result, nil
+	}
+	result.DecidedBy = directive.Name
+
+	strictDynamic := directive.Has("'strict-dynamic'") && strings.HasPrefix(directiveName, "script-src")
+	if strictDynamic {
+		result.Reason = fmt.Sprintf("%s contains 'strict-dynamic', which ignores host and scheme sources; the script needs a nonce or hash%s", directive.Name, upgraded)
+		return result, nil
+	}
+
+	for _, src := range directive.Sources {
+		if sourceMatchesURL(src, target, origin) {
+			result.Allowed = true
+			result.Source = src.Value
+			result.Reason = fmt.Sprintf("allowed by %s in %s%s", src.Value, directive.Name, upgraded)
+			return result, nil
+		}
+	}
+
+	result.Reason = fmt.Sprintf("no source in %s matches %s%s", directive.Name, target.String(), upgraded)
+	return result, nil
+}
+
+// Allows checks a request against every policy in the list; the request is
+// allowed only if all policies allow it. The first blocking result is returned.
+func (pl *PolicyList) Allows(req MatchRequest) (MatchResult, error) {
+	var last MatchResult
+	for _, policy := range pl.Policies {
+		result, err := policyAllows(policy, req)
+		if err != nil {
+			return MatchResult{}, err
+		}
+		if !result.Allowed {
+			return result, nil
+		}
+		last = result
+	}
+	if len(pl.Policies) == 0 {
+		directive, err := DirectiveForDestination(req.Destination)
+		if err != nil {
+			return MatchResult{}, err
+		}
+		return MatchResult{Allowed: true, Directive: directive, Reason: "no policy"}, nil
+	}
+	return last, nil
+}
+
+// sourceMatchesURL implements "does url match expression in origin" for a single source expression
+func sourceMatchesURL(src SourceExpression, target, origin *url.URL) bool {
+	switch src.Kind {
+	case SourceKindScheme:
+		return schemePartMatches(strings.TrimSuffix(strings.ToLower(src.Value), ":"), target.Scheme)
+	case SourceKindKeyword:
+		if src.Equal("'self'") {
+			return selfMatches(target, origin)
+		}
+		return false
+	case SourceKindHost:
+		if src.Value == "*" {
+			switch target.Scheme {
+			case "http", "https", "ws", "wss":
+				return true
+			}
+			return target.Scheme == origin.Scheme
+		}
+		return hostSourceMatches(src.Value, target, origin)
+	}
+	return false
+}
+
+// schemePartMatches implements CSP3 scheme-part matching, including secure upgrades
+func schemePartMatches(expression, scheme string) bool {
+	expression, scheme = strings.ToLower(expression), strings.ToLower(scheme)
+	switch {
+	case expression == scheme:
+		return true
+	case expression == "http" && scheme == "https":
+		return true
+	case expression == "ws" && (scheme == "wss" || scheme == "http" || scheme == "https"):
+		return true
+	case expression == "wss" && scheme == "https":
+		return true
+	}
+	return false
+}
+
+// hostSourceMatches matches a host-source expression against a URL
+func hostSourceMatches(expression string, target, origin *url.URL) bool {
+	hs, ok := parseHostSource(expression)
+	if !ok || target.Hostname() == "" {
+		return false
+	}
+
+	if hs.Scheme == "" {
+		if !schemePartMatches(origin.Scheme, target.Scheme) {
+			return false
+		}
+	} else if !schemePartMatches(hs.Scheme, target.Scheme) {
+		return false
+	}
+
+	if !hostPartMatches(hs.Host, strings.ToLower(target.Hostname())) {
+		return false
+	}
+
+	if !portPartMatches(hs.Port, target) {
+		return false
+	}
+
+	return pathPartMatches(hs.Path, target.EscapedPath())
+}
+
+// hostPartMatches matches "*", "*.example.com" and exact host parts
+func hostPartMatches(pattern, host string) bool {
+	pattern = strings.TrimSuffix(pattern, ".")
+	host = strings.TrimSuffix(host, ".")
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+// portPartMatches compares the expression port with the URL port. An omitted port
+// matches only the default port of the URL's scheme.
+func portPartMatches(port string, target *url.URL) bool {
+	if port == "*" {
+		return true
+	}
+
+	targetPort := target.Port()
+	if targetPort == "" {
+		targetPort = defaultPort(target.Scheme)
+	}
+
+	if port == "" {
+		return targetPort == defaultPort(target.Scheme)
+	}
+	return port == targetPort
+}
+
+// pathPartMatches implements path-part matching: a path ending in "/" matches as a prefix,
+// anything else must match exactly
+func pathPartMatches(pattern, path string) bool {
+	if pattern == "" || pattern == "/" {
+		return true
+	}
+	pattern, _ = url.PathUnescape(pattern)
+	path, _ = url.PathUnescape(path)
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return pattern == path
+}
+
+// selfMatches implements the 'self' rules, including same-host scheme upgrades
+func selfMatches(target, origin *url.URL) bool {
+	if !strings.EqualFold(target.Hostname(), origin.Hostname()) {
+		return false
+	}
+
+	targetPort, originPort := target.Port(), origin.Port()
+	sameScheme := strings.EqualFold(target.Scheme, origin.Scheme)
+	if sameScheme && targetPort == originPort {
+		return true
+	}
+
+	portsCompatible := targetPort == originPort ||
+		(targetPort == "" || targetPort == defaultPort(target.Scheme)) &&
+			(originPort == "" || originPort == defaultPort(origin.Scheme))
+	if !portsCompatible {
+		return false
+	}
+
+	switch target.Scheme {
+	case "https", "wss":
+		return true
+	case "http", "ws":
+		return origin.Scheme == "http"
+	}
+	return false
+}
+
+// defaultPort returns the default port for a URL scheme
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	case "ftp":
+		return "21"
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name        string
+		csp         string
+		origin      string
+		url         string
+		destination string
+		allowed     bool
+		decidedBy   string
+	}{
+		{
+			name: "self same origin", csp: "script-src 'self'", origin: "https://example.com",
+			url: "https://example.com/app.js", destination: "script", allowed: true, decidedBy: "script-src",
+		},
+		{
+			name: "self relative url", csp: "script-src 'self'", origin: "https://example.com",
+			url: "/js/app.js", destination: "script", allowed: true, decidedBy: "script-src",
+		},
+		{
+			name: "self other host", csp: "script-src 'self'", origin: "https://example.com",
+			url: "https://cdn.example.com/app.js", destination: "script", allowed: false, decidedBy: "script-src",
+		},
+		{
+			name: "self scheme upgrade", csp: "script-src 'self'", origin: "http://example.com",
+			url: "https://example.com/app.js", destination: "script", allowed: true, decidedBy: "script-src",
+		},
+		{
+			name: "self no downgrade", csp: "script-src 'self'", origin: "https://example.com",
+			url: "http://example.com/app.js", destination: "script", allowed: false, decidedBy: "script-src",
+		},
+		{
+			name: "self websocket upgrade", csp: "connect-src 'self'", origin: "https://example.com",
+			url: "wss://example.com/socket", destination: "connect", allowed: true, decidedBy: "connect-src",
+		},
+		{
+			name: "script-src-elem takes precedence", csp: "script-src 'self'; script-src-elem https://cdn.example.com", origin: "https://example.com",
+			url: "https://example.com/app.js", destination: "script", allowed: false, decidedBy: "script-src-elem",
+		},
+		{
+			name: "fallback to default-src", csp: "default-src https://cdn.example.com", origin: "https://example.com",
+			url: "https://cdn.example.com/app.js", destination: "script", allowed: true, decidedBy: "default-src",
+		},
+		{
+			name: "worker falls back to child-src", csp: "default-src 'none'; child-src 'self'", origin: "https://example.com",
+			url: "/worker.js", destination: "worker", allowed: true, decidedBy: "child-src",
+		},
+		{
+			name: "no restricting directive", csp: "img-src 'self'", origin: "https://example.com",
+			url: "https://evil.com/app.js", destination: "script", allowed: true, decidedBy: "",
+		},
+		{
+			name: "none blocks", csp: "object-src 'none'", origin: "https://example.com",
+			url: "https://example.com/a.swf", destination: "object", allowed: false, decidedBy: "object-src",
+		},
+		{
+			name: "wildcard subdomain", csp: "img-src *.example.com", origin: "https://example.com",
+			url: "https://img.cdn.example.com/a.png", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "wildcard subdomain excludes apex", csp: "img-src *.example.com", origin: "https://example.com",
+			url: "https://example.com/a.png", destination: "image", allowed: false, decidedBy: "img-src",
+		},
+		{
+			name: "host without scheme uses origin scheme", csp: "img-src cdn.example.com", origin: "https://example.com",
+			url: "http://cdn.example.com/a.png", destination: "image", allowed: false, decidedBy: "img-src",
+		},
+		{
+			name: "http host source matches https", csp: "img-src http://cdn.example.com", origin: "https://example.com",
+			url: "https://cdn.example.com/a.png", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "explicit port", csp: "connect-src https://api.example.com:8443", origin: "https://example.com",
+			url: "https://api.example.com:8443/v1", destination: "connect", allowed: true, decidedBy: "connect-src",
+		},
+		{
+			name: "omitted port requires default", csp: "connect-src https://api.example.com", origin: "https://example.com",
+			url: "https://api.example.com:8443/v1", destination: "connect", allowed: false, decidedBy: "connect-src",
+		},
+		{
+			name: "wildcard port", csp: "connect-src https://api.example.com:*", origin: "https://example.com",
+			url: "https://api.example.com:8443/v1", destination: "connect", allowed: true, decidedBy: "connect-src",
+		},
+		{
+			name: "path prefix", csp: "script-src https://cdn.example.com/js/", origin: "https://example.com",
+			url: "https://cdn.example.com/js/lib/app.js", destination: "script", allowed: true, decidedBy: "script-src",
+		},
+		{
+			name: "path prefix mismatch", csp: "script-src https://cdn.example.com/js/", origin: "https://example.com",
+			url: "https://cdn.example.com/css/app.js", destination: "script", allowed: false, decidedBy: "script-src",
+		},
+		{
+			name: "exact path", csp: "script-src https://cdn.example.com/js/app.js", origin: "https://example.com",
+			url: "https://cdn.example.com/js/app.js?v=2", destination: "script", allowed: true, decidedBy: "script-src",
+		},
+		{
+			name: "scheme source", csp: "img-src data:", origin: "https://example.com",
+			url: "data:image/png;base64,AAAA", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "http scheme source matches https", csp: "img-src http:", origin: "https://example.com",
+			url: "https://cdn.example.com/a.png", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "star excludes data", csp: "img-src *", origin: "https://example.com",
+			url: "data:image/png;base64,AAAA", destination: "image", allowed: false, decidedBy: "img-src",
+		},
+		{
+			name: "star matches https", csp: "img-src *", origin: "https://example.com",
+			url: "https://anything.example.org/a.png", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "upgrade-insecure-requests", csp: "img-src https://cdn.example.com; upgrade-insecure-requests", origin: "https://example.com",
+			url: "http://cdn.example.com/a.png", destination: "image", allowed: true, decidedBy: "img-src",
+		},
+		{
+			name: "strict-dynamic ignores hosts", csp: "script-src 'strict-dynamic' 'nonce-abc' https://cdn.example.com", origin: "https://example.com",
+			url: "https://cdn.example.com/app.js", destination: "script", allowed: false, decidedBy: "script-src",
+		},
+		{
+			name: "form-action has no fallback", csp: "default-src 'none'", origin: "https://example.com",
+			url: "https://other.com/submit", destination: "form", allowed: true, decidedBy: "",
+		},
+		{
+			name: "duplicate directive uses first", csp: "img-src 'self'; img-src *", origin: "https://example.com",
+			url: "https://other.com/a.png", destination: "image", allowed: false, decidedBy: "img-src",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := policyAllows(ParsePolicy(tt.csp), MatchRequest{Origin: tt.origin, URL: tt.url, Destination: tt.destination})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed != tt.allowed {
+				t.Errorf("Expected allowed=%v, got %v (%s)", tt.allowed, result.Allowed, result.Reason)
+			}
+			if result.DecidedBy != tt.decidedBy {
+				t.Errorf("Expected decided by %q, got %q", tt.decidedBy, result.DecidedBy)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowsErrors(t *testing.T) {
+	policy := ParsePolicy("default-src 'self'")
+
+	if _, err := policyAllows(policy, MatchRequest{Origin: "https://example.com", URL: "/a.js", Destination: "bogus"}); err == nil {
+		t.Error("Expected an error for an unknown destination")
+	}
+	if _, err := policyAllows(policy, MatchRequest{Origin: "example.com", URL: "/a.js", Destination: "script"}); err == nil {
+		t.Error("Expected an error for a relative origin")
+	}
+}
+
+func TestPolicyListAllows(t *testing.T) {
+	list := ParsePolicyList("script-src 'self' https://cdn.example.com, script-src https://cdn.example.com")
+	origin := "https://example.com"
+
+	result, err := list.Allows(MatchRequest{Origin: origin, URL: "https://cdn.example.com/app.js", Destination: "script"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed {
+		t.Errorf("Expected URL allowed by both policies to be allowed: %s", result.Reason)
+	}
+
+	result, err = list.Allows(MatchRequest{Origin: origin, URL: "/app.js", Destination: "script"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Error("Expected URL blocked by the second policy to be blocked")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// metaHTTPEquiv is the http-equiv value of a CSP meta tag
+const metaHTTPEquiv = "Content-Security-Policy"
+
+// ReadMetaPolicy returns the policy of the first <meta http-equiv="Content-Security-Policy">
+// tag in an HTML file, and whether the file has one
+func ReadMetaPolicy(filePath string) (string, bool, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	tag := findMetaPolicyTag(scanSourceTags(source))
+	if tag == nil {
+		return "", false, nil
+	}
+	for _, attr := range tag.Attrs {
+		if attr.Key == "content" {
+			return attr.Val, true, nil
+		}
+	}
+	return "", true, nil
+}
+
+// findMetaPolicyTag returns the first CSP meta tag, or nil
+func findMetaPolicyTag(tags []*sourceTag) *sourceTag {
+	for _, tag := range tags {
+		if tag.Name != "meta" {
+			continue
+		}
+		for _, attr := range tag.Attrs {
+			if attr.Key == "http-equiv" && strings.EqualFold(strings.TrimSpace(attr.Val), metaHTTPEquiv) {
+				return tag
+			}
+		}
+	}
+	return nil
+}
+
+// MetaPolicy removes the directives that browsers ignore in a <meta> policy
+// (frame-ancestors, report-uri, sandbox) and returns the policy and the removed names
+func MetaPolicy(cspHeader string) (string, []string) {
+	policy := ParsePolicy(cspHeader)
+
+	var removed []string
+	for _, d := range policy.Directives {
+		info, ok := LookupDirective(d.Name)
+		if ok && !info.AllowedInMeta && !containsString(removed, info.Name) {
+			removed = append(removed, info.Name)
+		}
+	}
+	for _, name := range removed {
+		policy.Delete(name)
+	}
+	return policy.String(), removed
+}
+
+// SetMetaPolicy writes policy into the page's CSP meta tag. Pages without one get a new
+// tag at the top of <head>, ahead of anything else inserted there.
+func SetMetaPolicy(page *Page, policy string) {
+	if tag := findMetaPolicyTag(page.Tags); tag != nil {
+		tag.setAttr("content", policy)
+		return
+	}
+	page.InsertFirst(headStart(page.Tags), fmt.Sprintf(`<meta http-equiv="%s" content="%s">`, metaHTTPEquiv, escapeAttrValue(policy)))
+}
+
+// containsString reports whether a slice contains a string
+func containsString(items []string, item string) bool {
+	for _, s := range items {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
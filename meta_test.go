@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadMetaPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+		found    bool
+	}{
+		{"meta tag", `<head><meta http-equiv="Content-Security-Policy" content="default-src 'self'"></head>`, "default-src 'self'", true},
+		{"case insensitive", `<META HTTP-EQUIV="content-security-policy" CONTENT="img-src *">`, "img-src *", true},
+		{"first tag wins", `<meta http-equiv="Content-Security-Policy" content="a-src"><meta http-equiv="Content-Security-Policy" content="b-src">`, "a-src", true},
+		{"report-only is not a policy", `<meta http-equiv="Content-Security-Policy-Report-Only" content="default-src 'none'">`, "", false},
+		{"no meta tag", `<head><meta charset="utf-8"></head>`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "index.html")
+			os.WriteFile(path, []byte(tt.source), 0o644)
+
+			policy, found, err := ReadMetaPolicy(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if policy != tt.expected || found != tt.found {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.expected, tt.found, policy, found)
+			}
+		})
+	}
+}
+
+func TestMetaPolicy(t *testing.T) {
+	policy, removed := MetaPolicy("default-src 'self'; frame-ancestors 'none'; sandbox allow-scripts; report-uri /csp; report-to csp")
+
+	if policy != "default-src 'self'; report-to csp" {
+		t.Errorf("Unexpected meta policy: %s", policy)
+	}
+	if !reflect.DeepEqual(removed, []string{"frame-ancestors", "sandbox", "report-uri"}) {
+		t.Errorf("Unexpected removed directives: %v", removed)
+	}
+
+	if _, removed := MetaPolicy("default-src 'self'; x-custom a"); len(removed) != 0 {
+		t.Errorf("Expected nothing to be removed, got %v", removed)
+	}
+}
+
+func TestSetMetaPolicy(t *testing.T) {
+	policy := "default-src 'self'"
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			"replace",
+			`<head><meta http-equiv="Content-Security-Policy" content="img-src *"></head>`,
+			`<head><meta http-equiv="Content-Security-Policy" content="default-src 'self'"></head>`,
+		},
+		{
+			"insert into head",
+			"<!DOCTYPE html>\n<html><head><title>x</title></head></html>",
+			"<!DOCTYPE html>\n<html><head><meta http-equiv=\"Content-Security-Policy\" content=\"default-src 'self'\"><title>x</title></head></html>",
+		},
+		{
+			"no head",
+			"<!DOCTYPE html>\n<html>\n<p>x</p></html>",
+			"<!DOCTYPE html>\n<html>\n<meta http-equiv=\"Content-Security-Policy\" content=\"default-src 'self'\"><p>x</p></html>",
+		},
+		{
+			"text only",
+			"hello",
+			"<meta http-equiv=\"Content-Security-Policy\" content=\"default-src 'self'\">hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage("", []byte(tt.source))
+			SetMetaPolicy(page, policy)
+			got := string(page.Bytes())
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetMetaPolicyWithNonces(t *testing.T) {
+	page := NewPage("", []byte(`<html><head><script>run()</script></head></html>`))
+	page.InsertFirst(page.Tags[1].End, "<!-- first -->")
+	SetMetaPolicy(page, "script-src 'nonce-abc'")
+	AddNonces(page, "abc", NonceOptions{Scripts: true})
+
+	expected := `<html><head><meta http-equiv="Content-Security-Policy" content="script-src 'nonce-abc'"><!-- first --><script nonce="abc">run()</script></head></html>`
+	if got := string(page.Bytes()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
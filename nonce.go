@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"csp/httpcsp"
+)
+
+// NonceOptions selects the elements that receive a nonce attribute
+type NonceOptions struct {
+	Scripts         bool // inline <script> elements
+	Styles          bool // <style> elements
+	ExternalScripts bool // <script src> elements, needed when 'strict-dynamic' ignores host sources
+}
+
+// GenerateNonce returns a base64 encoded random nonce
+func GenerateNonce() (string, error) {
+	return httpcsp.GenerateNonce()
+}
+
+// AddNonces sets the nonce attribute on the selected elements of a page, replacing any
+// existing nonce, and returns the number of elements tagged. Elements replaced by
+// another rewrite are skipped.
+func AddNonces(page *Page, nonce string, opts NonceOptions) int {
+	count := 0
+	for _, tag := range page.Tags {
+		external := tag.Name == "script" && hasSourceAttr(tag, "src")
+		selected := tag.Name == "script" && !external && opts.Scripts ||
+			tag.Name == "style" && opts.Styles ||
+			external && opts.ExternalScripts
+		if selected && !page.Replaced(tag) {
+			tag.setAttr("nonce", nonce)
+			count++
+		}
+	}
+	return count
+}
+
+// InjectNonce sets the nonce attribute on the selected elements of an HTML source and
+// returns the rewritten source and the number of elements tagged. The rest of the
+// source is left untouched, so it also works on server-side templates.
+func InjectNonce(source []byte, nonce string, opts NonceOptions) ([]byte, int) {
+	page := NewPage("", source)
+	count := AddNonces(page, nonce, opts)
+	return page.Bytes(), count
+}
+
+// AddNonceToCSP adds 'nonce-<nonce>' to script-src and/or style-src, and 'strict-dynamic'
+// to script-src when requested
+func AddNonceToCSP(cspHeader, nonce string, opts NonceOptions, strictDynamic bool) string {
+	policy := ParsePolicy(cspHeader)
+	source := "'nonce-" + nonce + "'"
+
+	if opts.Scripts || opts.ExternalScripts {
+		scriptSrc := policy.Ensure("script-src")
+		scriptSrc.Add(source)
+		if strictDynamic {
+			scriptSrc.Add("'strict-dynamic'")
+		}
+	}
+
+	if opts.Styles {
+		policy.Ensure("style-src").Add(source)
+	}
+
+	return policy.String()
+}
+
+// placeholderNonce is a valid nonce substituted for a placeholder when validating a policy template
+const placeholderNonce = "UExBQ0VIT0xERVI="
+
+// CheckNoncePlaceholder reports whether a placeholder can be used both as an HTML
+// attribute value and inside a 'nonce-…' source
+func CheckNoncePlaceholder(placeholder string) error {
+	if placeholder == "" {
+		return fmt.Errorf("nonce placeholder must not be empty")
+	}
+	if strings.ContainsAny(placeholder, " \t\r\n'\";,<>&") {
+		return fmt.Errorf("nonce placeholder %q must not contain whitespace, quotes, ';', ',', '<', '>' or '&'", placeholder)
+	}
+	return nil
+}
+
+// ValidateNonceTemplate validates a policy template whose nonce is a placeholder, which
+// would otherwise be reported as an invalid nonce value
+func ValidateNonceTemplate(cspHeader, placeholder string) ValidationResult {
+	return ValidateCSP(strings.ReplaceAll(cspHeader, "'nonce-"+placeholder+"'", "'nonce-"+placeholderNonce+"'"))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateNonce(t *testing.T) {
+	first, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Error("Expected two nonces to differ")
+	}
+	if len(first) != 24 {
+		t.Errorf("Expected a 24 character base64 nonce (128 bits), got %q", first)
+	}
+	if problem := checkSourceExpression("'nonce-" + first + "'"); problem != nil {
+		t.Errorf("Generated nonce is not a valid nonce source: %s", problem.Message)
+	}
+}
+
+func TestInjectNonce(t *testing.T) {
+	source := "<html><head><script>a()</script><script src=\"app.js\"></script><style>p{}</style></head>\n" +
+		"<body onclick=\"go()\"><SCRIPT nonce=\"old\" >b()</SCRIPT></body></html>"
+
+	tests := []struct {
+		name     string
+		opts     NonceOptions
+		expected string
+		count    int
+	}{
+		{
+			name: "scripts and styles",
+			opts: NonceOptions{Scripts: true, Styles: true},
+			expected: "<html><head><script nonce=\"abc\">a()</script><script src=\"app.js\"></script><style nonce=\"abc\">p{}</style></head>\n" +
+				"<body onclick=\"go()\"><script nonce=\"abc\">b()</SCRIPT></body></html>",
+			count: 3,
+		},
+		{
+			name: "styles only",
+			opts: NonceOptions{Styles: true},
+			expected: "<html><head><script>a()</script><script src=\"app.js\"></script><style nonce=\"abc\">p{}</style></head>\n" +
+				"<body onclick=\"go()\"><SCRIPT nonce=\"old\" >b()</SCRIPT></body></html>",
+			count: 1,
+		},
+		{
+			name: "with external scripts",
+			opts: NonceOptions{Scripts: true, ExternalScripts: true},
+			expected: "<html><head><script nonce=\"abc\">a()</script><script nonce=\"abc\" src=\"app.js\"></script><style>p{}</style></head>\n" +
+				"<body onclick=\"go()\"><script nonce=\"abc\">b()</SCRIPT></body></html>",
+			count: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, count := InjectNonce([]byte(source), "abc", tt.opts)
+			if count != tt.count {
+				t.Errorf("Expected %d elements tagged, got %d", tt.count, count)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Unexpected output\nexpected: %s\ngot:      %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestInjectNoncePreservesTemplates(t *testing.T) {
+	source := "{{define \"head\"}}\n<script>var user = {{.User}};</script>\n{{end}}"
+	result, count := InjectNonce([]byte(source), "{{CSP_NONCE}}", NonceOptions{Scripts: true})
+
+	expected := "{{define \"head\"}}\n<script nonce=\"{{CSP_NONCE}}\">var user = {{.User}};</script>\n{{end}}"
+	if count != 1 || string(result) != expected {
+		t.Errorf("Expected template to be preserved\nexpected: %s\ngot:      %s", expected, result)
+	}
+}
+
+func TestAddNonceToCSP(t *testing.T) {
+	tests := []struct {
+		name          string
+		csp           string
+		opts          NonceOptions
+		strictDynamic bool
+		expected      string
+	}{
+		{
+			name:     "scripts and styles",
+			csp:      "default-src 'self'",
+			opts:     NonceOptions{Scripts: true, Styles: true},
+			expected: "default-src 'self'; script-src 'nonce-abc'; style-src 'nonce-abc'",
+		},
+		{
+			name:          "strict-dynamic",
+			csp:           "script-src 'self'",
+			opts:          NonceOptions{Scripts: true, ExternalScripts: true},
+			strictDynamic: true,
+			expected:      "script-src 'self' 'nonce-abc' 'strict-dynamic'",
+		},
+		{
+			name:     "replaces 'none'",
+			csp:      "style-src 'none'",
+			opts:     NonceOptions{Styles: true},
+			expected: "style-src 'nonce-abc'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AddNonceToCSP(tt.csp, "abc", tt.opts, tt.strictDynamic); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAddNoncesSavedPage(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "index.html")
+	output := filepath.Join(dir, "out", "index.html")
+	os.WriteFile(input, []byte(`<html><head><script>run()</script><style>p{}</style></head><body onclick="go()"></body></html>`), 0o644)
+
+	page, err := LoadPage(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := AddNonces(page, "abc", NonceOptions{Scripts: true, Styles: true})
+	if err := page.Save(output); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 elements tagged, got %d", count)
+	}
+
+	items, err := ExtractInlineItems(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := ParsePolicy(AddNonceToCSP("default-src 'self'", "abc", NonceOptions{Scripts: true, Styles: true}, false))
+	for _, item := range items {
+		result := policyAllowsInline(policy, item, SHA256)
+		if item.Type == ContentTypeEventHandler {
+			if result.Allowed {
+				t.Error("Expected the event handler not to be allowed by the nonce")
+			}
+			continue
+		}
+		if item.Nonce != "abc" || !result.Allowed {
+			t.Errorf("Expected %s to carry the nonce and be allowed, got nonce %q (%s)", item.Type, item.Nonce, result.Reason)
+		}
+	}
+}
+
+func TestCheckNoncePlaceholder(t *testing.T) {
+	valid := []string{"{{CSP_NONCE}}", "__CSP_NONCE__", "$cspNonce"}
+	for _, placeholder := range valid {
+		if err := CheckNoncePlaceholder(placeholder); err != nil {
+			t.Errorf("Expected %q to be accepted: %v", placeholder, err)
+		}
+	}
+
+	invalid := []string{"", "{{ .Nonce }}", "a'b", "a;b", "a,b", "<%= nonce %>", "a&b"}
+	for _, placeholder := range invalid {
+		if err := CheckNoncePlaceholder(placeholder); err == nil {
+			t.Errorf("Expected %q to be rejected", placeholder)
+		}
+	}
+}
+
+func TestValidateNonceTemplate(t *testing.T) {
+	csp := "default-src 'self'; script-src 'nonce-{{CSP_NONCE}}'"
+
+	if result := ValidateCSP(csp); result.Valid {
+		t.Error("Expected the raw template to fail nonce validation")
+	}
+	if result := ValidateNonceTemplate(csp, "{{CSP_NONCE}}"); !result.Valid || len(result.Warnings) != 0 {
+		t.Errorf("Expected the template to validate cleanly, got %+v", result.Warnings)
+	}
+}
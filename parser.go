@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
@@ -8,69 +9,160 @@ import (
 	"golang.org/x/net/html"
 )
 
+// Inline content types, matching HashInfo.ContentType
+const (
+	ContentTypeScript       = "script"
+	ContentTypeStyleTag     = "style-tag"
+	ContentTypeStyleAttr    = "style-attr"
+	ContentTypeEventHandler = "event-handler"
+)
+
+// InlineContent is a single inline script, style tag, style attribute or event handler
+type InlineContent struct {
+	Type      string // one of the ContentType* constants
+	Content   string
+	Element   string // tag name of the element carrying the content
+	Attribute string // attribute name for style attributes and event handlers
+	Nonce     string // nonce attribute of <script> and <style> elements
+	Line      int    // 1-based line of the element's start tag, 0 if unknown
+	Column    int    // 1-based column of the element's start tag, 0 if unknown
+}
+
 // ExtractInlineContent parses an HTML file and extracts inline script and style content
 // Returns scripts, styleTags, styleAttributes, hasEventHandlers, error
 func ExtractInlineContent(filePath string, noScripts, noStyles, noInlineStyles, noEventHandlers bool) (scripts []string, styleTags []string, styleAttributes []string, hasEventHandlers bool, err error) {
+	doc, err := parseHTMLFile(filePath)
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+
+	scripts = []string{}
+	styleTags = []string{}
+	styleAttributes = []string{}
+	hasEventHandlers = false
+
+	walkInlineContent(doc, func(n *html.Node, item InlineContent) {
+		switch item.Type {
+		case ContentTypeScript:
+			if !noScripts {
+				scripts = append(scripts, item.Content)
+			}
+		case ContentTypeStyleTag:
+			if !noStyles {
+				styleTags = append(styleTags, item.Content)
+			}
+		case ContentTypeEventHandler:
+			if !noEventHandlers {
+				scripts = append(scripts, item.Content)
+				hasEventHandlers = true
+			}
+		case ContentTypeStyleAttr:
+			if !noInlineStyles {
+				styleAttributes = append(styleAttributes, item.Content)
+			}
+		}
+	})
+
+	return scripts, styleTags, styleAttributes, hasEventHandlers, nil
+}
+
+// ExtractInlineItems parses an HTML file and returns all of its inline content in document order,
+// and with the position of the element each item belongs to
+func ExtractInlineItems(filePath string) ([]InlineContent, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return ParseInlineItems(source)
+}
+
+// ParseInlineItems is ExtractInlineItems for an HTML document in memory
+func ParseInlineItems(source []byte) ([]InlineContent, error) {
+	doc, err := html.Parse(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	items := []InlineContent{}
+	walkInlineContent(doc, func(n *html.Node, item InlineContent) {
+		items = append(items, item)
+	})
+	locateInlineItems(scanSourceTags(source), items)
+	return items, nil
+}
+
+// parseHTMLFile opens and parses an HTML file
+func parseHTMLFile(filePath string) (*html.Node, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, nil, nil, false, fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	doc, err := html.Parse(file)
 	if err != nil {
-		return nil, nil, nil, false, fmt.Errorf("failed to parse HTML: %w", err)
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
 	}
+	return doc, nil
+}
 
-	scripts = []string{}
-	styleTags = []string{}
-	styleAttributes = []string{}
-	hasEventHandlers = false
-
-	var traverse func(*html.Node)
-	traverse = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			if n.Data == "script" && !noScripts {
-				// Check if it's an inline script (no src attribute)
-				hasSource := false
-				for _, attr := range n.Attr {
-					if attr.Key == "src" {
-						hasSource = true
-						break
-					}
-				}
-				if !hasSource {
-					// Extract text content
-					content := extractTextContent(n)
-					scripts = append(scripts, content)
-				}
-			} else if n.Data == "style" && !noStyles {
-				// Extract inline style content
-				content := extractTextContent(n)
-				styleTags = append(styleTags, content)
+// walkInlineContent calls fn, in document order, for every inline <script> (without src),
+// <style> tag, event handler attribute and style attribute below n. For elements, the
+// element content is reported before the element's attributes.
+func walkInlineContent(n *html.Node, fn func(n *html.Node, item InlineContent)) {
+	if n.Type == html.ElementNode {
+		if n.Data == "script" {
+			// Check if it's an inline script (no src attribute)
+			if getAttr(n, "src") == nil {
+				fn(n, InlineContent{Type: ContentTypeScript, Content: extractTextContent(n), Element: n.Data, Nonce: getAttrValue(n, "nonce")})
 			}
+		} else if n.Data == "style" {
+			fn(n, InlineContent{Type: ContentTypeStyleTag, Content: extractTextContent(n), Element: n.Data, Nonce: getAttrValue(n, "nonce")})
+		}
 
-			// Extract inline event handler attributes and style attributes from any element
-			for _, attr := range n.Attr {
-				if isEventHandler(attr.Key) && !noEventHandlers {
-					scripts = append(scripts, attr.Val)
-					hasEventHandlers = true
-					continue
-				}
-				if strings.EqualFold(attr.Key, "style") && !noInlineStyles {
-					styleAttributes = append(styleAttributes, attr.Val)
-				}
+		// Inline event handler attributes and style attributes can appear on any element
+		for _, attr := range n.Attr {
+			if isEventHandler(attr.Key) {
+				fn(n, InlineContent{Type: ContentTypeEventHandler, Content: attr.Val, Element: n.Data, Attribute: attr.Key})
+				continue
+			}
+			if strings.EqualFold(attr.Key, "style") {
+				fn(n, InlineContent{Type: ContentTypeStyleAttr, Content: attr.Val, Element: n.Data, Attribute: attr.Key})
 			}
 		}
+	}
 
-		// Traverse children
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			traverse(c)
+	// Traverse children
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkInlineContent(c, fn)
+	}
+}
+
+// getAttr returns the attribute with the given key, or nil if the element does not have it
+func getAttr(n *html.Node, key string) *html.Attribute {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			return &n.Attr[i]
 		}
 	}
+	return nil
+}
 
-	traverse(doc)
-	return scripts, styleTags, styleAttributes, hasEventHandlers, nil
+// setAttr sets an attribute, replacing any existing value
+func setAttr(n *html.Node, key, val string) {
+	if attr := getAttr(n, key); attr != nil {
+		attr.Val = val
+		return
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// getAttrValue returns the value of an attribute, or "" if the element does not have it
+func getAttrValue(n *html.Node, key string) string {
+	if attr := getAttr(n, key); attr != nil {
+		return attr.Val
+	}
+	return ""
 }
 
 // isEventHandler checks if an attribute name is an event handler
@@ -127,17 +219,24 @@ func extractTextContent(n *html.Node) string {
 
 // ExtractExternalResources parses an HTML file and extracts external resource URLs
 func ExtractExternalResources(filePath string) (*ExternalResources, error) {
-	file, err := os.Open(filePath)
+	doc, err := parseHTMLFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	return externalResourcesOf(doc), nil
+}
 
-	doc, err := html.Parse(file)
+// ParseExternalResources is ExtractExternalResources for an HTML document in memory
+func ParseExternalResources(source []byte) (*ExternalResources, error) {
+	doc, err := html.Parse(bytes.NewReader(source))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse HTML: %w", err)
 	}
+	return externalResourcesOf(doc), nil
+}
 
+// externalResourcesOf extracts the external resource URLs of a parsed document
+func externalResourcesOf(doc *html.Node) *ExternalResources {
 	resources := &ExternalResources{
 		Scripts:      []ExternalResource{},
 		Stylesheets:  []ExternalResource{},
@@ -252,7 +351,7 @@ func ExtractExternalResources(filePath string) (*ExternalResources, error) {
 	}
 
 	traverse(doc)
-	return resources, nil
+	return resources
 }
 
 // extractCSSURLs extracts URLs from CSS content
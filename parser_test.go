@@ -24,6 +24,43 @@ func TestExtractInlineContent(t *testing.T) {
 	}
 }
 
+func TestExtractInlineItems(t *testing.T) {
+	html := "<html><head><style nonce=\"n1\">p{}</style></head>\n" +
+		"<body onload=\"init()\">\n" +
+		"<script nonce=\"n2\" onerror=\"fail()\">run()</script>\n" +
+		"<script src=\"app.js\"></script>\n" +
+		"  <div style=\"color:red\" onclick=\"go()\"></div></body></html>"
+	tmpfile, err := os.CreateTemp("", "test*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte(html))
+	tmpfile.Close()
+
+	items, err := ExtractInlineItems(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []InlineContent{
+		{Type: ContentTypeStyleTag, Content: "p{}", Element: "style", Nonce: "n1", Line: 1, Column: 13},
+		{Type: ContentTypeEventHandler, Content: "init()", Element: "body", Attribute: "onload", Line: 2, Column: 1},
+		{Type: ContentTypeScript, Content: "run()", Element: "script", Nonce: "n2", Line: 3, Column: 1},
+		{Type: ContentTypeEventHandler, Content: "fail()", Element: "script", Attribute: "onerror", Line: 3, Column: 1},
+		{Type: ContentTypeStyleAttr, Content: "color:red", Element: "div", Attribute: "style", Line: 5, Column: 3},
+		{Type: ContentTypeEventHandler, Content: "go()", Element: "div", Attribute: "onclick", Line: 5, Column: 3},
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d items, got %d: %+v", len(expected), len(items), items)
+	}
+	for i := range expected {
+		if items[i] != expected[i] {
+			t.Errorf("Item %d: expected %+v, got %+v", i, expected[i], items[i])
+		}
+	}
+}
+
 func TestIsEventHandler(t *testing.T) {
 	if !isEventHandler("onclick") {
 		t.Error("onclick should be recognized as event handler")
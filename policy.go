@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+
+	"csp/policy"
+)
+
+// The policy model is shared with httpcsp through package policy
+type (
+	Policy           = policy.Policy
+	Directive        = policy.Directive
+	SourceExpression = policy.SourceExpression
+	SerializeOptions = policy.SerializeOptions
+)
+
+// Source expression kinds
+const (
+	SourceKindKeyword = policy.SourceKindKeyword
+	SourceKindNonce   = policy.SourceKindNonce
+	SourceKindHash    = policy.SourceKindHash
+	SourceKindScheme  = policy.SourceKindScheme
+	SourceKindHost    = policy.SourceKindHost
+)
+
+// ParsePolicy parses a single serialized CSP into a Policy
+func ParsePolicy(cspHeader string) *Policy {
+	return policy.Parse(cspHeader)
+}
+
+// NewDirective creates a directive with the given source tokens
+func NewDirective(name string, tokens ...string) *Directive {
+	return policy.NewDirective(name, tokens...)
+}
+
+// ParseSourceExpression classifies a single source list token
+func ParseSourceExpression(token string) SourceExpression {
+	return policy.ParseSourceExpression(token)
+}
+
+// hostSource is the parsed form of a host-source expression:
+// [ scheme "://" ] host [ ":" port ] [ path ]
+type hostSource struct {
+	Scheme string
+	Host   string
+	Port   string
+	Path   string
+}
+
+// parseHostSource splits a host-source expression into its parts. It only checks
+// the structure; ok is false when no host part is present.
+func parseHostSource(value string) (hs hostSource, ok bool) {
+	rest := value
+	if idx := strings.Index(rest, "://"); idx != -1 {
+		hs.Scheme = strings.ToLower(rest[:idx])
+		rest = rest[idx+3:]
+	}
+
+	if idx := strings.Index(rest, "/"); idx != -1 {
+		hs.Path = rest[idx:]
+		rest = rest[:idx]
+	}
+
+	if idx := strings.LastIndex(rest, ":"); idx != -1 {
+		hs.Port = rest[idx+1:]
+		rest = rest[:idx]
+	}
+
+	hs.Host = strings.ToLower(rest)
+	return hs, hs.Host != ""
+}
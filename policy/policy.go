@@ -0,0 +1,324 @@
+// Package policy models a serialized Content Security Policy: an ordered list of
+// directives and their source lists, parsed from and serialized back to a header value.
+// The csp command and the httpcsp middleware both edit policies through it.
+package policy
+
+import (
+	"strings"
+)
+
+// Source expression kinds
+const (
+	SourceKindKeyword = "keyword" // 'self', 'none', 'unsafe-inline', ...
+	SourceKindNonce   = "nonce"   // 'nonce-...'
+	SourceKindHash    = "hash"    // 'sha256-...', 'sha384-...', 'sha512-...'
+	SourceKindScheme  = "scheme"  // https:, data:, ...
+	SourceKindHost    = "host"    // example.com, https://*.example.com:443/path
+)
+
+// SourceExpression is a single token of a directive's source list
+type SourceExpression struct {
+	Value string // the token as written in the policy
+	Kind  string // one of the SourceKind* constants
+}
+
+// ParseSourceExpression classifies a single source list token
+func ParseSourceExpression(token string) SourceExpression {
+	return SourceExpression{Value: token, Kind: sourceKind(token)}
+}
+
+// sourceKind determines the kind of a source list token
+func sourceKind(token string) string {
+	lower := strings.ToLower(token)
+
+	if strings.HasPrefix(lower, "'") {
+		switch {
+		case strings.HasPrefix(lower, "'nonce-"):
+			return SourceKindNonce
+		case strings.HasPrefix(lower, "'sha256-"),
+			strings.HasPrefix(lower, "'sha384-"),
+			strings.HasPrefix(lower, "'sha512-"):
+			return SourceKindHash
+		default:
+			return SourceKindKeyword
+		}
+	}
+
+	if IsSchemeSource(lower) {
+		return SourceKindScheme
+	}
+
+	return SourceKindHost
+}
+
+// IsSchemeSource reports whether a token has the form "scheme:"
+func IsSchemeSource(token string) bool {
+	if len(token) < 2 || !strings.HasSuffix(token, ":") {
+		return false
+	}
+
+	scheme := token[:len(token)-1]
+	for i, c := range scheme {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether the expression is the same source as token.
+// Keywords and schemes are compared case-insensitively, everything else exactly.
+func (se SourceExpression) Equal(token string) bool {
+	switch se.Kind {
+	case SourceKindKeyword, SourceKindScheme:
+		return strings.EqualFold(se.Value, token)
+	default:
+		return se.Value == token
+	}
+}
+
+// Directive is a single named directive with its tokenized source list
+type Directive struct {
+	Name    string
+	Sources []SourceExpression
+}
+
+// NewDirective creates a directive with the given source tokens
+func NewDirective(name string, tokens ...string) *Directive {
+	d := &Directive{Name: strings.ToLower(name), Sources: []SourceExpression{}}
+	d.Add(tokens...)
+	return d
+}
+
+// Has reports whether the directive contains the given source token
+func (d *Directive) Has(token string) bool {
+	for _, src := range d.Sources {
+		if src.Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasKind reports whether the directive contains a source of the given kind
+func (d *Directive) HasKind(kind string) bool {
+	for _, src := range d.Sources {
+		if src.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Add appends source tokens that are not already present, preserving order.
+// 'none' is dropped once any other source is added, since it has no effect alongside other sources.
+func (d *Directive) Add(tokens ...string) {
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" || d.Has(token) {
+			continue
+		}
+		src := ParseSourceExpression(token)
+		if !src.Equal("'none'") {
+			d.Remove("'none'")
+		} else if len(d.Sources) > 0 {
+			continue
+		}
+		d.Sources = append(d.Sources, src)
+	}
+}
+
+// Remove deletes every occurrence of a source token and reports whether anything was removed
+func (d *Directive) Remove(token string) bool {
+	kept := d.Sources[:0]
+	removed := false
+	for _, src := range d.Sources {
+		if src.Equal(token) {
+			removed = true
+			continue
+		}
+		kept = append(kept, src)
+	}
+	d.Sources = kept
+	return removed
+}
+
+// Values returns the source tokens as strings
+func (d *Directive) Values() []string {
+	values := make([]string, 0, len(d.Sources))
+	for _, src := range d.Sources {
+		values = append(values, src.Value)
+	}
+	return values
+}
+
+// String serializes the directive as "name source1 source2 ..."
+func (d *Directive) String() string {
+	if len(d.Sources) == 0 {
+		return d.Name
+	}
+	return d.Name + " " + strings.Join(d.Values(), " ")
+}
+
+// Policy is an ordered list of directives as they appear in a CSP header.
+// Duplicate directives are kept, but only the first one is effective,
+// matching how browsers enforce a policy.
+type Policy struct {
+	Directives []*Directive
+}
+
+// Parse parses a single serialized CSP into a Policy.
+// Directive names are lower-cased and source lists are tokenized on whitespace.
+func Parse(cspHeader string) *Policy {
+	policy := &Policy{Directives: []*Directive{}}
+
+	for _, part := range strings.Split(cspHeader, ";") {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		directive := &Directive{Name: strings.ToLower(tokens[0]), Sources: []SourceExpression{}}
+		for _, token := range tokens[1:] {
+			directive.Sources = append(directive.Sources, ParseSourceExpression(token))
+		}
+		policy.Directives = append(policy.Directives, directive)
+	}
+
+	return policy
+}
+
+// Get returns the effective (first) directive with the given name, or nil
+func (p *Policy) Get(name string) *Directive {
+	name = strings.ToLower(name)
+	for _, d := range p.Directives {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Has reports whether the policy contains a directive with the given name
+func (p *Policy) Has(name string) bool {
+	return p.Get(name) != nil
+}
+
+// Ensure returns the effective directive with the given name, appending an empty one if missing
+func (p *Policy) Ensure(name string) *Directive {
+	if d := p.Get(name); d != nil {
+		return d
+	}
+	d := NewDirective(name)
+	p.Directives = append(p.Directives, d)
+	return d
+}
+
+// AddSources adds sources to the effective directive with the given name. A missing
+// directive is created from a copy of default-src, so that the sources default-src
+// already allowed keep working once the new directive no longer falls back to it.
+func (p *Policy) AddSources(name string, sources ...string) {
+	if len(sources) == 0 {
+		return
+	}
+
+	directive := p.Get(name)
+	if directive == nil {
+		directive = p.Ensure(name)
+		if defaultSrc := p.Get("default-src"); defaultSrc != nil {
+			directive.Add(defaultSrc.Values()...)
+		}
+	}
+
+	directive.Add(sources...)
+}
+
+// Delete removes every directive with the given name
+func (p *Policy) Delete(name string) {
+	name = strings.ToLower(name)
+	kept := p.Directives[:0]
+	for _, d := range p.Directives {
+		if d.Name != name {
+			kept = append(kept, d)
+		}
+	}
+	p.Directives = kept
+}
+
+// Duplicates returns the names of directives that appear more than once, in order of first repetition
+func (p *Policy) Duplicates() []string {
+	seen := make(map[string]int)
+	var duplicates []string
+	for _, d := range p.Directives {
+		seen[d.Name]++
+		if seen[d.Name] == 2 {
+			duplicates = append(duplicates, d.Name)
+		}
+	}
+	return duplicates
+}
+
+// Clone returns a deep copy of the policy
+func (p *Policy) Clone() *Policy {
+	clone := &Policy{Directives: make([]*Directive, 0, len(p.Directives))}
+	for _, d := range p.Directives {
+		sources := make([]SourceExpression, len(d.Sources))
+		copy(sources, d.Sources)
+		clone.Directives = append(clone.Directives, &Directive{Name: d.Name, Sources: sources})
+	}
+	return clone
+}
+
+// String serializes the policy in directive order, separated by "; "
+func (p *Policy) String() string {
+	parts := make([]string, 0, len(p.Directives))
+	for _, d := range p.Directives {
+		parts = append(parts, d.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// directiveFallbacks lists, for each fetch directive, the directives consulted in order
+// when it is absent from a policy (CSP3 "directive fallback list")
+var directiveFallbacks = map[string][]string{
+	"script-src-elem": {"script-src", "default-src"},
+	"script-src-attr": {"script-src", "default-src"},
+	"script-src":      {"default-src"},
+	"style-src-elem":  {"style-src", "default-src"},
+	"style-src-attr":  {"style-src", "default-src"},
+	"style-src":       {"default-src"},
+	"worker-src":      {"child-src", "script-src", "default-src"},
+	"frame-src":       {"child-src", "default-src"},
+	"child-src":       {"default-src"},
+	"connect-src":     {"default-src"},
+	"font-src":        {"default-src"},
+	"img-src":         {"default-src"},
+	"manifest-src":    {"default-src"},
+	"media-src":       {"default-src"},
+	"object-src":      {"default-src"},
+	"prefetch-src":    {"default-src"},
+}
+
+// Fallbacks returns the directives consulted in order when name is absent from a policy
+func Fallbacks(name string) []string {
+	return directiveFallbacks[strings.ToLower(name)]
+}
+
+// Effective returns the directive that governs name, following the fetch directive
+// fallback chain (e.g. script-src-elem -> script-src -> default-src). It returns nil
+// when nothing in the policy restricts name.
+func (p *Policy) Effective(name string) *Directive {
+	name = strings.ToLower(name)
+	if d := p.Get(name); d != nil {
+		return d
+	}
+	for _, fallback := range directiveFallbacks[name] {
+		if d := p.Get(fallback); d != nil {
+			return d
+		}
+	}
+	return nil
+}
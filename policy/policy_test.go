@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	policy := Parse("default-src 'self'; Script-Src 'unsafe-inline' https://cdn.example.com;; upgrade-insecure-requests")
+
+	if len(policy.Directives) != 3 {
+		t.Fatalf("Expected 3 directives, got %d", len(policy.Directives))
+	}
+
+	scriptSrc := policy.Get("script-src")
+	if scriptSrc == nil {
+		t.Fatal("Expected script-src to be found case-insensitively")
+	}
+	if scriptSrc.Name != "script-src" {
+		t.Errorf("Expected directive name to be lower-cased, got %q", scriptSrc.Name)
+	}
+	if len(scriptSrc.Sources) != 2 {
+		t.Errorf("Expected 2 sources, got %d", len(scriptSrc.Sources))
+	}
+
+	upgrade := policy.Get("upgrade-insecure-requests")
+	if upgrade == nil || len(upgrade.Sources) != 0 {
+		t.Error("Expected upgrade-insecure-requests without sources")
+	}
+}
+
+func TestParseKeepsFirstDuplicate(t *testing.T) {
+	policy := Parse("script-src 'self'; script-src https://evil.example.com")
+
+	if len(policy.Directives) != 2 {
+		t.Errorf("Expected duplicates to be kept, got %d directives", len(policy.Directives))
+	}
+	if !policy.Get("script-src").Has("'self'") {
+		t.Error("Expected the first script-src to be effective")
+	}
+
+	duplicates := policy.Duplicates()
+	if len(duplicates) != 1 || duplicates[0] != "script-src" {
+		t.Errorf("Expected script-src to be reported as duplicate, got %v", duplicates)
+	}
+}
+
+func TestParseSourceExpression(t *testing.T) {
+	tests := []struct {
+		token string
+		kind  string
+	}{
+		{"'self'", SourceKindKeyword},
+		{"'UNSAFE-INLINE'", SourceKindKeyword},
+		{"'nonce-abc123'", SourceKindNonce},
+		{"'sha256-abc='", SourceKindHash},
+		{"'sha384-abc='", SourceKindHash},
+		{"'sha512-abc='", SourceKindHash},
+		{"https:", SourceKindScheme},
+		{"data:", SourceKindScheme},
+		{"https://cdn.example.com", SourceKindHost},
+		{"*.example.com", SourceKindHost},
+		{"*", SourceKindHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if kind := ParseSourceExpression(tt.token).Kind; kind != tt.kind {
+				t.Errorf("ParseSourceExpression(%q).Kind = %q, expected %q", tt.token, kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDirectiveAdd(t *testing.T) {
+	directive := NewDirective("script-src", "'self'", "https://example.com")
+	directive.Add("https://cdn.example.com", "https://example.com", "'SELF'")
+
+	expected := "script-src 'self' https://example.com https://cdn.example.com"
+	if directive.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, directive.String())
+	}
+}
+
+func TestDirectiveAddReplacesNone(t *testing.T) {
+	directive := NewDirective("img-src", "'none'")
+	directive.Add("data:")
+
+	if directive.String() != "img-src data:" {
+		t.Errorf("Expected 'none' to be dropped, got %q", directive.String())
+	}
+
+	directive.Add("'none'")
+	if directive.Has("'none'") {
+		t.Error("Expected 'none' not to be added alongside other sources")
+	}
+}
+
+func TestDirectiveRemove(t *testing.T) {
+	directive := NewDirective("script-src", "'self'", "https://example.com")
+
+	if !directive.Remove("'self'") {
+		t.Error("Expected Remove to report a removal")
+	}
+	if directive.Remove("'self'") {
+		t.Error("Expected Remove to report nothing removed")
+	}
+	if directive.String() != "script-src https://example.com" {
+		t.Errorf("Unexpected directive after removal: %q", directive.String())
+	}
+}
+
+func TestPolicyEnsureAndDelete(t *testing.T) {
+	policy := Parse("default-src 'self'")
+	policy.Ensure("img-src").Add("data:")
+	policy.Ensure("default-src").Add("https://example.com")
+
+	expected := "default-src 'self' https://example.com; img-src data:"
+	if policy.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, policy.String())
+	}
+
+	policy.Delete("default-src")
+	if policy.String() != "img-src data:" {
+		t.Errorf("Expected only img-src to remain, got %q", policy.String())
+	}
+}
+
+func TestPolicyClone(t *testing.T) {
+	policy := Parse("script-src 'self'")
+	clone := policy.Clone()
+	clone.Get("script-src").Add("https://example.com")
+
+	if policy.Get("script-src").Has("https://example.com") {
+		t.Error("Modifying a clone should not affect the original policy")
+	}
+}
+
+func TestPolicyAddSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		csp      string
+		expected string
+	}{
+		{"existing directive", "default-src 'self'; script-src 'none'", "default-src 'self'; script-src https://cdn.example.com"},
+		{"copies default-src", "default-src 'self'", "default-src 'self'; script-src 'self' https://cdn.example.com"},
+		{"under default-src 'none'", "default-src 'none'", "default-src 'none'; script-src https://cdn.example.com"},
+		{"first duplicate", "script-src 'self'; script-src 'none'", "script-src 'self' https://cdn.example.com; script-src 'none'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Parse(tt.csp)
+			policy.AddSources("script-src", "https://cdn.example.com")
+			if policy.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, policy.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"sort"
+	"strings"
+)
+
+// canonicalDirectiveOrder is the directive order used by canonical serialization.
+// It follows the order produced by GenerateStrictCSP; directives not listed here
+// are emitted afterwards in alphabetical order.
+var canonicalDirectiveOrder = []string{
+	"default-src",
+	"script-src",
+	"style-src",
+	"img-src",
+	"font-src",
+	"connect-src",
+	"manifest-src",
+	"worker-src",
+	"frame-src",
+	"object-src",
+	"media-src",
+	"child-src",
+	"prefetch-src",
+	"fenced-frame-src",
+	"script-src-elem",
+	"script-src-attr",
+	"style-src-elem",
+	"style-src-attr",
+	"sandbox",
+	"trusted-types",
+	"report-to",
+	"report-uri",
+	"base-uri",
+	"form-action",
+	"frame-ancestors",
+	"navigate-to",
+	"webrtc",
+	"require-trusted-types-for",
+	"upgrade-insecure-requests",
+	"block-all-mixed-content",
+	"plugin-types",
+	"referrer",
+}
+
+// sourceKindOrder is the order of source groups when sources are sorted
+var sourceKindOrder = map[string]int{
+	SourceKindKeyword: 0,
+	SourceKindNonce:   1,
+	SourceKindScheme:  2,
+	SourceKindHost:    3,
+	SourceKindHash:    4,
+}
+
+// SerializeOptions controls how a policy is turned back into a string
+type SerializeOptions struct {
+	Canonical   bool // Reorder directives canonically, drop ignored duplicates and normalize sources
+	SortSources bool // Group sources by kind and sort host and hash sources
+	Pretty      bool // Emit one directive per line instead of a single header line
+}
+
+// Serialize formats the policy according to opts. The same policy and options
+// always produce the same bytes.
+func (p *Policy) Serialize(opts SerializeOptions) string {
+	policy := p
+	if opts.Canonical {
+		policy = p.Canonical()
+	}
+	if opts.SortSources {
+		policy = policy.Clone()
+		for _, d := range policy.Directives {
+			sortSources(d.Sources)
+		}
+	}
+
+	if !opts.Pretty {
+		return policy.String()
+	}
+
+	lines := make([]string, 0, len(policy.Directives))
+	for _, d := range policy.Directives {
+		lines = append(lines, d.String()+";")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Canonical returns a normalized copy of the policy: directives in canonical order,
+// only the first (effective) occurrence of each directive, lower-cased keywords and
+// schemes, and no duplicate sources.
+func (p *Policy) Canonical() *Policy {
+	canonical := &Policy{Directives: []*Directive{}}
+	seen := make(map[string]bool)
+
+	for _, d := range p.Directives {
+		if seen[d.Name] {
+			continue
+		}
+		seen[d.Name] = true
+
+		directive := &Directive{Name: strings.ToLower(d.Name), Sources: []SourceExpression{}}
+		for _, src := range d.Sources {
+			token := src.Value
+			if src.Kind == SourceKindKeyword || src.Kind == SourceKindScheme {
+				token = strings.ToLower(token)
+			}
+			if !directive.Has(token) {
+				directive.Sources = append(directive.Sources, ParseSourceExpression(token))
+			}
+		}
+		canonical.Directives = append(canonical.Directives, directive)
+	}
+
+	rank := make(map[string]int, len(canonicalDirectiveOrder))
+	for i, name := range canonicalDirectiveOrder {
+		rank[name] = i
+	}
+
+	sort.SliceStable(canonical.Directives, func(i, j int) bool {
+		a, b := canonical.Directives[i].Name, canonical.Directives[j].Name
+		rankA, knownA := rank[a]
+		rankB, knownB := rank[b]
+		switch {
+		case knownA && knownB:
+			return rankA < rankB
+		case knownA != knownB:
+			return knownA
+		default:
+			return a < b
+		}
+	})
+
+	return canonical
+}
+
+// sortSources groups sources by kind and sorts host and hash sources.
+// Keywords, nonces and schemes keep their relative order.
+func sortSources(sources []SourceExpression) {
+	sort.SliceStable(sources, func(i, j int) bool {
+		a, b := sources[i], sources[j]
+		if a.Kind != b.Kind {
+			return sourceKindOrder[a.Kind] < sourceKindOrder[b.Kind]
+		}
+		if a.Kind == SourceKindHost || a.Kind == SourceKindHash {
+			return a.Value < b.Value
+		}
+		return false
+	})
+}
@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestSerializeDefaultPreservesOrder(t *testing.T) {
+	input := "worker-src 'self'; default-src 'none'; media-src https://media.example.com"
+	result := Parse(input).Serialize(SerializeOptions{})
+
+	if result != input {
+		t.Errorf("Expected %q, got %q", input, result)
+	}
+}
+
+func TestSerializeCanonical(t *testing.T) {
+	input := "Upgrade-Insecure-Requests; worker-src 'SELF' 'self'; x-custom a; manifest-src 'self'; default-src 'none'; MEDIA-SRC HTTPS: https:; default-src *"
+	expected := "default-src 'none'; manifest-src 'self'; worker-src 'self'; media-src https:; upgrade-insecure-requests; x-custom a"
+
+	for i := 0; i < 20; i++ {
+		result := Parse(input).Serialize(SerializeOptions{Canonical: true})
+		if result != expected {
+			t.Fatalf("Expected %q, got %q", expected, result)
+		}
+	}
+}
+
+func TestSerializeSortSources(t *testing.T) {
+	input := "script-src 'sha256-b=' https://b.example.com 'self' 'sha256-a=' https://a.example.com 'nonce-x' https: 'unsafe-hashes'"
+	expected := "script-src 'self' 'unsafe-hashes' 'nonce-x' https: https://a.example.com https://b.example.com 'sha256-a=' 'sha256-b='"
+
+	result := Parse(input).Serialize(SerializeOptions{SortSources: true})
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestSerializeSortSourcesDoesNotModifyPolicy(t *testing.T) {
+	policy := Parse("script-src https://b.example.com https://a.example.com")
+	policy.Serialize(SerializeOptions{SortSources: true})
+
+	if policy.String() != "script-src https://b.example.com https://a.example.com" {
+		t.Errorf("Serialize should not modify the policy, got %q", policy.String())
+	}
+}
+
+func TestSerializePretty(t *testing.T) {
+	input := "default-src 'none'; script-src 'self'; upgrade-insecure-requests"
+	expected := "default-src 'none';\nscript-src 'self';\nupgrade-insecure-requests;"
+
+	result := Parse(input).Serialize(SerializeOptions{Pretty: true})
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	// Pretty output must parse back to the same policy
+	if Parse(result).String() != input {
+		t.Errorf("Pretty output did not round-trip, got %q", Parse(result).String())
+	}
+}
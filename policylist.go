@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+)
+
+// PolicyList is the set of policies enforced on a single document, e.g. the
+// comma-separated policies of a Content-Security-Policy header plus a <meta> policy.
+// A resource is only allowed if every policy in the list allows it.
+type PolicyList struct {
+	Policies []*Policy
+}
+
+// ParsePolicyList parses a serialized CSP list. Policies are separated by commas;
+// policies without any directive are dropped.
+func ParsePolicyList(header string) *PolicyList {
+	list := &PolicyList{Policies: []*Policy{}}
+	for _, part := range strings.Split(header, ",") {
+		policy := ParsePolicy(part)
+		if len(policy.Directives) == 0 {
+			continue
+		}
+		list.Policies = append(list.Policies, policy)
+	}
+	return list
+}
+
+// Add appends the policies of another header (or <meta> tag) to the list
+func (pl *PolicyList) Add(header string) {
+	pl.Policies = append(pl.Policies, ParsePolicyList(header).Policies...)
+}
+
+// String serializes the list as a single header value, separated by ", "
+func (pl *PolicyList) String() string {
+	parts := make([]string, 0, len(pl.Policies))
+	for _, policy := range pl.Policies {
+		parts = append(parts, policy.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// intersectedTokenDirectives are directives whose values are flags rather than
+// sources; the effective value keeps only the flags present in every policy
+var intersectedTokenDirectives = map[string]bool{
+	"sandbox":       true,
+	"trusted-types": true,
+}
+
+// Effective computes a single policy that is equivalent to (or stricter than) enforcing
+// every policy in the list. Source lists are intersected; a source from one policy is
+// kept only if the other policy allows it too. Sources whose overlap cannot be decided
+// statically (e.g. 'self' against a host) are dropped, erring on the strict side.
+func (pl *PolicyList) Effective() *Policy {
+	if len(pl.Policies) == 0 {
+		return &Policy{Directives: []*Directive{}}
+	}
+
+	effective := dedupeDirectives(pl.Policies[0])
+
+	for _, other := range pl.Policies[1:] {
+		effective = intersectPolicies(effective, dedupeDirectives(other))
+	}
+	return effective
+}
+
+// dedupeDirectives returns a copy of the policy with only the first occurrence of each directive
+func dedupeDirectives(policy *Policy) *Policy {
+	result := &Policy{Directives: []*Directive{}}
+	for _, d := range policy.Clone().Directives {
+		if !result.Has(d.Name) {
+			result.Directives = append(result.Directives, d)
+		}
+	}
+	return result
+}
+
+// intersectPolicies computes the effective policy of enforcing both a and b
+func intersectPolicies(a, b *Policy) *Policy {
+	var names []string
+	seen := make(map[string]bool)
+	for _, policy := range []*Policy{a, b} {
+		for _, d := range policy.Directives {
+			if !seen[d.Name] {
+				seen[d.Name] = true
+				names = append(names, d.Name)
+			}
+		}
+	}
+
+	result := &Policy{Directives: []*Directive{}}
+	for _, name := range names {
+		sourceList := isSourceListDirective(name)
+		da, db := a.Get(name), b.Get(name)
+		if sourceList {
+			da, db = a.Effective(name), b.Effective(name)
+		}
+
+		switch {
+		case da == nil:
+			result.Directives = append(result.Directives, NewDirective(name, db.Values()...))
+		case db == nil:
+			result.Directives = append(result.Directives, NewDirective(name, da.Values()...))
+		case intersectedTokenDirectives[name]:
+			result.Directives = append(result.Directives, intersectTokens(name, da, db))
+		case sourceList:
+			result.Directives = append(result.Directives, intersectSourceLists(name, da, db))
+		default:
+			result.Directives = append(result.Directives, NewDirective(name, da.Values()...))
+		}
+	}
+	return result
+}
+
+// intersectTokens keeps the tokens present in both directives
+func intersectTokens(name string, a, b *Directive) *Directive {
+	result := NewDirective(name)
+	for _, src := range a.Sources {
+		if b.Has(src.Value) {
+			result.Add(src.Value)
+		}
+	}
+	return result
+}
+
+// intersectSourceLists keeps every source of one list that the other list also allows
+func intersectSourceLists(name string, a, b *Directive) *Directive {
+	result := NewDirective(name)
+	for _, src := range a.Sources {
+		if sourceListCovers(b, src) {
+			result.Add(src.Value)
+		}
+	}
+	for _, src := range b.Sources {
+		if sourceListCovers(a, src) {
+			result.Add(src.Value)
+		}
+	}
+	if ignoresUnsafeInline(name, a) || ignoresUnsafeInline(name, b) {
+		// The list that ignores it blocks inline content without a matching hash or nonce
+		result.Remove("'unsafe-inline'")
+	}
+	if len(result.Sources) == 0 {
+		result.Add("'none'")
+	}
+	return result
+}
+
+// ignoresUnsafeInline reports whether browsers ignore 'unsafe-inline' in a directive,
+// because it has hashes or nonces, or 'strict-dynamic' in a script directive
+func ignoresUnsafeInline(name string, d *Directive) bool {
+	if d.HasKind(SourceKindHash) || d.HasKind(SourceKindNonce) {
+		return true
+	}
+	return strings.HasPrefix(name, "script-src") && d.Has("'strict-dynamic'")
+}
+
+// sourceListCovers reports whether everything src allows is also allowed by list
+func sourceListCovers(list *Directive, src SourceExpression) bool {
+	if src.Equal("'none'") || list.Has("'none'") && len(list.Sources) == 1 {
+		return false
+	}
+	if list.Has(src.Value) {
+		return true
+	}
+	if src.Equal("'self'") {
+		// The document's origin is a network origin for pages served over http(s)
+		return list.Has("*") || list.Has("http:") || list.Has("https:")
+	}
+
+	switch src.Kind {
+	case SourceKindScheme:
+		scheme := strings.TrimSuffix(strings.ToLower(src.Value), ":")
+		return list.Has("*") && !isLocalScheme(scheme)
+	case SourceKindHost:
+		hs, ok := parseHostSource(src.Value)
+		if !ok {
+			return false
+		}
+		for _, other := range list.Sources {
+			if hostSourceCovers(other, hs) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hostSourceCovers reports whether the source expression covers every URL matched by hs
+func hostSourceCovers(other SourceExpression, hs hostSource) bool {
+	switch other.Kind {
+	case SourceKindScheme:
+		return hs.Scheme != "" && strings.EqualFold(other.Value, hs.Scheme+":")
+	case SourceKindHost:
+		if other.Value == "*" {
+			return !isLocalScheme(hs.Scheme)
+		}
+		ohs, ok := parseHostSource(other.Value)
+		if !ok {
+			return false
+		}
+		if ohs.Scheme != "" && ohs.Scheme != hs.Scheme {
+			return false
+		}
+		if ohs.Host != hs.Host && !(strings.HasPrefix(ohs.Host, "*.") && strings.HasSuffix(hs.Host, ohs.Host[1:])) {
+			return false
+		}
+		if ohs.Port != "*" && ohs.Port != hs.Port {
+			return false
+		}
+		if ohs.Path == "" || ohs.Path == hs.Path {
+			return true
+		}
+		return strings.HasSuffix(ohs.Path, "/") && strings.HasPrefix(hs.Path, ohs.Path)
+	}
+	return false
+}
+
+// isLocalScheme reports whether a scheme is never matched by the "*" source
+func isLocalScheme(scheme string) bool {
+	switch scheme {
+	case "data", "blob", "filesystem":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePolicyList(t *testing.T) {
+	list := ParsePolicyList("default-src 'self'; script-src 'self', script-src https://cdn.example.com, ,")
+
+	if len(list.Policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(list.Policies))
+	}
+	if !list.Policies[1].Get("script-src").Has("https://cdn.example.com") {
+		t.Error("Expected second policy to contain https://cdn.example.com")
+	}
+
+	expected := "default-src 'self'; script-src 'self', script-src https://cdn.example.com"
+	if list.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, list.String())
+	}
+}
+
+func TestPolicyListAdd(t *testing.T) {
+	list := ParsePolicyList("default-src 'self'")
+	list.Add("img-src data:")
+
+	if len(list.Policies) != 2 {
+		t.Errorf("Expected 2 policies after Add, got %d", len(list.Policies))
+	}
+}
+
+func TestPolicyListEffective(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{
+			name:     "single policy",
+			header:   "default-src 'self'; script-src 'self'; script-src *",
+			expected: "default-src 'self'; script-src 'self'",
+		},
+		{
+			name:     "identical sources are kept",
+			header:   "script-src 'self' https://a.example.com, script-src https://a.example.com",
+			expected: "script-src https://a.example.com",
+		},
+		{
+			name:     "fallback to default-src",
+			header:   "default-src 'self' https:, script-src https://cdn.example.com 'self'",
+			expected: "default-src 'self' https:; script-src 'self' https://cdn.example.com",
+		},
+		{
+			name:     "wildcard host",
+			header:   "img-src *.example.com, img-src https://img.example.com https://other.com",
+			expected: "img-src https://img.example.com",
+		},
+		{
+			name:     "path prefix",
+			header:   "script-src https://cdn.example.com/js/, script-src https://cdn.example.com/js/app.js https://cdn.example.com/css/a.css",
+			expected: "script-src https://cdn.example.com/js/app.js",
+		},
+		{
+			name:     "'self' under a wildcard",
+			header:   "script-src 'self', script-src *",
+			expected: "script-src 'self'",
+		},
+		{
+			name:     "'self' under a network scheme",
+			header:   "script-src 'self' https://a.example.com, script-src https:",
+			expected: "script-src 'self' https://a.example.com",
+		},
+		{
+			name:     "'unsafe-inline' ignored because of a hash",
+			header:   "script-src 'unsafe-inline', script-src 'unsafe-inline' 'sha256-x'",
+			expected: "script-src 'none'",
+		},
+		{
+			name:     "'unsafe-inline' ignored because of 'strict-dynamic'",
+			header:   "script-src 'self' 'unsafe-inline', script-src 'self' 'unsafe-inline' 'strict-dynamic'",
+			expected: "script-src 'self'",
+		},
+		{
+			name:     "'unsafe-inline' kept next to 'strict-dynamic' outside scripts",
+			header:   "style-src 'unsafe-inline', style-src 'unsafe-inline' 'strict-dynamic'",
+			expected: "style-src 'unsafe-inline'",
+		},
+		{
+			name:     "disjoint lists become none",
+			header:   "script-src https://a.example.com, script-src https://b.example.com",
+			expected: "script-src 'none'",
+		},
+		{
+			name:     "sandbox flags are intersected",
+			header:   "sandbox allow-scripts allow-forms, sandbox allow-scripts",
+			expected: "sandbox allow-scripts",
+		},
+		{
+			name:     "directive only in one policy",
+			header:   "default-src 'self', upgrade-insecure-requests; frame-ancestors 'none'",
+			expected: "default-src 'self'; upgrade-insecure-requests; frame-ancestors 'none'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParsePolicyList(tt.header).Effective().String()
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProxyOptions configures the policies the proxy adds to HTML responses
+type ProxyOptions struct {
+	Policy          string // base policy; "" uses the upstream's own policy, or a strict policy if it sends none
+	ReportOnly      bool   // send the policy in Content-Security-Policy-Report-Only, keeping the upstream's policy
+	IncludeExternal bool   // add the domains of the page's external resources
+	Algorithm       HashAlgorithm
+	Log             io.Writer // receives the policy delta of each page when it changes; nil disables logging
+}
+
+// cspProxy computes the policy of each HTML response passing through a reverse proxy
+type cspProxy struct {
+	opts   ProxyOptions
+	mu     sync.Mutex
+	deltas map[string]string // last logged delta by URL path
+}
+
+// NewProxy returns a reverse proxy to upstream that adds to every HTML response a policy
+// allowing its inline content. Response bodies are passed through unchanged.
+func NewProxy(upstream *url.URL, opts ProxyOptions) *httputil.ReverseProxy {
+	p := &cspProxy{opts: opts, deltas: map[string]string{}}
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+			// Only gzip can be decoded to read the page, so do not let the upstream use
+			// another encoding; without gzip, the transport negotiates and decodes it
+			if acceptsGzip(r.In.Header.Get("Accept-Encoding")) {
+				r.Out.Header.Set("Accept-Encoding", "gzip")
+			} else {
+				r.Out.Header.Del("Accept-Encoding")
+			}
+		},
+		ModifyResponse: p.modifyResponse,
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// modifyResponse sets the policy header of an HTML response
+func (p *cspProxy) modifyResponse(resp *http.Response) error {
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	if !strings.EqualFold(strings.TrimSpace(mediaType), "text/html") ||
+		resp.StatusCode == http.StatusNotModified || resp.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	target := resp.Request.Method + " " + resp.Request.URL.Path
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		p.logf("%s: cannot decode %s content, passed through without a policy\n", target, encoding)
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	source := body
+	if encoding == "gzip" {
+		if source, err = gunzip(body); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", target, err)
+		}
+	}
+
+	base, strict := p.opts.Policy, false
+	if base == "" {
+		base = resp.Header.Get(cspHeaderName)
+	}
+	if base == "" {
+		base, strict = GenerateStrictCSP(GetDefaultStrictTemplate()), true
+	}
+	policy, err := ProxyPolicy(base, strict, source, p.opts)
+	if err != nil {
+		return fmt.Errorf("failed to compute the policy of %s: %w", target, err)
+	}
+
+	header := cspHeaderName
+	if p.opts.ReportOnly {
+		header = cspReportOnlyHeaderName
+	}
+	resp.Header.Set(header, policy)
+	p.logDelta(resp.Request.URL.Path, target, base, policy)
+	return nil
+}
+
+// gunzip decodes a gzip encoded body
+func gunzip(body []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// ProxyPolicy adds the hashes of the inline content of an HTML document, and the domains
+// of its external resources if requested, to a base policy
+func ProxyPolicy(base string, strict bool, source []byte, opts ProxyOptions) (string, error) {
+	items, err := ParseInlineItems(source)
+	if err != nil {
+		return "", err
+	}
+
+	var scriptHashes, styleTagHashes, styleAttrHashes []string
+	hasEventHandlers := false
+	for _, item := range items {
+		hash := ComputeHash(item.Content, opts.Algorithm)
+		switch item.Type {
+		case ContentTypeScript:
+			scriptHashes = append(scriptHashes, hash)
+		case ContentTypeEventHandler:
+			scriptHashes = append(scriptHashes, hash)
+			hasEventHandlers = true
+		case ContentTypeStyleTag:
+			styleTagHashes = append(styleTagHashes, hash)
+		case ContentTypeStyleAttr:
+			styleAttrHashes = append(styleAttrHashes, hash)
+		}
+	}
+	scriptHashes = removeDuplicates(scriptHashes)
+	styleTagHashes = removeDuplicates(styleTagHashes)
+	styleAttrHashes = removeDuplicates(styleAttrHashes)
+
+	var policy string
+	if strict {
+		policy, err = MergeStrictCSPWithHashes(base, scriptHashes, styleTagHashes, styleAttrHashes, hasEventHandlers)
+	} else {
+		policy, err = UpdateCSP(base, scriptHashes, styleTagHashes, styleAttrHashes, hasEventHandlers)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.IncludeExternal {
+		resources, err := ParseExternalResources(source)
+		if err != nil {
+			return "", err
+		}
+		policy = AddExternalResourcesToCSP(policy, resources)
+	}
+	return policy, nil
+}
+
+// logDelta logs what a page's policy adds to the base policy, unless the same delta was
+// logged for its path last time
+func (p *cspProxy) logDelta(urlPath, target, base, policy string) {
+	delta := FormatPolicyDelta(DiffPolicies(ParsePolicy(base), ParsePolicy(policy)))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, seen := p.deltas[urlPath]; seen && last == delta {
+		return
+	}
+	p.deltas[urlPath] = delta
+	if delta == "" {
+		delta = "no change to the base policy"
+	}
+	p.logf("%s: %s\n", target, delta)
+}
+
+// logf writes a line to the log, if any
+func (p *cspProxy) logf(format string, args ...any) {
+	if p.opts.Log != nil {
+		fmt.Fprintf(p.opts.Log, format, args...)
+	}
+}
+
+// FormatPolicyDelta summarizes the changes between two policies on one line, such as
+// "script-src +'sha256-…'; img-src +https://cdn.example.com", or "" when there are none.
+// Directives added without sources or removed entirely are listed as +name or -name.
+func FormatPolicyDelta(changes []DirectiveChange) string {
+	var parts []string
+	for _, change := range changes {
+		var sources []string
+		switch change.Status {
+		case ChangeAdded:
+			if len(change.Added) == 0 {
+				parts = append(parts, "+"+change.Name)
+				continue
+			}
+		case ChangeRemoved:
+			parts = append(parts, "-"+change.Name)
+			continue
+		case ChangeUnchanged:
+			continue
+		}
+		for _, src := range change.Added {
+			sources = append(sources, "+"+src)
+		}
+		for _, src := range change.Removed {
+			sources = append(sources, "-"+src)
+		}
+		parts = append(parts, change.Name+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// runProxy implements the "csp proxy" subcommand: it serves the upstream application and
+// adds a computed policy to its HTML responses. It returns the process exit code.
+func runProxy(args []string) int {
+	fs := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	upstreamFlag := fs.String("upstream", "", "URL of the application to proxy, e.g. http://localhost:3000")
+	listen := fs.String("listen", ":8080", "Address to listen on")
+	cspFlag := fs.String("csp", "", "Base policy (default: the upstream's Content-Security-Policy header, or a strict policy)")
+	reportOnly := fs.Bool("report-only", false, "Send the policy in Content-Security-Policy-Report-Only and keep the upstream's policy")
+	includeExternal := fs.Bool("include-external", false, "Add the domains of each page's external resources")
+	hashAlgo := fs.String("hash-algo", "sha256", "Hash algorithm to use: sha256, sha384, or sha512")
+	quiet := fs.Bool("quiet", false, "Do not log the policy delta of each page")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: csp proxy --upstream URL [--listen ADDR] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Forward requests to the upstream application and add to each HTML response a\n")
+		fmt.Fprintf(os.Stderr, "policy allowing its inline content. The policy delta of each page is logged.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  csp proxy --upstream http://localhost:3000 --listen :8080\n")
+		fmt.Fprintf(os.Stderr, "  csp proxy --upstream http://localhost:3000 --csp \"default-src 'self'\" --include-external --report-only\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *upstreamFlag == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	upstream, err := url.Parse(*upstreamFlag)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --upstream URL %q, expected http://host:port\n", *upstreamFlag)
+		return 2
+	}
+
+	opts := ProxyOptions{Policy: *cspFlag, ReportOnly: *reportOnly, IncludeExternal: *includeExternal, Log: os.Stderr}
+	if *quiet {
+		opts.Log = nil
+	}
+	switch *hashAlgo {
+	case "sha256":
+		opts.Algorithm = SHA256
+	case "sha384":
+		opts.Algorithm = SHA384
+	case "sha512":
+		opts.Algorithm = SHA512
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid hash algorithm '%s'. Must be sha256, sha384, or sha512\n", *hashAlgo)
+		return 2
+	}
+
+	fmt.Fprintf(os.Stderr, "Proxying %s to %s\n", *listen, upstream)
+	if err := http.ListenAndServe(*listen, NewProxy(upstream, opts)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const proxyTestPage = `<html><head><script>init()</script></head><body><img src="https://images.example.com/a.png"></body></html>`
+
+// newProxyTestServers starts an upstream application and a proxy in front of it
+func newProxyTestServers(t *testing.T, opts ProxyOptions) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				t.Errorf("Expected the proxy to request gzip only, got %q", r.Header.Get("Accept-Encoding"))
+			}
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(proxyTestPage))
+			zw.Close()
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(buf.Bytes())
+		case "/app.js":
+			w.Header().Set("Content-Type", "text/javascript")
+			io.WriteString(w, "init()")
+		case "/with-policy":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Security-Policy", "default-src 'self'")
+			io.WriteString(w, proxyTestPage)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, proxyTestPage)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(NewProxy(upstreamURL, opts))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestProxy(t *testing.T) {
+	initHash := ComputeHash("init()", SHA256)
+
+	tests := []struct {
+		name           string
+		opts           ProxyOptions
+		path           string
+		gzip           bool
+		header         string
+		expected       string
+		upstreamPolicy string
+	}{
+		{
+			name:     "base policy",
+			opts:     ProxyOptions{Policy: "default-src 'self'", Algorithm: SHA256},
+			path:     "/",
+			header:   "Content-Security-Policy",
+			expected: "default-src 'self'; script-src " + initHash,
+		},
+		{
+			name:     "gzip with external resources",
+			opts:     ProxyOptions{Policy: "default-src 'self'", IncludeExternal: true, Algorithm: SHA256},
+			path:     "/gzip",
+			gzip:     true,
+			header:   "Content-Security-Policy",
+			expected: "default-src 'self'; script-src " + initHash + "; img-src 'self' https://images.example.com",
+		},
+		{
+			name:     "upstream policy as base",
+			opts:     ProxyOptions{Algorithm: SHA256},
+			path:     "/with-policy",
+			header:   "Content-Security-Policy",
+			expected: "default-src 'self'; script-src " + initHash,
+		},
+		{
+			name:           "report only",
+			opts:           ProxyOptions{ReportOnly: true, Algorithm: SHA256},
+			path:           "/with-policy",
+			header:         "Content-Security-Policy-Report-Only",
+			expected:       "default-src 'self'; script-src " + initHash,
+			upstreamPolicy: "default-src 'self'",
+		},
+		{
+			name:   "not html",
+			opts:   ProxyOptions{Policy: "default-src 'self'", Algorithm: SHA256},
+			path:   "/app.js",
+			header: "Content-Security-Policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := newProxyTestServers(t, tt.opts)
+
+			req, err := http.NewRequest(http.MethodGet, proxy.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", "gzip, br")
+			resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if policy := resp.Header.Get(tt.header); policy != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.header, tt.expected, policy)
+			}
+			if tt.upstreamPolicy != "" && resp.Header.Get("Content-Security-Policy") != tt.upstreamPolicy {
+				t.Errorf("Expected the upstream policy to be kept, got %q", resp.Header.Get("Content-Security-Policy"))
+			}
+
+			// The body is passed through in its original encoding
+			if tt.gzip {
+				if resp.Header.Get("Content-Encoding") != "gzip" {
+					t.Fatalf("Expected a gzip response, got %q", resp.Header.Get("Content-Encoding"))
+				}
+				if body, err = gunzip(body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.path != "/app.js" && string(body) != proxyTestPage {
+				t.Errorf("Expected the page unchanged, got %q", body)
+			}
+		})
+	}
+}
+
+func TestProxyLogsDelta(t *testing.T) {
+	var log bytes.Buffer
+	proxy := newProxyTestServers(t, ProxyOptions{Policy: "default-src 'self'; img-src 'none'", IncludeExternal: true, Algorithm: SHA256, Log: &log})
+
+	for _, path := range []string{"/", "/", "/app.js", "/other"} {
+		resp, err := http.Get(proxy.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	delta := "img-src +https://images.example.com -'none'; script-src +" + ComputeHash("init()", SHA256)
+	expected := "GET /: " + delta + "\nGET /other: " + delta + "\n"
+	if log.String() != expected {
+		t.Errorf("Expected log:\n%s\ngot:\n%s", expected, log.String())
+	}
+}
+
+func TestFormatPolicyDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected string
+	}{
+		{
+			name:     "no change",
+			before:   "default-src 'self'",
+			after:    "default-src 'self'",
+			expected: "",
+		},
+		{
+			name:     "added and modified directives",
+			before:   "default-src 'self'; img-src 'none'",
+			after:    "default-src 'self'; img-src https://a.example.com; script-src 'self' 'sha256-abc'; upgrade-insecure-requests",
+			expected: "img-src +https://a.example.com -'none'; script-src +'self' +'sha256-abc'; +upgrade-insecure-requests",
+		},
+		{
+			name:     "removed directive",
+			before:   "default-src 'self'; object-src 'none'",
+			after:    "default-src 'self'",
+			expected: "-object-src",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FormatPolicyDelta(DiffPolicies(ParsePolicy(tt.before), ParsePolicy(tt.after)))
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"gzip, deflate, br", true},
+		{"br", false},
+		{"GZIP;q=0.5", true},
+		{"gzip; q=0", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if result := acceptsGzip(tt.header); result != tt.expected {
+			t.Errorf("acceptsGzip(%q) = %v, expected %v", tt.header, result, tt.expected)
+		}
+	}
+}
+
+func TestProxyPolicyStrict(t *testing.T) {
+	policy, err := ProxyPolicy(GenerateStrictCSP(GetDefaultStrictTemplate()), true, []byte(`<div onclick="go()"></div>`), ProxyOptions{Algorithm: SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(policy, ComputeHash("go()", SHA256)+" 'unsafe-hashes'") {
+		t.Errorf("Expected the event handler hash with 'unsafe-hashes', got %q", policy)
+	}
+}
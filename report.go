@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directive change statuses
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeModified  = "modified"
+	ChangeUnchanged = "unchanged"
+)
+
+// FileReport summarizes the inline content and external domains found in one HTML file
+type FileReport struct {
+	File            string   `json:"file"`
+	Scripts         int      `json:"scripts"`
+	StyleTags       int      `json:"style_tags"`
+	StyleAttributes int      `json:"style_attributes"`
+	EventHandlers   int      `json:"event_handlers"`
+	Domains         []string `json:"domains"`
+}
+
+// Count records one inline item in the report
+func (fr *FileReport) Count(item InlineContent) {
+	switch item.Type {
+	case ContentTypeScript:
+		fr.Scripts++
+	case ContentTypeStyleTag:
+		fr.StyleTags++
+	case ContentTypeStyleAttr:
+		fr.StyleAttributes++
+	case ContentTypeEventHandler:
+		fr.EventHandlers++
+	}
+}
+
+// DirectiveChange describes how one directive differs between two policies
+type DirectiveChange struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`            // one of the Change* constants
+	Before  []string `json:"before,omitempty"`  // sources in the old policy
+	After   []string `json:"after,omitempty"`   // sources in the new policy
+	Added   []string `json:"added,omitempty"`   // sources only in the new policy
+	Removed []string `json:"removed,omitempty"` // sources only in the old policy
+}
+
+// DiffPolicies compares two policies directive by directive. Directives are listed in
+// the order of the new policy, followed by directives that were removed.
+func DiffPolicies(before, after *Policy) []DirectiveChange {
+	changes := []DirectiveChange{}
+
+	for _, d := range after.Directives {
+		if containsChange(changes, d.Name) {
+			continue
+		}
+		old := before.Get(d.Name)
+		if old == nil {
+			changes = append(changes, DirectiveChange{Name: d.Name, Status: ChangeAdded, After: d.Values(), Added: d.Values()})
+			continue
+		}
+
+		change := DirectiveChange{Name: d.Name, Status: ChangeUnchanged, Before: old.Values(), After: d.Values()}
+		for _, src := range d.Sources {
+			if !old.Has(src.Value) {
+				change.Added = append(change.Added, src.Value)
+			}
+		}
+		for _, src := range old.Sources {
+			if !d.Has(src.Value) {
+				change.Removed = append(change.Removed, src.Value)
+			}
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			change.Status = ChangeModified
+		}
+		changes = append(changes, change)
+	}
+
+	for _, d := range before.Directives {
+		if after.Has(d.Name) || containsChange(changes, d.Name) {
+			continue
+		}
+		changes = append(changes, DirectiveChange{Name: d.Name, Status: ChangeRemoved, Before: d.Values(), Removed: d.Values()})
+	}
+
+	return changes
+}
+
+// containsChange reports whether a change for the directive is already listed
+func containsChange(changes []DirectiveChange, name string) bool {
+	for _, change := range changes {
+		if change.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReport prints the per-file analysis and the directive-by-directive policy diff
+func PrintReport(files []FileReport, before, after string) {
+	fmt.Println("CSP Report (dry run, no header generated)")
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, fr := range files {
+		fmt.Printf("\n%s\n", fr.File)
+		fmt.Printf("  Inline scripts:    %d\n", fr.Scripts)
+		fmt.Printf("  Style tags:        %d\n", fr.StyleTags)
+		fmt.Printf("  Style attributes:  %d\n", fr.StyleAttributes)
+		fmt.Printf("  Event handlers:    %d\n", fr.EventHandlers)
+		if len(fr.Domains) > 0 {
+			fmt.Printf("  External domains:  %s\n", strings.Join(fr.Domains, ", "))
+		} else {
+			fmt.Printf("  External domains:  none\n")
+		}
+	}
+
+	fmt.Println("\nPolicy Changes:")
+	fmt.Println(strings.Repeat("-", 80))
+
+	changes := DiffPolicies(ParsePolicy(before), ParsePolicy(after))
+	changed := 0
+	for _, change := range changes {
+		switch change.Status {
+		case ChangeAdded:
+			fmt.Printf("+ %s\n", strings.TrimSpace(change.Name+" "+strings.Join(change.After, " ")))
+		case ChangeRemoved:
+			fmt.Printf("- %s\n", strings.TrimSpace(change.Name+" "+strings.Join(change.Before, " ")))
+		case ChangeModified:
+			fmt.Printf("~ %s\n", change.Name)
+			for _, src := range change.Added {
+				fmt.Printf("    + %s\n", src)
+			}
+			for _, src := range change.Removed {
+				fmt.Printf("    - %s\n", src)
+			}
+		default:
+			fmt.Printf("  %s\n", strings.TrimSpace(change.Name+" "+strings.Join(change.After, " ")))
+			continue
+		}
+		changed++
+	}
+
+	fmt.Println(strings.Repeat("-", 80))
+	if changed == 0 {
+		fmt.Println("No changes to the policy")
+	} else {
+		fmt.Printf("%d directive(s) changed\n", changed)
+	}
+}
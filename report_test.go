@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	before := ParsePolicy("default-src 'self'; script-src 'self' 'unsafe-inline'; frame-src https://a.example.com")
+	after := ParsePolicy("default-src 'self'; script-src 'self' 'sha256-abc='; style-src 'sha256-def='")
+
+	expected := []DirectiveChange{
+		{Name: "default-src", Status: ChangeUnchanged, Before: []string{"'self'"}, After: []string{"'self'"}},
+		{Name: "script-src", Status: ChangeModified,
+			Before:  []string{"'self'", "'unsafe-inline'"},
+			After:   []string{"'self'", "'sha256-abc='"},
+			Added:   []string{"'sha256-abc='"},
+			Removed: []string{"'unsafe-inline'"}},
+		{Name: "style-src", Status: ChangeAdded, After: []string{"'sha256-def='"}, Added: []string{"'sha256-def='"}},
+		{Name: "frame-src", Status: ChangeRemoved, Before: []string{"https://a.example.com"}, Removed: []string{"https://a.example.com"}},
+	}
+
+	changes := DiffPolicies(before, after)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("DiffPolicies mismatch\nexpected: %+v\ngot:      %+v", expected, changes)
+	}
+}
+
+func TestDiffPoliciesDuplicatesAndValueless(t *testing.T) {
+	before := ParsePolicy("img-src 'self'; img-src https:")
+	after := ParsePolicy("img-src 'self'; upgrade-insecure-requests")
+
+	changes := DiffPolicies(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d: %+v", len(changes), changes)
+	}
+	if changes[0].Status != ChangeUnchanged {
+		t.Errorf("Expected duplicate img-src to compare against the first occurrence, got %s", changes[0].Status)
+	}
+	if changes[1].Name != "upgrade-insecure-requests" || changes[1].Status != ChangeAdded {
+		t.Errorf("Expected upgrade-insecure-requests to be added, got %+v", changes[1])
+	}
+}
+
+func TestFileReportCount(t *testing.T) {
+	fr := FileReport{File: "index.html"}
+	for _, contentType := range []string{ContentTypeScript, ContentTypeScript, ContentTypeStyleTag, ContentTypeStyleAttr, ContentTypeEventHandler} {
+		fr.Count(InlineContent{Type: contentType})
+	}
+
+	if fr.Scripts != 2 || fr.StyleTags != 1 || fr.StyleAttributes != 1 || fr.EventHandlers != 1 {
+		t.Errorf("Unexpected counts: %+v", fr)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// reportToMaxAge is the lifetime in seconds of the endpoint groups of a Report-To header
+const reportToMaxAge = 10886400
+
+// endpointNamePattern matches a Reporting-Endpoints key, which is a structured field token
+var endpointNamePattern = regexp.MustCompile(`^[a-z*][a-z0-9_.*-]*$`)
+
+// HeaderField is a response header sent with a policy
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ReportEndpoint is a named URL that browsers send reports to
+type ReportEndpoint struct {
+	Name string
+	URL  string
+}
+
+// ParseReportEndpoint parses a "name=URL" endpoint. Browsers only send reports to
+// absolute https URLs, or http ones on localhost.
+func ParseReportEndpoint(value string) (ReportEndpoint, error) {
+	name, rawURL, ok := strings.Cut(value, "=")
+	if !ok {
+		return ReportEndpoint{}, fmt.Errorf("invalid endpoint %q, expected name=URL", value)
+	}
+	endpoint := ReportEndpoint{Name: strings.TrimSpace(name), URL: strings.TrimSpace(rawURL)}
+	if !endpointNamePattern.MatchString(endpoint.Name) {
+		return ReportEndpoint{}, fmt.Errorf("invalid endpoint name %q, must start with a lowercase letter and contain only a-z, 0-9, _, -, . and *", endpoint.Name)
+	}
+
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return ReportEndpoint{}, fmt.Errorf("invalid endpoint URL %q, must be an absolute URL", endpoint.URL)
+	}
+	switch host := u.Hostname(); {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1"):
+	default:
+		return ReportEndpoint{}, fmt.Errorf("invalid endpoint URL %q, browsers only send reports to https URLs", endpoint.URL)
+	}
+	return endpoint, nil
+}
+
+// AddReportEndpoint makes a policy report to an endpoint: report-to names its group,
+// replacing any other group since report-to takes a single one, and report-uri adds its
+// URL for browsers without the Reporting API
+func AddReportEndpoint(cspHeader string, endpoint ReportEndpoint) string {
+	policy := ParsePolicy(cspHeader)
+	policy.Ensure("report-to").Sources = []SourceExpression{ParseSourceExpression(endpoint.Name)}
+	policy.Ensure("report-uri").Add(endpoint.URL)
+	return policy.String()
+}
+
+// ReportingEndpointsHeader returns the value of the Reporting-Endpoints header declaring
+// the endpoints
+func ReportingEndpointsHeader(endpoints []ReportEndpoint) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	entries := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		entries = append(entries, endpoint.Name+`="`+escaper.Replace(endpoint.URL)+`"`)
+	}
+	return strings.Join(entries, ", ")
+}
+
+// reportToGroup is an endpoint group of the Report-To header
+type reportToGroup struct {
+	Group     string           `json:"group"`
+	MaxAge    int              `json:"max_age"`
+	Endpoints []reportToTarget `json:"endpoints"`
+}
+
+// reportToTarget is an endpoint of a Report-To group
+type reportToTarget struct {
+	URL string `json:"url"`
+}
+
+// ReportToHeader returns the value of the legacy Report-To header, which browsers that
+// predate Reporting-Endpoints use to declare the endpoint groups
+func ReportToHeader(endpoints []ReportEndpoint) string {
+	groups := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		group, _ := json.Marshal(reportToGroup{Group: endpoint.Name, MaxAge: reportToMaxAge, Endpoints: []reportToTarget{{URL: endpoint.URL}}})
+		groups = append(groups, string(group))
+	}
+	return strings.Join(groups, ", ")
+}
+
+// ReportingOptions selects the headers delivering a policy, for rolling it out in
+// report-only mode before enforcing it
+type ReportingOptions struct {
+	ReportOnly     bool             // send the policy in Content-Security-Policy-Report-Only
+	Enforced       string           // with ReportOnly, the current policy to keep enforcing
+	Endpoints      []ReportEndpoint // declared in Reporting-Endpoints; the policy reports to the first
+	LegacyReportTo bool             // also declare the endpoints in the Report-To header
+}
+
+// Enabled reports whether the policy needs other headers than Content-Security-Policy
+func (o ReportingOptions) Enabled() bool {
+	return o.ReportOnly || len(o.Endpoints) > 0
+}
+
+// PolicyHeader returns the name of the header sending the policy
+func (o ReportingOptions) PolicyHeader() string {
+	if o.ReportOnly {
+		return cspReportOnlyHeaderName
+	}
+	return cspHeaderName
+}
+
+// FixedHeaders returns the headers sent with the policy that are the same on every page:
+// the enforced policy, then the endpoints
+func (o ReportingOptions) FixedHeaders() []HeaderField {
+	var fields []HeaderField
+	if o.ReportOnly && o.Enforced != "" {
+		fields = append(fields, HeaderField{Name: cspHeaderName, Value: o.Enforced})
+	}
+	if len(o.Endpoints) > 0 {
+		fields = append(fields, HeaderField{Name: "Reporting-Endpoints", Value: ReportingEndpointsHeader(o.Endpoints)})
+		if o.LegacyReportTo {
+			fields = append(fields, HeaderField{Name: "Report-To", Value: ReportToHeader(o.Endpoints)})
+		}
+	}
+	return fields
+}
+
+// Headers returns the policy header followed by the fixed headers
+func (o ReportingOptions) Headers(policy string) []HeaderField {
+	return append([]HeaderField{{Name: o.PolicyHeader(), Value: policy}}, o.FixedHeaders()...)
+}
+
+// PrintHeaders prints header fields as "Name: value" lines. A value spanning several
+// lines, such as a pretty-printed policy, starts on the next line and is indented.
+func PrintHeaders(w io.Writer, fields []HeaderField) {
+	for _, field := range fields {
+		if strings.Contains(field.Value, "\n") {
+			fmt.Fprintf(w, "%s:\n  %s\n", field.Name, strings.ReplaceAll(field.Value, "\n", "\n  "))
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", field.Name, field.Value)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReportEndpoint(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected ReportEndpoint
+		err      string
+	}{
+		{value: "csp=https://csp.example.com/r?site=1", expected: ReportEndpoint{Name: "csp", URL: "https://csp.example.com/r?site=1"}},
+		{value: " csp-endpoint = https://csp.example.com/ ", expected: ReportEndpoint{Name: "csp-endpoint", URL: "https://csp.example.com/"}},
+		{value: "local=http://localhost:8081/", expected: ReportEndpoint{Name: "local", URL: "http://localhost:8081/"}},
+		{value: "https://csp.example.com/", err: "expected name=URL"},
+		{value: "csp", err: `invalid endpoint "csp", expected name=URL`},
+		{value: "CSP=https://csp.example.com/", err: `invalid endpoint name "CSP"`},
+		{value: "csp=/csp-reports", err: `invalid endpoint URL "/csp-reports", must be an absolute URL`},
+		{value: "csp=http://csp.example.com/", err: "browsers only send reports to https URLs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			endpoint, err := ParseReportEndpoint(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if endpoint != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, endpoint)
+			}
+		})
+	}
+}
+
+func TestAddReportEndpoint(t *testing.T) {
+	endpoint := ReportEndpoint{Name: "csp", URL: "https://csp.example.com/r"}
+
+	tests := []struct {
+		csp      string
+		expected string
+	}{
+		{"default-src 'self'", "default-src 'self'; report-to csp; report-uri https://csp.example.com/r"},
+		{"default-src 'self'; report-uri https://old.example.com/; report-to old", "default-src 'self'; report-uri https://old.example.com/ https://csp.example.com/r; report-to csp"},
+		{"default-src 'self'; report-to csp; report-uri https://csp.example.com/r", "default-src 'self'; report-to csp; report-uri https://csp.example.com/r"},
+	}
+
+	for _, tt := range tests {
+		if result := AddReportEndpoint(tt.csp, endpoint); result != tt.expected {
+			t.Errorf("AddReportEndpoint(%q) = %q, expected %q", tt.csp, result, tt.expected)
+		}
+	}
+}
+
+func TestReportingHeaders(t *testing.T) {
+	endpoints := []ReportEndpoint{
+		{Name: "csp", URL: "https://csp.example.com/r"},
+		{Name: "default", URL: `https://csp.example.com/d?q="x"`},
+	}
+
+	if got := ReportingEndpointsHeader(endpoints); got != `csp="https://csp.example.com/r", default="https://csp.example.com/d?q=\"x\""` {
+		t.Errorf("Unexpected Reporting-Endpoints value: %s", got)
+	}
+	expected := `{"group":"csp","max_age":10886400,"endpoints":[{"url":"https://csp.example.com/r"}]}, ` +
+		`{"group":"default","max_age":10886400,"endpoints":[{"url":"https://csp.example.com/d?q=\"x\""}]}`
+	if got := ReportToHeader(endpoints); got != expected {
+		t.Errorf("Unexpected Report-To value:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestReportingOptionsHeaders(t *testing.T) {
+	endpoints := []ReportEndpoint{{Name: "csp", URL: "https://csp.example.com/r"}}
+
+	tests := []struct {
+		name     string
+		opts     ReportingOptions
+		expected []string
+	}{
+		{"enforced", ReportingOptions{}, []string{"Content-Security-Policy"}},
+		{"report-only", ReportingOptions{ReportOnly: true}, []string{"Content-Security-Policy-Report-Only"}},
+		{"endpoints", ReportingOptions{Endpoints: endpoints, LegacyReportTo: true}, []string{"Content-Security-Policy", "Reporting-Endpoints", "Report-To"}},
+		{"dual", ReportingOptions{ReportOnly: true, Enforced: "default-src 'self'", Endpoints: endpoints},
+			[]string{"Content-Security-Policy-Report-Only", "Content-Security-Policy", "Reporting-Endpoints"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := tt.opts.Headers("default-src 'none'")
+			var names []string
+			for _, field := range headers {
+				names = append(names, field.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected headers %v, got %v", tt.expected, names)
+			}
+			if headers[0].Value != "default-src 'none'" {
+				t.Errorf("Expected the policy first, got %+v", headers[0])
+			}
+			if tt.opts.Enabled() != (len(tt.expected) > 1 || tt.opts.ReportOnly) {
+				t.Errorf("Unexpected Enabled() = %v", tt.opts.Enabled())
+			}
+		})
+	}
+}
+
+func TestPrintHeaders(t *testing.T) {
+	var out strings.Builder
+	PrintHeaders(&out, []HeaderField{
+		{Name: "Content-Security-Policy-Report-Only", Value: "default-src 'none';\nimg-src 'self';"},
+		{Name: "Reporting-Endpoints", Value: `csp="https://csp.example.com/r"`},
+	})
+	expected := "Content-Security-Policy-Report-Only:\n  default-src 'none';\n  img-src 'self';\n" +
+		"Reporting-Endpoints: csp=\"https://csp.example.com/r\"\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
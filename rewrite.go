@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlEdit replaces Start:End of an HTML source with Text
+type htmlEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// applyEdits applies non-overlapping edits to an HTML source. Everything outside the
+// edited ranges is preserved byte for byte, so template syntax and formatting survive.
+func applyEdits(source []byte, edits []htmlEdit) []byte {
+	sorted := append([]htmlEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End < sorted[j].End // insertions before a replacement at the same offset
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	for _, edit := range sorted {
+		if edit.Start < last {
+			continue
+		}
+		buf.Write(source[last:edit.Start])
+		buf.WriteString(edit.Text)
+		last = edit.End
+	}
+	buf.Write(source[last:])
+	return buf.Bytes()
+}
+
+// setAttr sets an attribute of a start tag. The change is written by edit, so several
+// rewrites of the same element combine into a single edit.
+func (t *sourceTag) setAttr(key, val string) {
+	t.markChanged()
+	for i := range t.Attrs {
+		if t.Attrs[i].Key == key {
+			t.Attrs[i].Val = val
+			return
+		}
+	}
+	t.Attrs = append(t.Attrs, html.Attribute{Key: key, Val: val})
+}
+
+// removeAttr removes an attribute from a start tag
+func (t *sourceTag) removeAttr(key string) {
+	t.markChanged()
+	kept := t.Attrs[:0]
+	for _, attr := range t.Attrs {
+		if attr.Key != key {
+			kept = append(kept, attr)
+		}
+	}
+	t.Attrs = kept
+}
+
+// markChanged records the original attributes before the first change
+func (t *sourceTag) markChanged() {
+	if !t.changed {
+		t.changed = true
+		t.origAttrs = append([]html.Attribute(nil), t.Attrs...)
+		t.Attrs = append([]html.Attribute(nil), t.Attrs...)
+	}
+}
+
+// edit returns the edit that writes the tag's changed attributes. When attributes were
+// only added, they are inserted after the tag name and the rest of the tag is kept as is.
+func (t *sourceTag) edit() htmlEdit {
+	added := len(t.Attrs) - len(t.origAttrs)
+	if added >= 0 && reflect.DeepEqual(t.Attrs[:len(t.origAttrs)], t.origAttrs) {
+		pos := t.Start + 1 + len(t.Name)
+		var buf strings.Builder
+		writeAttrs(&buf, t.Attrs[len(t.origAttrs):])
+		return htmlEdit{Start: pos, End: pos, Text: buf.String()}
+	}
+	return rebuildTag(t, t.Attrs)
+}
+
+// rebuildTag returns the edit that rewrites a start tag with a new attribute list
+func rebuildTag(tag *sourceTag, attrs []html.Attribute) htmlEdit {
+	var buf strings.Builder
+	buf.WriteString("<" + tag.Name)
+	writeAttrs(&buf, attrs)
+	if tag.SelfClosing {
+		buf.WriteString("/")
+	}
+	buf.WriteString(">")
+	return htmlEdit{Start: tag.Start, End: tag.End, Text: buf.String()}
+}
+
+// writeAttrs writes attributes as ` key="value"`, and boolean attributes as ` key`
+func writeAttrs(buf *strings.Builder, attrs []html.Attribute) {
+	for _, attr := range attrs {
+		if attr.Val == "" {
+			buf.WriteString(" " + attr.Key)
+			continue
+		}
+		fmt.Fprintf(buf, ` %s="%s"`, attr.Key, escapeAttrValue(attr.Val))
+	}
+}
+
+// escapeAttrValue escapes a double-quoted attribute value. Single quotes are kept as is
+// so that CSP keywords such as 'self' stay readable in meta tags.
+func escapeAttrValue(val string) string {
+	return attrValueEscaper.Replace(val)
+}
+
+var attrValueEscaper = strings.NewReplacer("&", "&amp;", `"`, "&#34;")
+
+// Page is an HTML file being rewritten. Rewrites change the attributes of its start tags
+// or replace byte ranges of its source; Bytes combines them into the new source.
+type Page struct {
+	Path   string
+	Source []byte
+	Tags   []*sourceTag
+	edits  []htmlEdit
+}
+
+// LoadPage reads an HTML file for rewriting
+func LoadPage(filePath string) (*Page, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return NewPage(filePath, source), nil
+}
+
+// NewPage prepares an HTML source for rewriting
+func NewPage(filePath string, source []byte) *Page {
+	return &Page{Path: filePath, Source: source, Tags: scanSourceTags(source)}
+}
+
+// Replace replaces a byte range of the source, or inserts text when edit.Start == edit.End.
+// Replacements take precedence over attribute changes of the tags they cover.
+func (p *Page) Replace(edit htmlEdit) {
+	p.edits = append(p.edits, edit)
+}
+
+// InsertFirst inserts text at pos, before anything else inserted there
+func (p *Page) InsertFirst(pos int, text string) {
+	p.edits = append([]htmlEdit{{Start: pos, End: pos, Text: text}}, p.edits...)
+}
+
+// Replaced reports whether a tag is covered by a replacement
+func (p *Page) Replaced(tag *sourceTag) bool {
+	return overlapsEdits(htmlEdit{Start: tag.Start, End: tag.End}, p.edits)
+}
+
+// Bytes returns the rewritten source
+func (p *Page) Bytes() []byte {
+	edits := append([]htmlEdit(nil), p.edits...)
+	for _, tag := range p.Tags {
+		if tag.changed && !p.Replaced(tag) {
+			edits = append(edits, tag.edit())
+		}
+	}
+	return applyEdits(p.Source, edits)
+}
+
+// Save writes the rewritten page to outPath, creating parent directories as needed
+func (p *Page) Save(outPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(outPath, p.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPath, err)
+	}
+	return nil
+}
+
+// headStart returns the offset at the top of <head>, or before the first element when
+// the head is implied: everything before <body> belongs to the head
+func headStart(tags []*sourceTag) int {
+	for _, tag := range tags {
+		if tag.Name == "head" {
+			return tag.End
+		}
+	}
+	for _, tag := range tags {
+		if tag.Name != "html" {
+			return tag.Start
+		}
+	}
+	return 0
+}
+
+// headEnd returns the offset of </head>, or of <body> when the end tag is omitted
+func headEnd(source []byte, tags []*sourceTag) int {
+	end := len(source)
+	for _, tag := range tags {
+		if tag.Name == "body" || tag.Name == "frameset" {
+			end = tag.Start
+			break
+		}
+	}
+	if i := bytes.LastIndex(bytes.ToLower(source[:end]), []byte("</head")); i >= 0 {
+		return i
+	}
+	if end < len(source) {
+		return end
+	}
+	return headStart(tags)
+}
+
+// overlapsEdits reports whether the range of an edit intersects any of the other edits.
+// An insertion at the start of a range does not overlap it.
+func overlapsEdits(edit htmlEdit, others []htmlEdit) bool {
+	for _, other := range others {
+		if other.Start < edit.End && edit.Start < other.End {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputPath returns where the rewritten copy of filePath is written inside outDir.
+// Relative paths keep their directory structure; absolute paths and paths outside the
+// working directory are flattened to their base name.
+func OutputPath(outDir, filePath string) (string, error) {
+	clean := filepath.Clean(filePath)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		clean = filepath.Base(clean)
+	}
+	outPath := filepath.Join(outDir, clean)
+
+	inAbs, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	outAbs, err := filepath.Abs(outPath)
+	if err != nil {
+		return "", err
+	}
+	if inAbs == outAbs {
+		return "", fmt.Errorf("output path %s would overwrite the input file", outPath)
+	}
+	return outPath, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	source := []byte("0123456789")
+	edits := []htmlEdit{
+		{Start: 8, End: 10, Text: "X"},
+		{Start: 2, End: 2, Text: "ins"},
+		{Start: 4, End: 6, Text: ""},
+		{Start: 5, End: 7, Text: "overlap"}, // overlaps the previous edit and is skipped
+	}
+
+	if got := string(applyEdits(source, edits)); got != "01ins2367X" {
+		t.Errorf("Expected 01ins2367X, got %s", got)
+	}
+}
+
+func TestSourceTagSetAttr(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		key      string
+		val      string
+		expected string
+	}{
+		{"insert", `<div  class="a">x</div>`, "id", "main", `<div id="main"  class="a">x</div>`},
+		{"escape", `<p>`, "title", `a"b`, `<p title="a&#34;b">`},
+		{"replace", `<script nonce='old' async>`, "nonce", "new", `<script nonce="new" async>`},
+		{"self-closing", `<img src=a.png nonce=x />`, "nonce", "y", `<img src="a.png" nonce="y"/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage("", []byte(tt.source))
+			page.Tags[0].setAttr(tt.key, tt.val)
+			got := string(page.Bytes())
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanSourceTagsContent(t *testing.T) {
+	source := "<script>run()</script><style></style><p>text</p>"
+	tags := scanSourceTags([]byte(source))
+
+	if len(tags) != 3 {
+		t.Fatalf("Expected 3 tags, got %d", len(tags))
+	}
+	if got := source[tags[0].ContentStart:tags[0].ContentEnd]; got != "run()" {
+		t.Errorf("Expected script content run(), got %q", got)
+	}
+	if tags[1].ContentStart != tags[1].ContentEnd {
+		t.Errorf("Expected empty style content, got %q", source[tags[1].ContentStart:tags[1].ContentEnd])
+	}
+	if tags[2].ContentStart != tags[2].ContentEnd {
+		t.Error("Expected no raw text content for a <p> element")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	tests := []struct {
+		filePath string
+		expected string
+	}{
+		{"index.html", filepath.Join("dist", "index.html")},
+		{"site/blog/post.html", filepath.Join("dist", "site", "blog", "post.html")},
+		{"../other/page.html", filepath.Join("dist", "page.html")},
+		{"/var/www/page.html", filepath.Join("dist", "page.html")},
+	}
+	for _, tt := range tests {
+		got, err := OutputPath("dist", tt.filePath)
+		if err != nil {
+			t.Fatalf("OutputPath(%q): %v", tt.filePath, err)
+		}
+		if got != tt.expected {
+			t.Errorf("OutputPath(%q) = %q, expected %q", tt.filePath, got, tt.expected)
+		}
+	}
+
+	if _, err := OutputPath(".", "index.html"); err == nil {
+		t.Error("Expected an error when the output would overwrite the input")
+	}
+}
+
+func TestSourceTagRemoveAttr(t *testing.T) {
+	page := NewPage("", []byte(`<button  onclick='go()' class=b>x</button><p>`))
+	page.Tags[0].removeAttr("onclick")
+	page.Tags[0].setAttr("data-id", "1")
+
+	expected := `<button class="b" data-id="1">x</button><p>`
+	if got := string(page.Bytes()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestPageSave(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.html")
+	output := filepath.Join(dir, "nested", "out.html")
+	os.WriteFile(input, []byte("<p class=a>hello</p>"), 0o644)
+
+	page, err := LoadPage(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Tags[0].setAttr("class", "b")
+	if err := page.Save(output); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `<p class="b">hello</p>` {
+		t.Errorf("Unexpected output: %s", got)
+	}
+}
+
+func TestPageReplaceTakesPrecedence(t *testing.T) {
+	source := `<script nonce="old">a()</script><style>p{}</style>`
+	page := NewPage("", []byte(source))
+	page.Replace(htmlEdit{Start: page.Tags[0].Start, End: page.Tags[0].ContentEnd, Text: `<script src="a.js">`})
+	page.InsertFirst(0, "<meta>")
+
+	count := AddNonces(page, "abc", NonceOptions{Scripts: true, Styles: true})
+
+	expected := `<meta><script src="a.js"></script><style nonce="abc">p{}</style>`
+	if got := string(page.Bytes()); got != expected || count != 1 {
+		t.Errorf("Expected %s with 1 nonce, got %s with %d", expected, got, count)
+	}
+}
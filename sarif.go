@@ -0,0 +1,261 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SARIF 2.1.0 schema and tool information
+const (
+	sarifSchema     = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion    = "2.1.0"
+	sarifToolName   = "csp"
+	sarifToolURI    = "https://github.com/DavBfr/csp"
+	sarifPolicyKind = "policy"
+)
+
+// sarifRuleInfo describes a rule reported in SARIF output
+type sarifRuleInfo struct {
+	ID          string
+	Description string
+	Help        string
+}
+
+// sarifRules lists every rule the tool can report, in a stable order
+var sarifRules = []sarifRuleInfo{
+	{RuleEmptyPolicy, "The CSP header is empty", "Provide a valid CSP header string."},
+	{RuleCommaSplitsPolicy, "A comma splits the CSP into separate policies", "Separate sources with spaces and directives with ';' - a comma starts a new policy."},
+	{RuleInvalidSource, "A source expression does not match the CSP3 grammar", "Use a keyword ('self'), a scheme (https:), a host ([scheme://]host[:port][/path]), a nonce or a hash."},
+	{RuleNoneWithOtherSources, "'none' is combined with other sources and ignored", "Remove 'none', or remove all other sources to block everything."},
+	{RuleDuplicateDirective, "A directive is defined more than once", "Merge all source lists of the directive into a single directive; browsers only enforce the first."},
+	{RuleUnsafeInlineWithHashes, "'unsafe-inline' is combined with hashes", "Remove 'unsafe-inline' - it is ignored when hashes are present."},
+	{RuleUnsafeEval, "script-src allows 'unsafe-eval'", "Remove 'unsafe-eval' and refactor code to avoid eval(), Function() and setTimeout(string)."},
+	{RuleMissingDefaultSrc, "The policy has no default-src", "Add default-src as a fallback for other fetch directives, e.g. default-src 'self'."},
+	{RuleWildcardSource, "A directive allows resources from any origin", "Restrict the directive to specific hosts or use 'self'."},
+	{RuleDataURIScripts, "script-src allows data: URIs", "Remove data: from script-src."},
+	{RuleDeprecatedDirective, "The directive is deprecated", "Remove the directive or use its replacement."},
+	{RuleMisspeltDirective, "Unknown directive that looks like a misspelt known directive", "Rename the directive to the suggested name; browsers ignore unknown directives."},
+	{RuleUnknownDirective, "Unknown directive ignored by browsers", "Remove the directive or check the spelling against the CSP specification."},
+	{RuleMissingFallback, "An -attr directive is defined without its fallback directive", "Add the fallback directive (script-src or style-src)."},
+	{RuleRelativeReportURI, "report-uri is not an absolute URL", "Use an absolute URL, so that reports reach the collector wherever the policy is sent from."},
+	{RuleUndeclaredReportGroup, "A report-to group has no endpoint", "Declare the group in the Reporting-Endpoints header, e.g. with --report-endpoint name=URL."},
+	{RuleBlockedInlineScript, "Inline script would be blocked by the policy", "Add the script's hash to script-src, give the element a nonce, or move the script to an external file."},
+	{RuleBlockedEventHandler, "Inline event handler would be blocked by the policy", "Add the handler's hash together with 'unsafe-hashes' to script-src, or replace it with addEventListener()."},
+	{RuleBlockedStyleTag, "Style tag would be blocked by the policy", "Add the style's hash to style-src, give the element a nonce, or move the CSS to an external stylesheet."},
+	{RuleBlockedStyleAttribute, "Style attribute would be blocked by the policy", "Add the attribute's hash together with 'unsafe-hashes' to style-src, or replace it with a CSS class."},
+	{RuleBlockedResource, "External resource would be blocked by the policy", "Add the resource's host to the directive, or serve the resource from an allowed origin."},
+}
+
+// SARIFLog is the root of a SARIF 2.1.0 document
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is a single analysis run
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the analysis tool
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver describes the tool and the rules it reports
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule is a reporting descriptor for one rule
+type SARIFRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     SARIFMessage       `json:"shortDescription"`
+	Help                 SARIFMessage       `json:"help"`
+	DefaultConfiguration SARIFConfiguration `json:"defaultConfiguration"`
+}
+
+// SARIFConfiguration holds the default level of a rule
+type SARIFConfiguration struct {
+	Level string `json:"level"`
+}
+
+// SARIFMessage is a plain text message
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is a single finding
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations,omitempty"`
+}
+
+// SARIFLocation points at a file region and/or a logical location such as a directive
+type SARIFLocation struct {
+	PhysicalLocation *SARIFPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []SARIFLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+// SARIFPhysicalLocation is a file and an optional region
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+// SARIFArtifactLocation is the URI of a file
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIFRegion is a start position in a file
+type SARIFRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIFLogicalLocation names a location that is not a file, such as a CSP directive
+type SARIFLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// PolicySource is the file a policy was read from, such as a --csp-file or a config file
+type PolicySource struct {
+	Path    string // "" when the policy was given on the command line
+	Content string
+}
+
+// location returns the physical location of a directive of the policy: the line and column
+// of its first occurrence in the file, or the start of the file
+func (ps PolicySource) location(directive string) *SARIFPhysicalLocation {
+	region := &SARIFRegion{StartLine: 1, StartColumn: 1}
+	lower := strings.ToLower(ps.Content)
+	name := strings.ToLower(directive)
+	for offset := 0; name != "" && offset < len(lower); {
+		i := strings.Index(lower[offset:], name)
+		if i < 0 {
+			break
+		}
+		start, end := offset+i, offset+i+len(name)
+		if (start == 0 || !isDirectiveNameByte(lower[start-1])) && (end == len(lower) || !isDirectiveNameByte(lower[end])) {
+			region.StartLine, region.StartColumn = lineAndColumn([]byte(ps.Content), start)
+			break
+		}
+		offset = end
+	}
+	return &SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: sarifURI(ps.Path)}, Region: region}
+}
+
+// isDirectiveNameByte reports whether a byte can be part of a directive name
+func isDirectiveNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-'
+}
+
+// NewSARIFLog builds a SARIF log from validator warnings and audit findings. Validator
+// warnings point at the file the policy was read from, when there is one.
+func NewSARIFLog(warnings []ValidationWarning, findings []AuditFinding, policy PolicySource) *SARIFLog {
+	run := SARIFRun{
+		Tool: SARIFTool{Driver: SARIFDriver{
+			Name:           sarifToolName,
+			InformationURI: sarifToolURI,
+			Rules:          []SARIFRule{},
+		}},
+		Results: []SARIFResult{},
+	}
+
+	for _, info := range sarifRules {
+		level := "warning"
+		if strings.HasPrefix(info.ID, "blocked-") {
+			level = "error"
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SARIFRule{
+			ID:                   info.ID,
+			ShortDescription:     SARIFMessage{Text: info.Description},
+			Help:                 SARIFMessage{Text: info.Help},
+			DefaultConfiguration: SARIFConfiguration{Level: level},
+		})
+	}
+
+	for _, warning := range warnings {
+		// The fix is specific to the finding, so it is part of the message
+		message := warning.Message
+		if warning.Fix != "" {
+			message += ". " + warning.Fix
+		}
+		result := SARIFResult{
+			RuleID:    warning.Rule,
+			RuleIndex: sarifRuleIndex(warning.Rule),
+			Level:     sarifLevel(warning.Severity),
+			Message:   SARIFMessage{Text: message},
+		}
+		var location SARIFLocation
+		if policy.Path != "" {
+			location.PhysicalLocation = policy.location(warning.Directive)
+		}
+		if warning.Directive != "" {
+			location.LogicalLocations = []SARIFLogicalLocation{{Name: warning.Directive, Kind: sarifPolicyKind}}
+		}
+		if location.PhysicalLocation != nil || location.LogicalLocations != nil {
+			result.Locations = []SARIFLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	for _, finding := range findings {
+		location := SARIFLocation{
+			PhysicalLocation: &SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: sarifURI(finding.File)}},
+			LogicalLocations: []SARIFLogicalLocation{{Name: finding.Directive, Kind: sarifPolicyKind}},
+		}
+		if finding.Line > 0 {
+			location.PhysicalLocation.Region = &SARIFRegion{StartLine: finding.Line, StartColumn: finding.Column}
+		}
+		result := SARIFResult{
+			RuleID:    finding.Rule,
+			RuleIndex: sarifRuleIndex(finding.Rule),
+			Level:     "error",
+			Message:   SARIFMessage{Text: finding.Type + " " + createSnippet(finding.Content, 60) + " is blocked by " + finding.Directive + ": " + finding.Reason},
+			Locations: []SARIFLocation{location},
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return &SARIFLog{Schema: sarifSchema, Version: sarifVersion, Runs: []SARIFRun{run}}
+}
+
+// sarifRuleIndex returns the index of a rule in the driver's rule list
+func sarifRuleIndex(id string) int {
+	for i, info := range sarifRules {
+		if info.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sarifLevel maps a validation severity to a SARIF level
+func sarifLevel(severity string) string {
+	switch severity {
+	case "error":
+		return "error"
+	case "warning":
+		return "warning"
+	}
+	return "note"
+}
+
+// sarifURI converts a file path to a SARIF artifact URI; relative paths stay relative
+// to the directory the tool was run from
+func sarifURI(path string) string {
+	if filepath.IsAbs(path) {
+		return "file://" + filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSARIFRulesRegistered(t *testing.T) {
+	rules := []string{
+		RuleEmptyPolicy, RuleCommaSplitsPolicy, RuleInvalidSource, RuleNoneWithOtherSources,
+		RuleDuplicateDirective, RuleUnsafeInlineWithHashes, RuleUnsafeEval, RuleMissingDefaultSrc,
+		RuleWildcardSource, RuleDataURIScripts, RuleDeprecatedDirective, RuleMisspeltDirective,
+		RuleUnknownDirective, RuleMissingFallback, RuleRelativeReportURI, RuleUndeclaredReportGroup,
+		RuleBlockedInlineScript, RuleBlockedEventHandler, RuleBlockedStyleTag, RuleBlockedStyleAttribute, RuleBlockedResource,
+	}
+
+	seen := make(map[string]bool)
+	for _, info := range sarifRules {
+		if seen[info.ID] {
+			t.Errorf("Rule %s is registered twice", info.ID)
+		}
+		seen[info.ID] = true
+		if info.Description == "" || info.Help == "" {
+			t.Errorf("Rule %s is missing its description or help text", info.ID)
+		}
+	}
+	for _, rule := range rules {
+		if !seen[rule] {
+			t.Errorf("Rule %s is not registered in sarifRules", rule)
+		}
+	}
+}
+
+func TestValidationWarningsHaveRules(t *testing.T) {
+	headers := []string{
+		"",
+		"img-src 'self', data:",
+		"default-src 'self' 'nonce-'; script-src 'unsafe-inline' 'sha256-n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=' 'unsafe-eval' data: *",
+		"script-scr 'self'; foo-bar x; img-src 'none' 'self'; img-src 'self'; style-src-attr 'none'; script-src-attr 'none'; plugin-types a",
+	}
+	for _, header := range headers {
+		for _, warning := range ValidateCSP(header).Warnings {
+			if sarifRuleIndex(warning.Rule) < 0 {
+				t.Errorf("Warning %q has unregistered rule %q", warning.Message, warning.Rule)
+			}
+		}
+	}
+}
+
+func TestNewSARIFLog(t *testing.T) {
+	warnings := []ValidationWarning{
+		{Rule: RuleUnsafeEval, Severity: "warning", Message: "script-src contains 'unsafe-eval'", Fix: "Remove it", Directive: "script-src"},
+		{Rule: RuleMissingDefaultSrc, Severity: "warning", Message: "Missing 'default-src' directive"},
+	}
+	findings := []AuditFinding{
+		{Rule: RuleBlockedEventHandler, File: "site/index.html", Line: 12, Column: 5, Type: ContentTypeEventHandler,
+			Content: "go()", Directive: "script-src-attr", Reason: "hash missing"},
+		{Rule: RuleBlockedResource, File: "site/index.html", Type: "image", Content: "data: URL", Directive: "img-src", Reason: "no source"},
+	}
+
+	log := NewSARIFLog(warnings, findings, PolicySource{})
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF header: %+v", log)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+
+	if results[0].RuleID != RuleUnsafeEval || results[0].Level != "warning" {
+		t.Errorf("Unexpected first result: %+v", results[0])
+	}
+	if results[0].Message.Text != "script-src contains 'unsafe-eval'. Remove it" {
+		t.Errorf("Expected the warning message with its fix, got %q", results[0].Message.Text)
+	}
+	if results[1].Message.Text != "Missing 'default-src' directive" {
+		t.Errorf("Expected the message of a warning without fix unchanged, got %q", results[1].Message.Text)
+	}
+	for i, info := range sarifRules {
+		if help := log.Runs[0].Tool.Driver.Rules[i].Help.Text; help != info.Help {
+			t.Errorf("Expected the static help for rule %s, got %q", info.ID, help)
+		}
+	}
+	if len(results[0].Locations) != 1 || results[0].Locations[0].LogicalLocations[0].Name != "script-src" {
+		t.Errorf("Expected directive logical location, got %+v", results[0].Locations)
+	}
+	if results[0].Locations[0].PhysicalLocation != nil {
+		t.Errorf("Expected no physical location for a policy from the command line, got %+v", results[0].Locations[0].PhysicalLocation)
+	}
+	if len(results[1].Locations) != 0 {
+		t.Errorf("Expected no location for a policy-wide warning, got %+v", results[1].Locations)
+	}
+
+	handler := results[2]
+	if handler.Level != "error" || handler.RuleID != RuleBlockedEventHandler {
+		t.Errorf("Unexpected handler result: %+v", handler)
+	}
+	physical := handler.Locations[0].PhysicalLocation
+	if physical.ArtifactLocation.URI != "site/index.html" || physical.Region == nil || physical.Region.StartLine != 12 || physical.Region.StartColumn != 5 {
+		t.Errorf("Unexpected handler location: %+v", physical)
+	}
+	if handler.Message.Text != "event-handler go() is blocked by script-src-attr: hash missing" {
+		t.Errorf("Unexpected handler message: %q", handler.Message.Text)
+	}
+	if results[3].Locations[0].PhysicalLocation.Region != nil {
+		t.Error("Expected no region when the line is unknown")
+	}
+
+	for _, result := range results {
+		rules := log.Runs[0].Tool.Driver.Rules
+		if result.RuleIndex < 0 || rules[result.RuleIndex].ID != result.RuleID {
+			t.Errorf("Result %s has wrong rule index %d", result.RuleID, result.RuleIndex)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, log); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["$schema"] != sarifSchema {
+		t.Errorf("Expected $schema %q, got %v", sarifSchema, decoded["$schema"])
+	}
+}
+
+func TestNewSARIFLogPolicySource(t *testing.T) {
+	warnings := []ValidationWarning{
+		{Rule: RuleUnsafeEval, Severity: "warning", Message: "script-src contains 'unsafe-eval'", Directive: "script-src"},
+		{Rule: RuleMissingDefaultSrc, Severity: "warning", Message: "Missing 'default-src' directive"},
+	}
+	source := PolicySource{Path: "csp-header.txt", Content: "script-src-elem 'self';\n  Script-Src 'self' 'unsafe-eval'"}
+
+	results := NewSARIFLog(warnings, nil, source).Runs[0].Results
+
+	expected := []SARIFRegion{{StartLine: 2, StartColumn: 3}, {StartLine: 1, StartColumn: 1}}
+	for i, result := range results {
+		if len(result.Locations) != 1 || result.Locations[0].PhysicalLocation == nil {
+			t.Fatalf("Expected a physical location for result %d, got %+v", i, result.Locations)
+		}
+		physical := result.Locations[0].PhysicalLocation
+		if physical.ArtifactLocation.URI != "csp-header.txt" || *physical.Region != expected[i] {
+			t.Errorf("Expected csp-header.txt at %+v for result %d, got %+v", expected[i], i, physical)
+		}
+	}
+	if len(results[0].Locations[0].LogicalLocations) != 1 {
+		t.Errorf("Expected the directive as logical location too, got %+v", results[0].Locations[0])
+	}
+}
+
+func TestSARIFURI(t *testing.T) {
+	tests := map[string]string{
+		"index.html":         "index.html",
+		"./site/../a.html":   "a.html",
+		"/srv/www/page.html": "file:///srv/www/page.html",
+	}
+	for input, expected := range tests {
+		if got := sarifURI(input); got != expected {
+			t.Errorf("sarifURI(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ignoreFileName is the file listing paths left out when a directory is scanned
+const ignoreFileName = ".cspignore"
+
+// DefaultIncludePatterns select the files scanned in directories when no include
+// patterns are given
+var DefaultIncludePatterns = []string{"**/*.html", "**/*.htm"}
+
+// ScanOptions selects the files found in directory arguments
+type ScanOptions struct {
+	Include []string // patterns of the files to process, DefaultIncludePatterns if empty
+	Exclude []string // patterns of the files and directories to leave out
+	OutDir  string   // directory that is never scanned, so that rewritten files are not read back
+}
+
+// pathPattern is a compiled pattern with .gitignore semantics: a pattern without a slash
+// matches a name at any depth, "**" matches any number of directories, a trailing slash
+// matches directories only and a leading "!" negates the pattern
+type pathPattern struct {
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	base    string // directory the pattern is relative to, "" for the scanned directory
+}
+
+// compilePathPattern compiles one pattern relative to base
+func compilePathPattern(pattern, base string) (*pathPattern, error) {
+	p := &pathPattern{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(pattern, "/") {
+		expr.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') {
+				switch {
+				case strings.HasPrefix(pattern[i:], "**/"):
+					expr.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				case i+2 == len(pattern):
+					expr.WriteString(".*")
+					i++
+					continue
+				}
+			}
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid character class")
+	}
+	p.regex = regex
+	return p, nil
+}
+
+// match reports whether a slash-separated path relative to the scanned directory matches
+func (p *pathPattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return p.regex.MatchString(rel)
+}
+
+// compilePathPatterns compiles patterns relative to the scanned directory
+func compilePathPatterns(patterns []string) ([]*pathPattern, error) {
+	var compiled []*pathPattern
+	for _, pattern := range patterns {
+		p, err := compilePathPattern(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// matchPathPatterns reports whether a path is selected by a list of patterns, where the
+// last matching pattern wins
+func matchPathPatterns(patterns []*pathPattern, rel string, isDir bool) bool {
+	matched := false
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
+
+// readIgnoreFile returns the patterns of the .cspignore file in dir, relative to base
+func readIgnoreFile(dir, base string) ([]*pathPattern, error) {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []*pathPattern
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := trimIgnoreLine(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := compilePathPattern(line, base)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filepath.Join(dir, ignoreFileName), lineNum, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// trimIgnoreLine removes trailing spaces that are not escaped with a backslash
+func trimIgnoreLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// CollectFiles expands the directory arguments into the files below them that match the
+// include patterns and are not excluded, and returns them with the file arguments, cleaned,
+// sorted and without duplicates, so that the result does not depend on how the files were
+// listed. Symbolic links are followed, but each directory is only scanned once.
+func CollectFiles(args []string, opts ScanOptions) ([]string, error) {
+	include := opts.Include
+	if len(include) == 0 {
+		include = DefaultIncludePatterns
+	}
+	includePatterns, err := compilePathPatterns(include)
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := compilePathPatterns(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := &dirScanner{include: includePatterns, exclude: excludePatterns, visited: map[string]bool{}, files: map[string]bool{}}
+	if opts.OutDir != "" {
+		if real, err := resolvePath(opts.OutDir); err == nil {
+			scanner.visited[real] = true
+		}
+	}
+
+	// Scan parents before their subdirectories, so that their ignore files apply
+	var dirs []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			dirs = append(dirs, filepath.Clean(arg))
+			continue
+		}
+		scanner.files[filepath.Clean(arg)] = true
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := scanner.walk(dir, "", nil); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]string, 0, len(scanner.files))
+	for file := range scanner.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// resolvePath returns the absolute path of a file with symbolic links resolved, so that
+// relative and absolute paths to the same directory compare equal
+func resolvePath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// dirScanner collects the files of the scanned directories
+type dirScanner struct {
+	include []*pathPattern
+	exclude []*pathPattern
+	visited map[string]bool // resolved paths of the scanned directories
+	files   map[string]bool
+}
+
+// walk adds the files of dir, whose path relative to the scanned directory is rel, and of
+// its subdirectories. ignored holds the patterns of the .cspignore files above dir.
+func (ds *dirScanner) walk(dir, rel string, ignored []*pathPattern) error {
+	real, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+	if ds.visited[real] {
+		return nil
+	}
+	ds.visited[real] = true
+
+	patterns, err := readIgnoreFile(dir, rel)
+	if err != nil {
+		return err
+	}
+	ignored = append(ignored[:len(ignored):len(ignored)], patterns...)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		filePath := filepath.Join(dir, entry.Name())
+		fileRel := path.Join(rel, entry.Name())
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				continue // dangling link
+			}
+			isDir = info.IsDir()
+		}
+
+		if matchPathPatterns(ignored, fileRel, isDir) || matchPathPatterns(ds.exclude, fileRel, isDir) {
+			continue
+		}
+		if isDir {
+			if err := ds.walk(filePath, fileRel, ignored); err != nil {
+				return err
+			}
+		} else if matchPathPatterns(ds.include, fileRel, false) {
+			ds.files[filePath] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.html", "index.html", false, true},
+		{"*.html", "docs/guide/index.html", false, true},
+		{"*.html", "index.htm", false, false},
+		{"**/*.html", "index.html", false, true},
+		{"**/*.html", "a/b/index.html", false, true},
+		{"docs/*.html", "docs/index.html", false, true},
+		{"docs/*.html", "docs/guide/index.html", false, false},
+		{"docs/*.html", "site/docs/index.html", false, false},
+		{"/index.html", "index.html", false, true},
+		{"/index.html", "docs/index.html", false, false},
+		{"docs/**/*.html", "docs/index.html", false, true},
+		{"docs/**/*.html", "docs/a/b/index.html", false, true},
+		{"drafts/**", "drafts/a/index.html", false, true},
+		{"drafts/**", "drafts", true, false},
+		{"drafts/", "drafts", true, true},
+		{"drafts/", "drafts", false, false},
+		{"page-?.html", "page-1.html", false, true},
+		{"page-?.html", "page-10.html", false, false},
+		{"page-[0-9].html", "page-5.html", false, true},
+		{"page-[!0-9].html", "page-5.html", false, false},
+		{`\#notes.html`, "#notes.html", false, true},
+		{"a*b.html", "a/b.html", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			p, err := compilePathPattern(tt.pattern, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchPathPatternsLastMatchWins(t *testing.T) {
+	patterns, err := compilePathPatterns([]string{"*.html", "!keep.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchPathPatterns(patterns, "drop.html", false) || matchPathPatterns(patterns, "a/keep.html", false) {
+		t.Error("Expected the negated pattern to re-include keep.html")
+	}
+}
+
+// writeTree creates files with the given contents below dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"index.html":               "",
+		"about.htm":                "",
+		"notes.txt":                "",
+		"docs/guide.html":          "",
+		"docs/draft-1.html":        "",
+		"docs/.cspignore":          "draft-*.html\n/internal/\n",
+		"docs/internal/x.html":     "",
+		"docs/api/internal/y.html": "",
+		"vendor/lib.html":          "",
+		"build/out.html":           "",
+		".cspignore":               "# generated\nbuild/\n*.bak.html\n!keep.bak.html\n",
+		"old.bak.html":             "",
+		"keep.bak.html":            "",
+	})
+	rel := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	files, err := CollectFiles([]string{dir}, ScanOptions{Exclude: []string{"vendor/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := rel("about.htm", "docs/api/internal/y.html", "docs/guide.html", "index.html", "keep.bak.html")
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	// Listing the files differently gives the same result
+	files, err = CollectFiles([]string{filepath.Join(dir, "index.html"), dir + "/docs/../", filepath.Join(dir, "docs")}, ScanOptions{Exclude: []string{"vendor/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	files, err = CollectFiles([]string{dir, filepath.Join(dir, "notes.txt")}, ScanOptions{Include: []string{"docs/*.html"}, OutDir: filepath.Join(dir, "docs", "api")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = rel("docs/guide.html", "notes.txt")
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected explicit files and the included ones, got %v", files)
+	}
+}
+
+func TestCollectFilesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"site/index.html": "", "shared/footer.html": ""})
+	links := map[string]string{
+		"site/loop":    "..",
+		"site/shared":  "../shared",
+		"site/missing": "nowhere",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	files, err := CollectFiles([]string{filepath.Join(dir, "site")}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "site", "index.html"), filepath.Join(dir, "site", "loop", "shared", "footer.html")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected each directory to be scanned once, got %v", files)
+	}
+}
+
+func TestCollectFilesRelativeRootAbsoluteOutDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"index.html": "", "dist/index.html": "", "dist/a.html": ""})
+	t.Chdir(dir)
+
+	files, err := CollectFiles([]string{"."}, ScanOptions{OutDir: filepath.Join(dir, "dist")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"index.html"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected the output directory to be skipped, got %v", files)
+	}
+}
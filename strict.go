@@ -1,226 +1,77 @@
 package main
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+
+	"csp/httpcsp"
 )
 
 // StrictCSPTemplate defines the structure of a strict CSP policy
-type StrictCSPTemplate struct {
-	DefaultSrc             []string
-	ScriptSrc              []string
-	StyleSrc               []string
-	ImgSrc                 []string
-	FontSrc                []string
-	ConnectSrc             []string
-	ManifestSrc            []string
-	WorkerSrc              []string
-	FrameSrc               []string
-	ObjectSrc              []string
-	MediaSrc               []string
-	ChildSrc               []string
-	ScriptSrcElem          []string
-	ScriptSrcAttr          []string
-	StyleSrcElem           []string
-	StyleSrcAttr           []string
-	Sandbox                []string
-	TrustedTypes           []string
-	ReportTo               []string
-	BaseURI                []string
-	FormAction             []string
-	FrameAncestors         []string
-	UpgradeInsecure        bool
-	RequireTrustedTypesFor bool
-}
+type StrictCSPTemplate = httpcsp.StrictCSPTemplate
 
 // GetDefaultStrictTemplate returns a recommended strict CSP template
 func GetDefaultStrictTemplate() StrictCSPTemplate {
-	return StrictCSPTemplate{
-		DefaultSrc:      []string{"'none'"},
-		ScriptSrc:       []string{"'self'"},
-		StyleSrc:        []string{"'self'"},
-		ImgSrc:          []string{"'self'"},
-		FontSrc:         []string{"'self'"},
-		ConnectSrc:      []string{"'self'"},
-		ManifestSrc:     []string{"'self'"},
-		WorkerSrc:       []string{"'self'"},
-		FrameSrc:        []string{"'none'"},
-		ObjectSrc:       []string{"'none'"},
-		MediaSrc:        []string{"'self'"},
-		BaseURI:         []string{"'self'"},
-		FormAction:      []string{"'self'"},
-		FrameAncestors:  []string{"'none'"},
-		UpgradeInsecure: true,
-	}
+	return httpcsp.GetDefaultStrictTemplate()
 }
 
 // GenerateStrictCSP generates a strict CSP from a template
 func GenerateStrictCSP(template StrictCSPTemplate) string {
-	var parts []string
-
-	// Order matters for readability
-	if len(template.DefaultSrc) > 0 {
-		parts = append(parts, "default-src "+strings.Join(template.DefaultSrc, " "))
-	}
-
-	if len(template.ScriptSrc) > 0 {
-		parts = append(parts, "script-src "+strings.Join(template.ScriptSrc, " "))
-	}
-
-	if len(template.StyleSrc) > 0 {
-		parts = append(parts, "style-src "+strings.Join(template.StyleSrc, " "))
-	}
-
-	if len(template.ImgSrc) > 0 {
-		parts = append(parts, "img-src "+strings.Join(template.ImgSrc, " "))
-	}
-
-	if len(template.FontSrc) > 0 {
-		parts = append(parts, "font-src "+strings.Join(template.FontSrc, " "))
-	}
-
-	if len(template.ConnectSrc) > 0 {
-		parts = append(parts, "connect-src "+strings.Join(template.ConnectSrc, " "))
-	}
-
-	if len(template.ManifestSrc) > 0 {
-		parts = append(parts, "manifest-src "+strings.Join(template.ManifestSrc, " "))
-	}
-
-	if len(template.WorkerSrc) > 0 {
-		parts = append(parts, "worker-src "+strings.Join(template.WorkerSrc, " "))
-	}
-
-	if len(template.FrameSrc) > 0 {
-		parts = append(parts, "frame-src "+strings.Join(template.FrameSrc, " "))
-	}
-
-	if len(template.ObjectSrc) > 0 {
-		parts = append(parts, "object-src "+strings.Join(template.ObjectSrc, " "))
-	}
-
-	if len(template.MediaSrc) > 0 {
-		parts = append(parts, "media-src "+strings.Join(template.MediaSrc, " "))
-	}
-
-	if len(template.ChildSrc) > 0 {
-		parts = append(parts, "child-src "+strings.Join(template.ChildSrc, " "))
-	}
-
-	if len(template.ScriptSrcElem) > 0 {
-		parts = append(parts, "script-src-elem "+strings.Join(template.ScriptSrcElem, " "))
-	}
-
-	if len(template.ScriptSrcAttr) > 0 {
-		parts = append(parts, "script-src-attr "+strings.Join(template.ScriptSrcAttr, " "))
-	}
-
-	if len(template.StyleSrcElem) > 0 {
-		parts = append(parts, "style-src-elem "+strings.Join(template.StyleSrcElem, " "))
-	}
-
-	if len(template.StyleSrcAttr) > 0 {
-		parts = append(parts, "style-src-attr "+strings.Join(template.StyleSrcAttr, " "))
-	}
-
-	if len(template.Sandbox) > 0 {
-		parts = append(parts, "sandbox "+strings.Join(template.Sandbox, " "))
-	}
-
-	if len(template.TrustedTypes) > 0 {
-		parts = append(parts, "trusted-types "+strings.Join(template.TrustedTypes, " "))
-	}
-
-	if len(template.ReportTo) > 0 {
-		parts = append(parts, "report-to "+strings.Join(template.ReportTo, " "))
-	}
-
-	if len(template.BaseURI) > 0 {
-		parts = append(parts, "base-uri "+strings.Join(template.BaseURI, " "))
-	}
-
-	if len(template.FormAction) > 0 {
-		parts = append(parts, "form-action "+strings.Join(template.FormAction, " "))
-	}
-
-	if len(template.FrameAncestors) > 0 {
-		parts = append(parts, "frame-ancestors "+strings.Join(template.FrameAncestors, " "))
-	}
+	return httpcsp.GenerateStrictCSP(template)
+}
 
-	if template.RequireTrustedTypesFor {
-		parts = append(parts, "require-trusted-types-for 'script'")
+// OverrideStrictDirectives replaces directives of a generated strict CSP, in name order.
+// A nil source list removes the directive; an empty one keeps a directive without value.
+func OverrideStrictDirectives(strictCSP string, directives map[string][]string) string {
+	names := make([]string, 0, len(directives))
+	for name := range directives {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	if template.UpgradeInsecure {
-		parts = append(parts, "upgrade-insecure-requests")
+	policy := ParsePolicy(strictCSP)
+	for _, name := range names {
+		sources := directives[name]
+		if sources == nil {
+			policy.Delete(name)
+			continue
+		}
+		directive := policy.Ensure(name)
+		directive.Sources = []SourceExpression{}
+		directive.Add(sources...)
 	}
-
-	return strings.Join(parts, "; ")
+	return policy.String()
 }
 
 // MergeStrictCSPWithHashes takes a strict CSP and adds hashes to it
 func MergeStrictCSPWithHashes(strictCSP string, scriptHashes, styleTagHashes, styleAttrHashes []string, hasEventHandlers bool) (string, error) {
-	directives := parseCSPDirectives(strictCSP)
+	policy := ParsePolicy(strictCSP)
 
 	// Add script hashes to script-src
 	if len(scriptHashes) > 0 || hasEventHandlers {
-		scriptSrc := directives["script-src"]
-
-		// Add hashes
-		if len(scriptHashes) > 0 {
-			if scriptSrc != "" {
-				scriptSrc = scriptSrc + " " + strings.Join(scriptHashes, " ")
-			} else {
-				scriptSrc = strings.Join(scriptHashes, " ")
-			}
-		}
+		scriptSrc := policy.Ensure("script-src")
+		scriptSrc.Add(scriptHashes...)
 
 		// Add 'unsafe-hashes' if there are event handlers
-		if hasEventHandlers && !strings.Contains(scriptSrc, "'unsafe-hashes'") {
-			if scriptSrc != "" {
-				scriptSrc = scriptSrc + " 'unsafe-hashes'"
-			} else {
-				scriptSrc = "'unsafe-hashes'"
-			}
+		if hasEventHandlers {
+			scriptSrc.Add("'unsafe-hashes'")
 		}
-
-		directives["script-src"] = scriptSrc
 	}
 
 	// Add style hashes to style-src
 	if len(styleTagHashes) > 0 || len(styleAttrHashes) > 0 {
-		styleSrc := directives["style-src"]
-
-		// Add style tag hashes
-		if len(styleTagHashes) > 0 {
-			if styleSrc != "" {
-				styleSrc = styleSrc + " " + strings.Join(styleTagHashes, " ")
-			} else {
-				styleSrc = strings.Join(styleTagHashes, " ")
-			}
-		}
-
-		// Add style attribute hashes
-		if len(styleAttrHashes) > 0 {
-			if styleSrc != "" {
-				styleSrc = styleSrc + " " + strings.Join(styleAttrHashes, " ")
-			} else {
-				styleSrc = strings.Join(styleAttrHashes, " ")
-			}
-		}
+		styleSrc := policy.Ensure("style-src")
+		styleSrc.Add(styleTagHashes...)
+		styleSrc.Add(styleAttrHashes...)
 
 		// Add 'unsafe-hashes' if there are style attributes
-		if len(styleAttrHashes) > 0 && !strings.Contains(styleSrc, "'unsafe-hashes'") {
-			if styleSrc != "" {
-				styleSrc = styleSrc + " 'unsafe-hashes'"
-			} else {
-				styleSrc = "'unsafe-hashes'"
-			}
+		if len(styleAttrHashes) > 0 {
+			styleSrc.Add("'unsafe-hashes'")
 		}
-
-		directives["style-src"] = styleSrc
 	}
 
-	return reconstructCSP(directives), nil
+	return policy.String(), nil
 }
 
 // AddExternalResourcesToStrictCSP adds external resource domains to a strict CSP
@@ -230,9 +81,33 @@ func AddExternalResourcesToStrictCSP(strictCSP string, resources *ExternalResour
 
 // CSPModification represents an add or remove operation on a CSP directive
 type CSPModification struct {
-	Action    string // "add" or "remove"
-	Directive string // e.g., "script-src"
-	Value     string // e.g., "'self'"
+	Action    string `json:"action"`    // "add" or "remove"
+	Directive string `json:"directive"` // e.g., "script-src"
+	Value     string `json:"value"`     // e.g., "'self'"
+}
+
+// CheckCSPModification validates a modification against the directive registry and,
+// for source list directives, the source expression grammar
+func CheckCSPModification(mod CSPModification) error {
+	if mod.Action != "add" && mod.Action != "remove" {
+		return fmt.Errorf("invalid action %q: must be \"add\" or \"remove\"", mod.Action)
+	}
+
+	info, known := LookupDirective(mod.Directive)
+	if !known {
+		if suggestion := SuggestDirective(mod.Directive); suggestion != "" {
+			return fmt.Errorf("unknown directive %q, did you mean %q?", mod.Directive, suggestion)
+		}
+		return fmt.Errorf("unknown directive %q", mod.Directive)
+	}
+
+	if mod.Action == "add" && info.SourceList {
+		if problem := checkSourceExpression(strings.TrimSpace(mod.Value)); problem != nil && problem.Severity == "error" {
+			return fmt.Errorf("invalid value %q for %s: %s", mod.Value, info.Name, problem.Message)
+		}
+	}
+
+	return nil
 }
 
 // ApplyCSPModifications applies a series of add/remove operations to a CSP string in order
@@ -241,52 +116,32 @@ func ApplyCSPModifications(cspString string, modifications []CSPModification) st
 		return cspString
 	}
 
-	directives := parseCSPDirectives(cspString)
+	policy := ParsePolicy(cspString)
 
 	for _, mod := range modifications {
-		directive := mod.Directive
 		value := strings.TrimSpace(mod.Value)
-
-		if directive == "" || value == "" {
+		info, _ := LookupDirective(mod.Directive)
+		if mod.Directive == "" || value == "" && !info.NoValue {
 			continue
 		}
 
-		currentValue := directives[directive]
-		var values []string
-
-		if currentValue != "" {
-			values = strings.Fields(currentValue)
-		}
-
-		if mod.Action == "add" {
-			// Only add if not already present
-			found := false
-			for _, v := range values {
-				if v == value {
-					found = true
-					break
-				}
+		switch mod.Action {
+		case "add":
+			directive := policy.Ensure(mod.Directive)
+			if !info.NoValue {
+				directive.Add(value)
 			}
-			if !found {
-				values = append(values, value)
+		case "remove":
+			directive := policy.Get(mod.Directive)
+			if directive == nil {
+				continue
 			}
-		} else if mod.Action == "remove" {
-			// Remove the value
-			newValues := []string{}
-			for _, v := range values {
-				if v != value {
-					newValues = append(newValues, v)
-				}
+			directive.Remove(value)
+			if info.NoValue || len(directive.Sources) == 0 {
+				policy.Delete(mod.Directive)
 			}
-			values = newValues
-		}
-
-		if len(values) > 0 {
-			directives[directive] = strings.Join(values, " ")
-		} else {
-			delete(directives, directive)
 		}
 	}
 
-	return reconstructCSP(directives)
+	return policy.String()
 }
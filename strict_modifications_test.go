@@ -65,6 +65,22 @@ func TestApplyCSPModifications(t *testing.T) {
 			},
 			expectContains: []string{"https://example.com"},
 		},
+		{
+			name:       "add value-less directive",
+			initialCSP: "default-src 'self'",
+			modifications: []CSPModification{
+				{Action: "add", Directive: "upgrade-insecure-requests"},
+			},
+			expectContains: []string{"default-src 'self'; upgrade-insecure-requests"},
+		},
+		{
+			name:       "remove value-less directive",
+			initialCSP: "default-src 'self'; upgrade-insecure-requests",
+			modifications: []CSPModification{
+				{Action: "remove", Directive: "upgrade-insecure-requests"},
+			},
+			expectNotContains: []string{"upgrade-insecure-requests"},
+		},
 		{
 			name:       "remove all values",
 			initialCSP: "script-src 'self'",
@@ -93,3 +109,59 @@ func TestApplyCSPModifications(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckCSPModification(t *testing.T) {
+	tests := []struct {
+		name      string
+		mod       CSPModification
+		expectErr string
+	}{
+		{
+			name: "valid add",
+			mod:  CSPModification{Action: "add", Directive: "script-src", Value: "https://cdn.example.com"},
+		},
+		{
+			name: "valid remove",
+			mod:  CSPModification{Action: "remove", Directive: "img-src", Value: "data:"},
+		},
+		{
+			name: "non source list value",
+			mod:  CSPModification{Action: "add", Directive: "sandbox", Value: "allow-scripts"},
+		},
+		{
+			name:      "invalid action",
+			mod:       CSPModification{Action: "replace", Directive: "script-src", Value: "'self'"},
+			expectErr: "invalid action",
+		},
+		{
+			name:      "misspelt directive",
+			mod:       CSPModification{Action: "add", Directive: "scirpt-src", Value: "'self'"},
+			expectErr: "did you mean \"script-src\"",
+		},
+		{
+			name:      "unknown directive",
+			mod:       CSPModification{Action: "add", Directive: "x-custom", Value: "'self'"},
+			expectErr: "unknown directive",
+		},
+		{
+			name:      "unquoted keyword",
+			mod:       CSPModification{Action: "add", Directive: "script-src", Value: "self"},
+			expectErr: "must be quoted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCSPModification(tt.mod)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.expectErr, err)
+			}
+		})
+	}
+}
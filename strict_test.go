@@ -219,3 +219,17 @@ func TestDefaultTemplateDoesNotRequireTrustedTypes(t *testing.T) {
 		t.Error("Default template should not enable require-trusted-types-for by default")
 	}
 }
+
+func TestOverrideStrictDirectives(t *testing.T) {
+	strictCSP := "default-src 'none'; img-src 'self'; upgrade-insecure-requests"
+	got := OverrideStrictDirectives(strictCSP, map[string][]string{
+		"img-src":                   {"'self'", "https://cdn.example.com"},
+		"upgrade-insecure-requests": nil,
+		"connect-src":               {"'self'"},
+		"block-all-mixed-content":   {},
+	})
+	expected := "default-src 'none'; img-src 'self' https://cdn.example.com; block-all-mixed-content; connect-src 'self'"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
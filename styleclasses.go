@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// styleClassPrefix starts the names of the classes generated for style attributes
+const styleClassPrefix = "csp-s-"
+
+// StyleClasses converts style attributes into generated classes, collecting the rules of
+// every converted page into a single stylesheet
+type StyleClasses struct {
+	// IgnorePageStyles also converts the style attributes of pages with their own
+	// stylesheets, whose rules may then override the generated classes
+	IgnorePageStyles bool
+
+	names []string          // generated class names in order of first use
+	rules map[string]string // declarations by class name
+}
+
+// StyleClassResult describes the style attributes converted on one page
+type StyleClassResult struct {
+	Elements int      // number of elements whose style attribute was removed
+	Classes  int      // number of elements given a generated class
+	Values   []string // the removed style attribute values
+	Skipped  []SkippedInline
+}
+
+// NewStyleClasses returns an empty set of generated classes
+func NewStyleClasses() *StyleClasses {
+	return &StyleClasses{rules: map[string]string{}}
+}
+
+// Convert replaces each style attribute of a page with a class named after its content.
+// Elements with the same declarations share a class, and existing classes are kept. A style
+// attribute overrides every stylesheet rule, but a single class loses to more specific or
+// later rules, so the attributes of pages with their own stylesheets are left inline
+// unless IgnorePageStyles is set.
+func (sc *StyleClasses) Convert(page *Page) *StyleClassResult {
+	result := &StyleClassResult{}
+	pageStyles := !sc.IgnorePageStyles && hasStylesheets(page.Tags)
+
+	for _, tag := range page.Tags {
+		if !hasSourceAttr(tag, "style") {
+			continue
+		}
+		value := getSourceAttr(tag, "style")
+		declarations := strings.TrimSpace(value)
+
+		reason := styleClassProblem(declarations)
+		if reason == "" && declarations != "" && pageStyles {
+			reason = "the page has its own stylesheets, whose more specific or later rules would override the generated class"
+		}
+		if reason != "" {
+			result.Skipped = append(result.Skipped, SkippedInline{Type: ContentTypeStyleAttr, Line: tag.Line, Column: tag.Column, Reason: reason})
+			continue
+		}
+
+		tag.removeAttr("style")
+		result.Elements++
+		result.Values = append(result.Values, value)
+		if declarations == "" {
+			continue
+		}
+
+		name := styleClassPrefix + contentHash(declarations)[:8]
+		if _, ok := sc.rules[name]; !ok {
+			sc.names = append(sc.names, name)
+			sc.rules[name] = declarations
+		}
+		result.Classes++
+		classes := strings.Fields(getSourceAttr(tag, "class"))
+		if !containsString(classes, name) {
+			tag.setAttr("class", strings.Join(append(classes, name), " "))
+		}
+	}
+
+	return result
+}
+
+// styleClassProblem returns why a style attribute cannot be replaced by a class, or ""
+func styleClassProblem(declarations string) string {
+	switch {
+	case strings.Contains(strings.ToLower(declarations), "!important"):
+		return "!important in a style attribute overrides every stylesheet rule, which a class cannot reproduce"
+	case strings.ContainsAny(declarations, "{}<>"):
+		return "the value contains braces or angle brackets, such as template syntax, that cannot be moved into a stylesheet"
+	}
+	for _, match := range relativeCSSURLRegex.FindAllStringSubmatch(declarations, -1) {
+		if isRelativeURL(match[1]) {
+			return fmt.Sprintf("relative URL %q would resolve against the stylesheet's URL instead of the page's", match[1])
+		}
+	}
+	return ""
+}
+
+// hasStylesheets reports whether a page has <style> or stylesheet <link> elements
+func hasStylesheets(tags []*sourceTag) bool {
+	for _, tag := range tags {
+		switch tag.Name {
+		case "style":
+			return true
+		case "link":
+			if containsString(strings.Fields(strings.ToLower(getSourceAttr(tag, "rel"))), "stylesheet") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Empty reports whether no class has been generated
+func (sc *StyleClasses) Empty() bool {
+	return len(sc.names) == 0
+}
+
+// Stylesheet returns the content-addressed stylesheet holding every generated class
+func (sc *StyleClasses) Stylesheet() InlineAsset {
+	var buf strings.Builder
+	buf.WriteString("/* Style attributes moved into classes by csp */\n")
+	for _, name := range sc.names {
+		fmt.Fprintf(&buf, ".%s { %s }\n", name, sc.rules[name])
+	}
+	content := buf.String()
+	return InlineAsset{Name: "styles-" + contentHash(content) + ".css", Type: ContentTypeStyleTag, Content: content}
+}
+
+// LinkStylesheet references a stylesheet in assetsDir from a page written to outPath. The
+// link is inserted at the end of <head>, after the page's own stylesheets in <head>.
+func LinkStylesheet(page *Page, outPath, assetsDir, name string) error {
+	assetsURL, err := filepath.Rel(filepath.Dir(outPath), assetsDir)
+	if err != nil {
+		return err
+	}
+	url := name
+	if assetsURL = filepath.ToSlash(assetsURL); assetsURL != "." {
+		url = assetsURL + "/" + name
+	}
+
+	pos := headEnd(page.Source, page.Tags)
+	page.Replace(htmlEdit{Start: pos, End: pos, Text: fmt.Sprintf(`<link rel="stylesheet" href="%s">`, escapeAttrValue(url))})
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStyleClassesConvert(t *testing.T) {
+	red := styleClassPrefix + contentHash("color: red")[:8]
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+		elements int
+		classes  int
+		skipped  int
+	}{
+		{
+			name:     "adds a class",
+			source:   `<p style="color: red">a</p>`,
+			expected: `<p class="` + red + `">a</p>`,
+			elements: 1,
+			classes:  1,
+		},
+		{
+			name:     "keeps existing classes",
+			source:   `<p class="lead" style=" color: red ">a</p>`,
+			expected: `<p class="lead ` + red + `">a</p>`,
+			elements: 1,
+			classes:  1,
+		},
+		{
+			name:     "shares a class",
+			source:   `<p style="color: red">a</p><b style="color: red">b</b>`,
+			expected: `<p class="` + red + `">a</p><b class="` + red + `">b</b>`,
+			elements: 2,
+			classes:  2,
+		},
+		{
+			name:     "removes empty values",
+			source:   `<p style="">a</p><p style>b</p>`,
+			expected: `<p>a</p><p>b</p>`,
+			elements: 2,
+		},
+		{
+			name:     "skips important",
+			source:   `<p style="display: none !IMPORTANT">a</p>`,
+			expected: `<p style="display: none !IMPORTANT">a</p>`,
+			skipped:  1,
+		},
+		{
+			name:     "skips templates",
+			source:   `<p style="width: {{.Width}}px">a</p>`,
+			expected: `<p style="width: {{.Width}}px">a</p>`,
+			skipped:  1,
+		},
+		{
+			name:     "skips relative URLs",
+			source:   `<p style="background: url(img/x.png)">a</p><p style="background: url('/img/x.png')">b</p>`,
+			expected: `<p style="background: url(img/x.png)">a</p><p class="` + styleClassPrefix + contentHash("background: url('/img/x.png')")[:8] + `">b</p>`,
+			elements: 1,
+			classes:  1,
+			skipped:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage("", []byte(tt.source))
+			result := NewStyleClasses().Convert(page)
+			if got := string(page.Bytes()); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+			if result.Elements != tt.elements || result.Classes != tt.classes || len(result.Skipped) != tt.skipped {
+				t.Errorf("Expected %d elements, %d classes and %d skipped, got %+v", tt.elements, tt.classes, tt.skipped, result)
+			}
+			if len(result.Values) != tt.elements {
+				t.Errorf("Expected %d removed values, got %v", tt.elements, result.Values)
+			}
+		})
+	}
+}
+
+func TestStyleClassesPageStyles(t *testing.T) {
+	red := styleClassPrefix + contentHash("color: red")[:8]
+	tests := []struct {
+		name     string
+		source   string
+		ignore   bool
+		expected string
+		skipped  int
+	}{
+		{
+			name:     "other links",
+			source:   `<link rel="icon" href="x.ico"><p style="color: red">a</p>`,
+			expected: `<link rel="icon" href="x.ico"><p class="` + red + `">a</p>`,
+		},
+		{
+			name:     "stylesheet link",
+			source:   `<link rel="Alternate StyleSheet" href="x.css"><p style="color: red">a</p><p style="">b</p>`,
+			expected: `<link rel="Alternate StyleSheet" href="x.css"><p style="color: red">a</p><p>b</p>`,
+			skipped:  1,
+		},
+		{
+			name:     "style element",
+			source:   "<p style=\"color: red\">a</p>\n<b style=\"margin: 0\">b</b><style>p { color: blue }</style>",
+			expected: "<p style=\"color: red\">a</p>\n<b style=\"margin: 0\">b</b><style>p { color: blue }</style>",
+			skipped:  2,
+		},
+		{
+			name:     "ignored",
+			source:   `<p style="color: red">a</p><style>p { color: blue }</style>`,
+			ignore:   true,
+			expected: `<p class="` + red + `">a</p><style>p { color: blue }</style>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := NewStyleClasses()
+			sc.IgnorePageStyles = tt.ignore
+			page := NewPage("", []byte(tt.source))
+			result := sc.Convert(page)
+			if got := string(page.Bytes()); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+			if len(result.Skipped) != tt.skipped {
+				t.Fatalf("Expected %d skipped, got %+v", tt.skipped, result.Skipped)
+			}
+			if tt.skipped == 2 && (result.Skipped[1].Line != 2 || !strings.Contains(result.Skipped[1].Reason, "own stylesheets")) {
+				t.Errorf("Expected the second attribute reported at line 2, got %+v", result.Skipped[1])
+			}
+		})
+	}
+}
+
+func TestStyleClassesStylesheet(t *testing.T) {
+	sc := NewStyleClasses()
+	if !sc.Empty() {
+		t.Fatal("Expected no classes")
+	}
+	sc.Convert(NewPage("a.html", []byte(`<p style="color: red">a</p><p style="margin: 0">b</p>`)))
+	sc.Convert(NewPage("b.html", []byte(`<p style="color: red">c</p>`)))
+
+	sheet := sc.Stylesheet()
+	red := styleClassPrefix + contentHash("color: red")[:8]
+	margin := styleClassPrefix + contentHash("margin: 0")[:8]
+	if !strings.HasSuffix(sheet.Content, "."+red+" { color: red }\n."+margin+" { margin: 0 }\n") {
+		t.Errorf("Expected one rule per class in order of use, got:\n%s", sheet.Content)
+	}
+	if sheet.Name != "styles-"+contentHash(sheet.Content)+".css" || sheet.Type != ContentTypeStyleTag {
+		t.Errorf("Expected a content-addressed stylesheet, got %s (%s)", sheet.Name, sheet.Type)
+	}
+}
+
+func TestLinkStylesheet(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		outPath  string
+		expected string
+	}{
+		{
+			name:     "before the end of head",
+			source:   `<html><head><link rel="stylesheet" href="site.css"></HEAD><body></body></html>`,
+			outPath:  "out/index.html",
+			expected: `<html><head><link rel="stylesheet" href="site.css"><link rel="stylesheet" href="assets/s.css"></HEAD><body></body></html>`,
+		},
+		{
+			name:     "nested page without head",
+			source:   `<body><p>a</p></body>`,
+			outPath:  "out/docs/index.html",
+			expected: `<link rel="stylesheet" href="../assets/s.css"><body><p>a</p></body>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage("", []byte(tt.source))
+			if err := LinkStylesheet(page, filepath.FromSlash(tt.outPath), filepath.Join("out", "assets"), "s.css"); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(page.Bytes()); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
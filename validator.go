@@ -2,20 +2,46 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 )
 
+// Validation rule IDs. They are stable identifiers for each kind of finding and must not be
+// renamed, since SARIF consumers use them to track findings across runs.
+const (
+	RuleEmptyPolicy            = "empty-policy"
+	RuleCommaSplitsPolicy      = "comma-splits-policy"
+	RuleInvalidSource          = "invalid-source-expression"
+	RuleNoneWithOtherSources   = "none-with-other-sources"
+	RuleDuplicateDirective     = "duplicate-directive"
+	RuleUnsafeInlineWithHashes = "unsafe-inline-with-hashes"
+	RuleUnsafeEval             = "unsafe-eval"
+	RuleMissingDefaultSrc      = "missing-default-src"
+	RuleWildcardSource         = "wildcard-source"
+	RuleDataURIScripts         = "data-uri-scripts"
+	RuleDeprecatedDirective    = "deprecated-directive"
+	RuleMisspeltDirective      = "misspelt-directive"
+	RuleUnknownDirective       = "unknown-directive"
+	RuleMissingFallback        = "missing-fallback-directive"
+	RuleRelativeReportURI      = "relative-report-uri"
+	RuleUndeclaredReportGroup  = "undeclared-report-group"
+)
+
 // ValidationWarning represents a CSP validation warning
 type ValidationWarning struct {
-	Severity string // "warning" or "error"
-	Message  string
-	Fix      string // suggested fix
+	Rule      string `json:"rule"`     // one of the Rule* constants
+	Severity  string `json:"severity"` // "warning" or "error"
+	Message   string `json:"message"`
+	Fix       string `json:"fix,omitempty"`       // suggested fix
+	Directive string `json:"directive,omitempty"` // directive the warning refers to, if any
+	Token     string `json:"token,omitempty"`     // offending source expression, if any
+	Position  int    `json:"position,omitempty"`  // 1-based position of Token in the directive's source list, 0 if not applicable
 }
 
 // ValidationResult contains the results of CSP validation
 type ValidationResult struct {
-	Valid    bool
-	Warnings []ValidationWarning
+	Valid    bool                `json:"valid"`
+	Warnings []ValidationWarning `json:"warnings"`
 }
 
 // ValidateCSP validates a CSP header and returns warnings about misconfigurations
@@ -25,12 +51,11 @@ func ValidateCSP(cspHeader string) ValidationResult {
 		Warnings: []ValidationWarning{},
 	}
 
-	directives := parseCSPDirectives(cspHeader)
-
 	// Check for empty or invalid CSP
 	if cspHeader == "" {
 		result.Valid = false
 		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:     RuleEmptyPolicy,
 			Severity: "error",
 			Message:  "CSP header is empty",
 			Fix:      "Provide a valid CSP header string",
@@ -38,66 +63,200 @@ func ValidateCSP(cspHeader string) ValidationResult {
 		return result
 	}
 
+	// A comma separates whole policies; validate each of them on its own
+	if strings.Contains(cspHeader, ",") {
+		checkCommaSeparatedPolicies(&result, cspHeader)
+
+		for i, policy := range ParsePolicyList(cspHeader).Policies {
+			policyResult := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
+			validatePolicy(&policyResult, policy)
+			for _, warning := range policyResult.Warnings {
+				warning.Message = fmt.Sprintf("Policy %d: %s", i+1, warning.Message)
+				result.Warnings = append(result.Warnings, warning)
+			}
+			if !policyResult.Valid {
+				result.Valid = false
+			}
+		}
+		return result
+	}
+
+	validatePolicy(&result, ParsePolicy(cspHeader))
+	return result
+}
+
+// validatePolicy runs all checks that apply to a single policy
+func validatePolicy(result *ValidationResult, policy *Policy) {
+	// Check every source expression against the CSP3 grammar
+	checkSourceExpressions(result, policy)
+
+	// Check for 'none' combined with other sources
+	checkNoneWithOtherSources(result, policy)
+
+	// Check for unknown or misspelt directives
+	checkUnknownDirectives(result, policy)
+
+	// Check for duplicate directives
+	checkDuplicateDirectives(result, policy)
+
 	// Check for 'unsafe-inline' with hashes
-	checkUnsafeInlineWithHashes(&result, directives)
+	checkUnsafeInlineWithHashes(result, policy)
 
 	// Check for 'unsafe-eval'
-	checkUnsafeEval(&result, directives)
+	checkUnsafeEval(result, policy)
 
 	// Check for missing default-src
-	checkMissingDefaultSrc(&result, directives)
+	checkMissingDefaultSrc(result, policy)
 
 	// Check for overly permissive policies
-	checkOverlyPermissive(&result, directives)
+	checkOverlyPermissive(result, policy)
 
 	// Check for deprecated directives
-	checkDeprecatedDirectives(&result, directives)
+	checkDeprecatedDirectives(result, policy)
 
 	// Check for conflicting directives
-	checkConflictingDirectives(&result, directives)
+	checkConflictingDirectives(result, policy)
 
-	return result
+	// Check that reports are sent to absolute URLs
+	checkReportURIs(result, policy)
 }
 
-// checkUnsafeInlineWithHashes warns if unsafe-inline is used with hashes
-func checkUnsafeInlineWithHashes(result *ValidationResult, directives map[string]string) {
-	directivesToCheck := []string{"script-src", "style-src"}
+// checkCommaSeparatedPolicies reports commas that split a policy by accident, i.e. where
+// the text after the comma does not start with a (possibly misspelt) directive name
+func checkCommaSeparatedPolicies(result *ValidationResult, cspHeader string) {
+	parts := strings.Split(cspHeader, ",")
+	for _, part := range parts[1:] {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 || isDirectiveName(tokens[0]) {
+			continue
+		}
+
+		result.Valid = false
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:     RuleCommaSplitsPolicy,
+			Severity: "error",
+			Message:  fmt.Sprintf("Comma before '%s' splits the CSP into separate policies", tokens[0]),
+			Fix:      "Separate sources with spaces and directives with ';' - a comma starts a new policy",
+		})
+	}
+}
 
-	for _, directive := range directivesToCheck {
-		if value, exists := directives[directive]; exists {
-			hasUnsafeInline := strings.Contains(value, "'unsafe-inline'")
-			hasHashes := strings.Contains(value, "'sha256-") ||
-				strings.Contains(value, "'sha384-") ||
-				strings.Contains(value, "'sha512-")
+// isDirectiveName reports whether a token is a known directive or a plausible misspelling of one
+func isDirectiveName(token string) bool {
+	if _, known := LookupDirective(token); known {
+		return true
+	}
+	return SuggestDirective(token) != ""
+}
+
+// checkSourceExpressions validates each token of every source list directive
+func checkSourceExpressions(result *ValidationResult, policy *Policy) {
+	for _, directive := range policy.Directives {
+		if !isSourceListDirective(directive.Name) {
+			continue
+		}
 
-			if hasUnsafeInline && hasHashes {
+		for i, src := range directive.Sources {
+			problem := checkSourceExpression(src.Value)
+			if problem == nil {
+				continue
+			}
+
+			if problem.Severity == "error" {
+				result.Valid = false
+			}
+			result.Warnings = append(result.Warnings, ValidationWarning{
+				Rule:      RuleInvalidSource,
+				Severity:  problem.Severity,
+				Message:   fmt.Sprintf("%s source #%d %s: %s", directive.Name, i+1, src.Value, problem.Message),
+				Fix:       problem.Fix,
+				Directive: directive.Name,
+				Token:     src.Value,
+				Position:  i + 1,
+			})
+		}
+	}
+}
+
+// checkNoneWithOtherSources warns when 'none' is combined with other sources, where it is ignored
+func checkNoneWithOtherSources(result *ValidationResult, policy *Policy) {
+	for _, directive := range policy.Directives {
+		if !isSourceListDirective(directive.Name) || len(directive.Sources) < 2 {
+			continue
+		}
+
+		for i, src := range directive.Sources {
+			if src.Equal("'none'") {
 				result.Warnings = append(result.Warnings, ValidationWarning{
-					Severity: "warning",
-					Message:  fmt.Sprintf("%s contains both 'unsafe-inline' and hash values", directive),
-					Fix:      fmt.Sprintf("Remove 'unsafe-inline' from %s - hashes are ignored when 'unsafe-inline' is present", directive),
+					Rule:      RuleNoneWithOtherSources,
+					Severity:  "warning",
+					Message:   fmt.Sprintf("%s combines 'none' with other sources; 'none' is ignored", directive.Name),
+					Fix:       fmt.Sprintf("Remove 'none' from %s, or remove all other sources to block everything", directive.Name),
+					Directive: directive.Name,
+					Token:     src.Value,
+					Position:  i + 1,
 				})
+				break
 			}
 		}
 	}
 }
 
-// checkUnsafeEval warns about usage of unsafe-eval
-func checkUnsafeEval(result *ValidationResult, directives map[string]string) {
-	if scriptSrc, exists := directives["script-src"]; exists {
-		if strings.Contains(scriptSrc, "'unsafe-eval'") {
+// checkDuplicateDirectives warns about repeated directives, which browsers ignore
+func checkDuplicateDirectives(result *ValidationResult, policy *Policy) {
+	for _, name := range policy.Duplicates() {
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleDuplicateDirective,
+			Severity:  "warning",
+			Message:   fmt.Sprintf("'%s' is defined more than once; only the first occurrence is enforced", name),
+			Fix:       fmt.Sprintf("Merge all '%s' source lists into a single directive", name),
+			Directive: name,
+		})
+	}
+}
+
+// checkUnsafeInlineWithHashes warns if unsafe-inline is used with hashes
+func checkUnsafeInlineWithHashes(result *ValidationResult, policy *Policy) {
+	directivesToCheck := []string{"script-src", "style-src"}
+
+	for _, name := range directivesToCheck {
+		directive := policy.Get(name)
+		if directive == nil {
+			continue
+		}
+
+		if directive.Has("'unsafe-inline'") && directive.HasKind(SourceKindHash) {
 			result.Warnings = append(result.Warnings, ValidationWarning{
-				Severity: "warning",
-				Message:  "script-src contains 'unsafe-eval' which allows dangerous eval() usage",
-				Fix:      "Remove 'unsafe-eval' if possible and refactor code to avoid eval(), Function(), setTimeout(string), etc.",
+				Rule:      RuleUnsafeInlineWithHashes,
+				Severity:  "warning",
+				Message:   fmt.Sprintf("%s contains both 'unsafe-inline' and hash values", name),
+				Fix:       fmt.Sprintf("Remove 'unsafe-inline' from %s - hashes are ignored when 'unsafe-inline' is present", name),
+				Directive: name,
+				Token:     "'unsafe-inline'",
 			})
 		}
 	}
 }
 
+// checkUnsafeEval warns about usage of unsafe-eval
+func checkUnsafeEval(result *ValidationResult, policy *Policy) {
+	if scriptSrc := policy.Get("script-src"); scriptSrc != nil && scriptSrc.Has("'unsafe-eval'") {
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleUnsafeEval,
+			Severity:  "warning",
+			Message:   "script-src contains 'unsafe-eval' which allows dangerous eval() usage",
+			Fix:       "Remove 'unsafe-eval' if possible and refactor code to avoid eval(), Function(), setTimeout(string), etc.",
+			Directive: "script-src",
+			Token:     "'unsafe-eval'",
+		})
+	}
+}
+
 // checkMissingDefaultSrc warns if default-src is missing
-func checkMissingDefaultSrc(result *ValidationResult, directives map[string]string) {
-	if _, exists := directives["default-src"]; !exists {
+func checkMissingDefaultSrc(result *ValidationResult, policy *Policy) {
+	if !policy.Has("default-src") {
 		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:     RuleMissingDefaultSrc,
 			Severity: "warning",
 			Message:  "Missing 'default-src' directive",
 			Fix:      "Add 'default-src' as a fallback for other directives (recommended: 'default-src 'self'')",
@@ -106,77 +265,161 @@ func checkMissingDefaultSrc(result *ValidationResult, directives map[string]stri
 }
 
 // checkOverlyPermissive warns about overly permissive policies
-func checkOverlyPermissive(result *ValidationResult, directives map[string]string) {
-	directivesToCheck := map[string]string{
-		"default-src": "default-src",
-		"script-src":  "script-src",
-		"style-src":   "style-src",
-		"img-src":     "img-src",
-		"connect-src": "connect-src",
-	}
-
-	for directive, name := range directivesToCheck {
-		if value, exists := directives[directive]; exists {
-			// Check for wildcard
-			if strings.Contains(value, "*") && !strings.Contains(value, "https://*") {
-				result.Warnings = append(result.Warnings, ValidationWarning{
-					Severity: "warning",
-					Message:  fmt.Sprintf("%s contains wildcard '*' which allows resources from any origin", name),
-					Fix:      fmt.Sprintf("Restrict %s to specific domains or use 'self'", name),
-				})
-			}
+func checkOverlyPermissive(result *ValidationResult, policy *Policy) {
+	directivesToCheck := []string{"default-src", "script-src", "style-src", "img-src", "connect-src"}
 
-			// Check for data: URIs in script-src
-			if directive == "script-src" && strings.Contains(value, "data:") {
+	for _, name := range directivesToCheck {
+		directive := policy.Get(name)
+		if directive == nil {
+			continue
+		}
+
+		// Check for wildcard
+		for _, src := range directive.Sources {
+			if src.Kind == SourceKindHost && strings.Contains(src.Value, "*") && !strings.HasPrefix(src.Value, "https://*") {
 				result.Warnings = append(result.Warnings, ValidationWarning{
-					Severity: "warning",
-					Message:  "script-src allows 'data:' URIs which can be exploited",
-					Fix:      "Remove 'data:' from script-src if not absolutely necessary",
+					Rule:      RuleWildcardSource,
+					Severity:  "warning",
+					Message:   fmt.Sprintf("%s contains wildcard '*' which allows resources from any origin", name),
+					Fix:       fmt.Sprintf("Restrict %s to specific domains or use 'self'", name),
+					Directive: name,
+					Token:     src.Value,
 				})
+				break
 			}
 		}
+
+		// Check for data: URIs in script-src
+		if name == "script-src" && directive.Has("data:") {
+			result.Warnings = append(result.Warnings, ValidationWarning{
+				Rule:      RuleDataURIScripts,
+				Severity:  "warning",
+				Message:   "script-src allows 'data:' URIs which can be exploited",
+				Fix:       "Remove 'data:' from script-src if not absolutely necessary",
+				Directive: "script-src",
+				Token:     "data:",
+			})
+		}
 	}
 }
 
 // checkDeprecatedDirectives warns about deprecated directives
-func checkDeprecatedDirectives(result *ValidationResult, directives map[string]string) {
-	deprecated := map[string]string{
-		"block-all-mixed-content": "Use 'upgrade-insecure-requests' instead, or handle via HTTPS",
-		"plugin-types":            "Deprecated - plugins are no longer supported in modern browsers",
-		"referrer":                "Use the Referrer-Policy header instead",
+func checkDeprecatedDirectives(result *ValidationResult, policy *Policy) {
+	for _, info := range knownDirectives {
+		if info.Deprecated && policy.Has(info.Name) {
+			result.Warnings = append(result.Warnings, ValidationWarning{
+				Rule:      RuleDeprecatedDirective,
+				Severity:  "warning",
+				Message:   fmt.Sprintf("'%s' is deprecated", info.Name),
+				Fix:       info.Replacement,
+				Directive: info.Name,
+			})
+		}
 	}
+}
+
+// checkUnknownDirectives reports directives that browsers do not know and silently ignore
+func checkUnknownDirectives(result *ValidationResult, policy *Policy) {
+	for _, directive := range policy.Directives {
+		if _, known := LookupDirective(directive.Name); known {
+			continue
+		}
 
-	for directive, suggestion := range deprecated {
-		if _, exists := directives[directive]; exists {
+		if suggestion := SuggestDirective(directive.Name); suggestion != "" {
+			result.Valid = false
 			result.Warnings = append(result.Warnings, ValidationWarning{
-				Severity: "warning",
-				Message:  fmt.Sprintf("'%s' is deprecated", directive),
-				Fix:      suggestion,
+				Rule:      RuleMisspeltDirective,
+				Severity:  "error",
+				Message:   fmt.Sprintf("Unknown directive '%s' will be ignored by browsers; did you mean '%s'?", directive.Name, suggestion),
+				Fix:       fmt.Sprintf("Rename '%s' to '%s'", directive.Name, suggestion),
+				Directive: directive.Name,
 			})
+			continue
 		}
+
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleUnknownDirective,
+			Severity:  "warning",
+			Message:   fmt.Sprintf("Unknown directive '%s' will be ignored by browsers", directive.Name),
+			Fix:       "Remove the directive or check the spelling against the CSP specification",
+			Directive: directive.Name,
+		})
 	}
 }
 
 // checkConflictingDirectives checks for conflicting or redundant directives
-func checkConflictingDirectives(result *ValidationResult, directives map[string]string) {
+func checkConflictingDirectives(result *ValidationResult, policy *Policy) {
 	// Check if style-src-attr exists without style-src
-	if _, hasStyleSrcAttr := directives["style-src-attr"]; hasStyleSrcAttr {
-		if _, hasStyleSrc := directives["style-src"]; !hasStyleSrc {
-			result.Warnings = append(result.Warnings, ValidationWarning{
-				Severity: "warning",
-				Message:  "'style-src-attr' is defined but 'style-src' is not",
-				Fix:      "Consider adding 'style-src' as it acts as fallback for 'style-src-attr'",
-			})
-		}
+	if policy.Has("style-src-attr") && !policy.Has("style-src") {
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleMissingFallback,
+			Severity:  "warning",
+			Message:   "'style-src-attr' is defined but 'style-src' is not",
+			Fix:       "Consider adding 'style-src' as it acts as fallback for 'style-src-attr'",
+			Directive: "style-src-attr",
+		})
 	}
 
 	// Check if script-src-attr exists without script-src
-	if _, hasScriptSrcAttr := directives["script-src-attr"]; hasScriptSrcAttr {
-		if _, hasScriptSrc := directives["script-src"]; !hasScriptSrc {
+	if policy.Has("script-src-attr") && !policy.Has("script-src") {
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleMissingFallback,
+			Severity:  "warning",
+			Message:   "'script-src-attr' is defined but 'script-src' is not",
+			Fix:       "Consider adding 'script-src' as it acts as fallback for 'script-src-attr'",
+			Directive: "script-src-attr",
+		})
+	}
+}
+
+// checkReportURIs warns about report-uri values that are not absolute URLs, which break
+// when the policy is sent from another host, e.g. by a CDN or a staging site
+func checkReportURIs(result *ValidationResult, policy *Policy) {
+	directive := policy.Get("report-uri")
+	if directive == nil {
+		return
+	}
+	for i, src := range directive.Sources {
+		if u, err := url.Parse(src.Value); err == nil && u.IsAbs() && u.Host != "" {
+			continue
+		}
+		result.Warnings = append(result.Warnings, ValidationWarning{
+			Rule:      RuleRelativeReportURI,
+			Severity:  "warning",
+			Message:   fmt.Sprintf("report-uri %s is not an absolute URL", src.Value),
+			Fix:       "Use an absolute URL such as https://example.com/csp-reports",
+			Directive: directive.Name,
+			Token:     src.Value,
+			Position:  i + 1,
+		})
+	}
+}
+
+// CheckReportGroups warns about report-to groups that none of the endpoints declares, to
+// which browsers send no reports
+func CheckReportGroups(result *ValidationResult, cspHeader string, endpoints []ReportEndpoint) {
+	declared := map[string]bool{}
+	for _, endpoint := range endpoints {
+		declared[endpoint.Name] = true
+	}
+
+	for _, policy := range ParsePolicyList(cspHeader).Policies {
+		directive := policy.Get("report-to")
+		if directive == nil {
+			continue
+		}
+		for i, src := range directive.Sources {
+			if declared[src.Value] {
+				continue
+			}
 			result.Warnings = append(result.Warnings, ValidationWarning{
-				Severity: "warning",
-				Message:  "'script-src-attr' is defined but 'script-src' is not",
-				Fix:      "Consider adding 'script-src' as it acts as fallback for 'script-src-attr'",
+				Rule:      RuleUndeclaredReportGroup,
+				Severity:  "warning",
+				Message:   fmt.Sprintf("report-to group %s has no endpoint in Reporting-Endpoints; no reports will be sent", src.Value),
+				Fix:       fmt.Sprintf("Declare the endpoint with --report-endpoint %s=URL, or report to a declared group", src.Value),
+				Directive: directive.Name,
+				Token:     src.Value,
+				Position:  i + 1,
 			})
 		}
 	}
@@ -28,7 +28,7 @@ func TestValidateCSP(t *testing.T) {
 		},
 		{
 			name:           "unsafe-inline with hashes",
-			csp:            "script-src 'self' 'unsafe-inline' 'sha256-abc123'",
+			csp:            "script-src 'self' 'unsafe-inline' 'sha256-n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg='",
 			expectValid:    true,
 			expectWarnings: 2, // unsafe-inline+hash + missing default-src
 		},
@@ -56,6 +56,12 @@ func TestValidateCSP(t *testing.T) {
 			expectValid:    true,
 			expectWarnings: 1,
 		},
+		{
+			name:           "duplicate directive",
+			csp:            "default-src 'self'; script-src 'self'; script-src https://cdn.example.com",
+			expectValid:    true,
+			expectWarnings: 1,
+		},
 		{
 			name:           "style-src-attr without style-src",
 			csp:            "default-src 'self'; style-src-attr 'unsafe-hashes'",
@@ -95,12 +101,10 @@ func TestValidateCSP(t *testing.T) {
 }
 
 func TestCheckUnsafeInlineWithHashes(t *testing.T) {
-	directives := map[string]string{
-		"script-src": "'self' 'unsafe-inline' 'sha256-abc123'",
-	}
+	policy := ParsePolicy("script-src 'self' 'unsafe-inline' 'sha256-abc123'")
 
 	result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-	checkUnsafeInlineWithHashes(&result, directives)
+	checkUnsafeInlineWithHashes(&result, policy)
 
 	if len(result.Warnings) != 1 {
 		t.Errorf("Expected 1 warning, got %d", len(result.Warnings))
@@ -112,12 +116,10 @@ func TestCheckUnsafeInlineWithHashes(t *testing.T) {
 }
 
 func TestCheckUnsafeEval(t *testing.T) {
-	directives := map[string]string{
-		"script-src": "'self' 'unsafe-eval'",
-	}
+	policy := ParsePolicy("script-src 'self' 'unsafe-eval'")
 
 	result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-	checkUnsafeEval(&result, directives)
+	checkUnsafeEval(&result, policy)
 
 	if len(result.Warnings) != 1 {
 		t.Errorf("Expected 1 warning, got %d", len(result.Warnings))
@@ -129,12 +131,10 @@ func TestCheckUnsafeEval(t *testing.T) {
 }
 
 func TestCheckMissingDefaultSrc(t *testing.T) {
-	directives := map[string]string{
-		"script-src": "'self'",
-	}
+	policy := ParsePolicy("script-src 'self'")
 
 	result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-	checkMissingDefaultSrc(&result, directives)
+	checkMissingDefaultSrc(&result, policy)
 
 	if len(result.Warnings) != 1 {
 		t.Errorf("Expected 1 warning, got %d", len(result.Warnings))
@@ -148,27 +148,27 @@ func TestCheckMissingDefaultSrc(t *testing.T) {
 func TestCheckOverlyPermissive(t *testing.T) {
 	tests := []struct {
 		name       string
-		directives map[string]string
+		csp        string
 		expectWarn bool
 	}{
 		{
 			name:       "wildcard in default-src",
-			directives: map[string]string{"default-src": "*"},
+			csp:        "default-src *",
 			expectWarn: true,
 		},
 		{
 			name:       "https wildcard is ok",
-			directives: map[string]string{"default-src": "https://*"},
+			csp:        "default-src https://*",
 			expectWarn: false,
 		},
 		{
 			name:       "data URI in script-src",
-			directives: map[string]string{"script-src": "'self' data:"},
+			csp:        "script-src 'self' data:",
 			expectWarn: true,
 		},
 		{
 			name:       "specific domains are ok",
-			directives: map[string]string{"script-src": "'self' https://example.com"},
+			csp:        "script-src 'self' https://example.com",
 			expectWarn: false,
 		},
 	}
@@ -176,7 +176,7 @@ func TestCheckOverlyPermissive(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-			checkOverlyPermissive(&result, tt.directives)
+			checkOverlyPermissive(&result, ParsePolicy(tt.csp))
 
 			hasWarning := len(result.Warnings) > 0
 			if hasWarning != tt.expectWarn {
@@ -187,13 +187,10 @@ func TestCheckOverlyPermissive(t *testing.T) {
 }
 
 func TestCheckDeprecatedDirectives(t *testing.T) {
-	directives := map[string]string{
-		"default-src":             "'self'",
-		"block-all-mixed-content": "",
-	}
+	policy := ParsePolicy("default-src 'self'; block-all-mixed-content")
 
 	result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-	checkDeprecatedDirectives(&result, directives)
+	checkDeprecatedDirectives(&result, policy)
 
 	if len(result.Warnings) != 1 {
 		t.Errorf("Expected 1 warning about deprecated directive, got %d", len(result.Warnings))
@@ -205,12 +202,10 @@ func TestCheckDeprecatedDirectives(t *testing.T) {
 }
 
 func TestCheckConflictingDirectives(t *testing.T) {
-	directives := map[string]string{
-		"style-src-attr": "'unsafe-hashes'",
-	}
+	policy := ParsePolicy("style-src-attr 'unsafe-hashes'")
 
 	result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
-	checkConflictingDirectives(&result, directives)
+	checkConflictingDirectives(&result, policy)
 
 	if len(result.Warnings) != 1 {
 		t.Errorf("Expected 1 warning about missing style-src, got %d", len(result.Warnings))
@@ -218,7 +213,7 @@ func TestCheckConflictingDirectives(t *testing.T) {
 }
 
 func TestValidateCSPWithMultipleIssues(t *testing.T) {
-	csp := "script-src 'self' 'unsafe-inline' 'unsafe-eval' 'sha256-test'; default-src *; block-all-mixed-content"
+	csp := "script-src 'self' 'unsafe-inline' 'unsafe-eval' 'sha256-n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg='; default-src *; block-all-mixed-content"
 
 	result := ValidateCSP(csp)
 
@@ -234,3 +229,164 @@ func TestValidateCSPWithMultipleIssues(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateCSPCommaSeparatedPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		csp         string
+		expectValid bool
+	}{
+		{
+			name:        "deliberate policy list",
+			csp:         "default-src 'self', default-src 'self'; img-src data:",
+			expectValid: true,
+		},
+		{
+			name:        "comma between sources",
+			csp:         "default-src 'self' https://a.example.com, https://b.example.com",
+			expectValid: false,
+		},
+		{
+			name:        "comma before scheme source",
+			csp:         "default-src 'self'; img-src 'self',data:",
+			expectValid: false,
+		},
+		{
+			name:        "invalid token in the first policy",
+			csp:         "default-src self, script-src 'self'",
+			expectValid: false,
+		},
+		{
+			name:        "invalid token in the second policy",
+			csp:         "default-src 'self', script-src 'self' 'unsafe-inlin'",
+			expectValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateCSP(tt.csp)
+			if result.Valid != tt.expectValid {
+				t.Errorf("Expected valid=%v, got %v", tt.expectValid, result.Valid)
+				for _, w := range result.Warnings {
+					t.Logf("  %s: %s", w.Severity, w.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCSPPrefixesPolicyNumber(t *testing.T) {
+	result := ValidateCSP("default-src 'self', script-src 'self'")
+
+	if len(result.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %d", len(result.Warnings))
+	}
+	if !strings.HasPrefix(result.Warnings[0].Message, "Policy 2: ") {
+		t.Errorf("Expected warning to be attributed to policy 2, got: %s", result.Warnings[0].Message)
+	}
+}
+
+func TestValidateCSPSourceExpressions(t *testing.T) {
+	result := ValidateCSP("default-src 'self'; script-src 'self' self https://cdn.example.com")
+
+	if result.Valid {
+		t.Error("Expected unquoted self to make the CSP invalid")
+	}
+
+	var found *ValidationWarning
+	for i := range result.Warnings {
+		if result.Warnings[i].Token == "self" {
+			found = &result.Warnings[i]
+		}
+	}
+	if found == nil {
+		t.Fatal("Expected a warning for the unquoted self token")
+	}
+	if found.Directive != "script-src" || found.Position != 2 {
+		t.Errorf("Expected script-src position 2, got %s position %d", found.Directive, found.Position)
+	}
+	if !strings.Contains(found.Fix, "'self'") {
+		t.Errorf("Expected fix to suggest 'self', got: %s", found.Fix)
+	}
+}
+
+func TestValidateCSPNoneWithOtherSources(t *testing.T) {
+	result := ValidateCSP("default-src 'none' 'self'")
+
+	if len(result.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %d", len(result.Warnings))
+	}
+	if result.Warnings[0].Directive != "default-src" || result.Warnings[0].Position != 1 {
+		t.Errorf("Expected warning at default-src position 1, got %s position %d", result.Warnings[0].Directive, result.Warnings[0].Position)
+	}
+}
+
+func TestValidateCSPIgnoresNonSourceListDirectives(t *testing.T) {
+	result := ValidateCSP("default-src 'self'; sandbox allow-scripts; report-to csp-endpoint; require-trusted-types-for 'script'")
+
+	if !result.Valid || len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings for non source list directives, got %d", len(result.Warnings))
+		for _, w := range result.Warnings {
+			t.Logf("  %s: %s", w.Severity, w.Message)
+		}
+	}
+}
+
+func TestValidateCSPUnknownDirectives(t *testing.T) {
+	result := ValidateCSP("default-src 'self'; scirpt-src 'self'; x-experimental on")
+
+	if result.Valid {
+		t.Error("Expected a misspelt directive to make the CSP invalid")
+	}
+	if len(result.Warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %d", len(result.Warnings))
+	}
+	if !strings.Contains(result.Warnings[0].Message, "did you mean 'script-src'") {
+		t.Errorf("Expected a did-you-mean suggestion, got: %s", result.Warnings[0].Message)
+	}
+	if result.Warnings[1].Severity != "warning" {
+		t.Errorf("Expected an unknown directive without suggestion to be a warning, got %s", result.Warnings[1].Severity)
+	}
+}
+
+func TestValidateCSPReportURIs(t *testing.T) {
+	result := ValidateCSP("default-src 'self'; report-uri https://csp.example.com/r /csp")
+
+	if len(result.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %d", len(result.Warnings))
+	}
+	warning := result.Warnings[0]
+	if warning.Rule != RuleRelativeReportURI || warning.Token != "/csp" || warning.Position != 2 {
+		t.Errorf("Expected a relative report-uri warning for /csp at position 2, got %+v", warning)
+	}
+}
+
+func TestCheckReportGroups(t *testing.T) {
+	endpoints := []ReportEndpoint{{Name: "csp", URL: "https://csp.example.com/r"}}
+
+	tests := []struct {
+		csp    string
+		tokens []string
+	}{
+		{"default-src 'self'; report-to csp", nil},
+		{"default-src 'self'", nil},
+		{"default-src 'self'; report-to csp-endpoint", []string{"csp-endpoint"}},
+		{"default-src 'self'; report-to csp, img-src 'self'; report-to other", []string{"other"}},
+	}
+
+	for _, tt := range tests {
+		result := ValidationResult{Valid: true, Warnings: []ValidationWarning{}}
+		CheckReportGroups(&result, tt.csp, endpoints)
+		var tokens []string
+		for _, w := range result.Warnings {
+			if w.Rule != RuleUndeclaredReportGroup {
+				t.Errorf("%q: unexpected rule %s", tt.csp, w.Rule)
+			}
+			tokens = append(tokens, w.Token)
+		}
+		if strings.Join(tokens, " ") != strings.Join(tt.tokens, " ") {
+			t.Errorf("%q: expected warnings for %v, got %v", tt.csp, tt.tokens, tokens)
+		}
+	}
+}
@@ -8,16 +8,17 @@ import (
 
 // HashInfo stores information about a computed hash
 type HashInfo struct {
-	Hash        string
-	ContentType string // "script", "style-tag", "style-attr", "event-handler"
-	SourceFile  string
-	Content     string
-	Snippet     string // Truncated content for display
+	Hash        string `json:"hash"`
+	ContentType string `json:"type"` // "script", "style-tag", "style-attr", "event-handler"
+	SourceFile  string `json:"file"`
+	Content     string `json:"-"`
+	Snippet     string `json:"snippet"` // Truncated content for display
 }
 
 // VerboseOutput handles displaying detailed information about hash generation
 type VerboseOutput struct {
 	Enabled           bool
+	Collect           bool // record hashes even when printing is disabled (used by --format json)
 	Hashes            []HashInfo
 	ExternalResources *ExternalResources
 }
@@ -33,7 +34,7 @@ func NewVerboseOutput(enabled bool) *VerboseOutput {
 
 // AddHash records a hash with its metadata
 func (vo *VerboseOutput) AddHash(hash, contentType, sourceFile, content string) {
-	if !vo.Enabled {
+	if !vo.Enabled && !vo.Collect {
 		return
 	}
 
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxListedDocuments is the number of documents listed for a group of violations
+const maxListedDocuments = 3
+
+// ViolationGroup counts the violations of one directive by one blocked resource
+type ViolationGroup struct {
+	Directive  string    `json:"directive"`
+	BlockedURL string    `json:"blockedURL"` // without query or fragment
+	Count      int       `json:"count"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Documents  []string  `json:"documents"` // distinct document URLs, in order of first report
+}
+
+// ReadViolations reads the violations reported at or after since from the log in dir,
+// oldest first. A zero since reads every violation.
+func ReadViolations(dir string, since time.Time) ([]Violation, error) {
+	var paths []string
+	for n := 1; ; n++ {
+		path := rotatedLogPath(dir, n)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		paths = append([]string{path}, paths...)
+	}
+	paths = append(paths, rotatedLogPath(dir, 0))
+
+	var violations []Violation
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+			var v Violation
+			if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+			if !v.Time.Before(since) {
+				violations = append(violations, v)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return violations, nil
+}
+
+// GroupViolations groups violations by directive and blocked resource, ignoring the
+// query and fragment of blocked URLs, from the most to the least reported
+func GroupViolations(violations []Violation) []ViolationGroup {
+	var groups []ViolationGroup
+	index := map[[2]string]int{}
+	for _, v := range violations {
+		key := [2]string{v.Directive, blockedResource(v.BlockedURL)}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ViolationGroup{Directive: key[0], BlockedURL: key[1], FirstSeen: v.Time, LastSeen: v.Time})
+		}
+		g := &groups[i]
+		g.Count++
+		if v.Time.Before(g.FirstSeen) {
+			g.FirstSeen = v.Time
+		}
+		if v.Time.After(g.LastSeen) {
+			g.LastSeen = v.Time
+		}
+		if !containsString(g.Documents, v.DocumentURL) {
+			g.Documents = append(g.Documents, v.DocumentURL)
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].LastSeen.After(groups[j].LastSeen)
+	})
+	return groups
+}
+
+// blockedResource returns a blocked URL without its query and fragment, which often
+// differ between reports of the same resource. Keywords such as "inline" are unchanged.
+func blockedResource(blocked string) string {
+	u, err := url.Parse(blocked)
+	if err != nil || u.Host == "" {
+		return blocked
+	}
+	u.RawQuery, u.Fragment, u.RawFragment, u.ForceQuery = "", "", "", false
+	return u.String()
+}
+
+// PrintViolationGroups prints the groups, one line per group followed by the documents
+// that reported it
+func PrintViolationGroups(w io.Writer, groups []ViolationGroup, total int) {
+	if total == 0 {
+		fmt.Fprintln(w, "No violations reported.")
+		return
+	}
+	fmt.Fprintf(w, "%d violation(s) in %d group(s)\n\n", total, len(groups))
+	for _, g := range groups {
+		blocked := g.BlockedURL
+		if blocked == "" {
+			blocked = "(no blocked URL)"
+		}
+		fmt.Fprintf(w, "%6d  %s  %s  (last %s)\n", g.Count, g.Directive, blocked, g.LastSeen.UTC().Format(time.RFC3339))
+		documents := g.Documents
+		if len(documents) > maxListedDocuments {
+			documents = documents[:maxListedDocuments]
+		}
+		more := ""
+		if extra := len(g.Documents) - len(documents); extra > 0 {
+			more = fmt.Sprintf(" and %d more", extra)
+		}
+		fmt.Fprintf(w, "        on %s%s\n", strings.Join(documents, ", "), more)
+	}
+}
+
+// runViolations implements the "csp violations" subcommand: it lists the violations
+// received by csp collect, grouped by directive and blocked URL. It returns the process
+// exit code.
+func runViolations(args []string) int {
+	fs := flag.NewFlagSet("violations", flag.ContinueOnError)
+	dir := fs.String("dir", "csp-reports", "Directory the reports were collected into")
+	since := fs.Duration("since", 24*time.Hour, "List the violations of this period, e.g. 1h or 168h (0 lists all)")
+	directive := fs.String("directive", "", "Only list violations of this directive, e.g. script-src-elem")
+	limit := fs.Int("limit", 20, "Maximum number of groups to list (0 lists all)")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: csp violations [--dir DIR] [--since DURATION] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "List the recent violations received by csp collect, grouped by directive and\n")
+		fmt.Fprintf(os.Stderr, "blocked URL, from the most to the least reported.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  csp violations --dir /var/log/csp --since 1h\n")
+		fmt.Fprintf(os.Stderr, "  csp violations --directive script-src-elem --limit 0 --format json\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 || (*format != "text" && *format != "json") || *since < 0 || *limit < 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	violations, err := ReadViolations(*dir, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *directive != "" {
+		kept := violations[:0]
+		for _, v := range violations {
+			if strings.EqualFold(v.Directive, *directive) {
+				kept = append(kept, v)
+			}
+		}
+		violations = kept
+	}
+
+	groups := GroupViolations(violations)
+	if *limit > 0 && len(groups) > *limit {
+		groups = groups[:*limit]
+	}
+	if *format == "json" {
+		if groups == nil {
+			groups = []ViolationGroup{}
+		}
+		if err := WriteJSON(os.Stdout, groups); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	PrintViolationGroups(os.Stdout, groups, len(violations))
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadViolations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"violations.2.jsonl": `{"time":"2026-01-01T00:00:00Z","directive":"img-src"}` + "\n",
+		"violations.1.jsonl": `{"time":"2026-01-02T00:00:00Z","directive":"font-src"}` + "\n\n",
+		"violations.jsonl":   `{"time":"2026-01-03T00:00:00Z","directive":"script-src-elem"}` + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	violations, err := ReadViolations(dir, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 || violations[0].Directive != "font-src" || violations[1].Directive != "script-src-elem" {
+		t.Errorf("Expected the font-src and script-src-elem violations, got %+v", violations)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "violations.jsonl"), []byte("{\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadViolations(dir, time.Time{}); err == nil || !strings.Contains(err.Error(), "violations.jsonl:1:") {
+		t.Errorf("Expected an error locating the invalid line, got %v", err)
+	}
+
+	if violations, err := ReadViolations(t.TempDir(), time.Time{}); err != nil || len(violations) != 0 {
+		t.Errorf("Expected no violations in an empty directory, got %v, %v", violations, err)
+	}
+}
+
+func TestGroupViolations(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2026, 1, 1, hour, 0, 0, 0, time.UTC) }
+	violations := []Violation{
+		{Time: at(1), Directive: "img-src", BlockedURL: "https://img.example.com/a.png", DocumentURL: "https://example.com/"},
+		{Time: at(2), Directive: "script-src-elem", BlockedURL: "https://cdn.example.com/a.js?v=1", DocumentURL: "https://example.com/"},
+		{Time: at(3), Directive: "script-src-elem", BlockedURL: "https://cdn.example.com/a.js?v=2#x", DocumentURL: "https://example.com/about"},
+		{Time: at(0), Directive: "script-src-elem", BlockedURL: "https://cdn.example.com/a.js", DocumentURL: "https://example.com/"},
+		{Time: at(4), Directive: "style-src-attr", BlockedURL: "inline", DocumentURL: "https://example.com/"},
+	}
+
+	groups := GroupViolations(violations)
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %+v", groups)
+	}
+
+	first := groups[0]
+	if first.Directive != "script-src-elem" || first.BlockedURL != "https://cdn.example.com/a.js" || first.Count != 3 {
+		t.Errorf("Expected the script group first, got %+v", first)
+	}
+	if !first.FirstSeen.Equal(at(0)) || !first.LastSeen.Equal(at(3)) {
+		t.Errorf("Expected first seen at 0h and last seen at 3h, got %v and %v", first.FirstSeen, first.LastSeen)
+	}
+	if strings.Join(first.Documents, " ") != "https://example.com/ https://example.com/about" {
+		t.Errorf("Expected the distinct documents, got %v", first.Documents)
+	}
+
+	// Groups with the same count are listed from the most recent
+	if groups[1].Directive != "style-src-attr" || groups[2].Directive != "img-src" {
+		t.Errorf("Expected style-src-attr before img-src, got %s and %s", groups[1].Directive, groups[2].Directive)
+	}
+}
+
+func TestPrintViolationGroups(t *testing.T) {
+	group := ViolationGroup{
+		Directive:  "script-src-elem",
+		BlockedURL: "https://cdn.example.com/a.js",
+		Count:      5,
+		LastSeen:   time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Documents:  []string{"https://example.com/1", "https://example.com/2", "https://example.com/3", "https://example.com/4"},
+	}
+
+	var out strings.Builder
+	PrintViolationGroups(&out, []ViolationGroup{group}, 5)
+	expected := "5 violation(s) in 1 group(s)\n\n" +
+		"     5  script-src-elem  https://cdn.example.com/a.js  (last 2026-01-01T12:00:00Z)\n" +
+		"        on https://example.com/1, https://example.com/2, https://example.com/3 and 1 more\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	PrintViolationGroups(&out, nil, 0)
+	if out.String() != "No violations reported.\n" {
+		t.Errorf("Expected no violations message, got %q", out.String())
+	}
+}